@@ -0,0 +1,483 @@
+// Package appconfig loads the service configuration. Every setting has a
+// default and can be overridden, in increasing order of precedence, by a
+// YAML file, an environment variable and a command line flag.
+package appconfig
+
+import (
+	"bytes"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+type Config struct {
+	Server      ServerConfig      `yaml:"server"`
+	Consul      ConsulConfig      `yaml:"consul"`
+	Log         LogConfig         `yaml:"log"`
+	Tracing     TracingConfig     `yaml:"tracing"`
+	Auth        AuthConfig        `yaml:"auth"`
+	Secrets     SecretsConfig     `yaml:"secrets"`
+	Idempotency IdempotencyConfig `yaml:"idempotency"`
+	RateLimit   RateLimitConfig   `yaml:"rateLimit"`
+	Concurrency ConcurrencyConfig `yaml:"concurrency"`
+	Readiness   ReadinessConfig   `yaml:"readiness"`
+	Inventory   InventoryConfig   `yaml:"inventory"`
+}
+
+type ServerConfig struct {
+	Addr string `yaml:"addr"`
+	// ShutdownTimeout bounds how long in-flight requests may take to finish.
+	ShutdownTimeout time.Duration `yaml:"shutdownTimeout"`
+	// DrainDelay is how long /readyz fails before the server stops, so load
+	// balancers stop sending traffic first.
+	DrainDelay time.Duration `yaml:"drainDelay"`
+	// TrustedProxies is a comma separated list of proxy addresses or CIDRs
+	// whose forwarding headers are believed.
+	TrustedProxies string `yaml:"trustedProxies"`
+	// ForwardedHeader is the one header those proxies set: X-Forwarded-For
+	// or Forwarded. The other is never read.
+	ForwardedHeader string `yaml:"forwardedHeader"`
+}
+
+type ConsulConfig struct {
+	Address    string `yaml:"address"`
+	Datacenter string `yaml:"datacenter"`
+	// Token is the ACL token; prefer TokenFile so it stays out of the
+	// config file and the environment.
+	Token     string `yaml:"token"`
+	TokenFile string `yaml:"tokenFile"`
+	// TLS switches to HTTPS; CAFile and a client certificate imply it.
+	TLS           bool   `yaml:"tls"`
+	CAFile        string `yaml:"caFile"`
+	CertFile      string `yaml:"certFile"`
+	KeyFile       string `yaml:"keyFile"`
+	TLSServerName string `yaml:"tlsServerName"`
+	// KeyPrefix namespaces every key, so deployments can share a cluster.
+	KeyPrefix string `yaml:"keyPrefix"`
+	// ProbeInterval is how often Consul reachability is checked.
+	ProbeInterval time.Duration `yaml:"probeInterval"`
+	// CallTimeout bounds every KV call except blocking queries; 0 disables it.
+	CallTimeout time.Duration `yaml:"callTimeout"`
+	// ReadRetries is how often a failed read is retried; writes never are.
+	// 0 disables retries.
+	ReadRetries    int           `yaml:"readRetries"`
+	RetryBaseDelay time.Duration `yaml:"retryBaseDelay"`
+	RetryMaxDelay  time.Duration `yaml:"retryMaxDelay"`
+	// BreakerFailures consecutive failures open the circuit breaker for
+	// BreakerCooldown; 0 disables the breaker.
+	BreakerFailures int           `yaml:"breakerFailures"`
+	BreakerCooldown time.Duration `yaml:"breakerCooldown"`
+}
+
+type LogConfig struct {
+	// Level is debug, info, warn or error.
+	Level string `yaml:"level"`
+}
+
+type TracingConfig struct {
+	// ConfigFile is the JSON tracing pipeline configuration.
+	ConfigFile string `yaml:"configFile"`
+}
+
+type AuthConfig struct {
+	JWKSFile        string `yaml:"jwksFile"`
+	JWTIssuer       string `yaml:"jwtIssuer"`
+	JWTAudience     string `yaml:"jwtAudience"`
+	BootstrapAPIKey string `yaml:"bootstrapApiKey"`
+	AllowAnonymous  bool   `yaml:"allowAnonymous"`
+}
+
+type SecretsConfig struct {
+	KeyringFile string `yaml:"keyringFile"`
+}
+
+type IdempotencyConfig struct {
+	// Store is consul, or memory for single-node setups.
+	Store          string        `yaml:"store"`
+	MemoryCapacity int           `yaml:"memoryCapacity"`
+	TTL            time.Duration `yaml:"ttl"`
+	Lease          time.Duration `yaml:"lease"`
+	SweepInterval  time.Duration `yaml:"sweepInterval"`
+}
+
+type RateLimitConfig struct {
+	// PolicyFile replaces the built-in policies, exemptions included.
+	PolicyFile string `yaml:"policyFile"`
+	// BucketTTL is how long an idle client bucket is kept.
+	BucketTTL time.Duration `yaml:"bucketTtl"`
+	// Shared enforces the limit across all replicas.
+	Shared     bool          `yaml:"shared"`
+	Window     time.Duration `yaml:"window"`
+	FailClosed bool          `yaml:"failClosed"`
+	// ClientIPRate and ClientIPBurst limit every client IP before
+	// authentication, so failed logins are limited as well; rate 0 turns
+	// the limit off.
+	ClientIPRate  float64 `yaml:"clientIpRate"`
+	ClientIPBurst int     `yaml:"clientIpBurst"`
+}
+
+type ConcurrencyConfig struct {
+	InitialLimit  int           `yaml:"initialLimit"`
+	MinLimit      int           `yaml:"minLimit"`
+	MaxLimit      int           `yaml:"maxLimit"`
+	TargetLatency time.Duration `yaml:"targetLatency"`
+	WriteShare    float64       `yaml:"writeShare"`
+}
+
+type ReadinessConfig struct {
+	Timeout      time.Duration `yaml:"timeout"`
+	KVMaxLatency time.Duration `yaml:"kvMaxLatency"`
+}
+
+type InventoryConfig struct {
+	Interval time.Duration `yaml:"interval"`
+}
+
+// Default is the configuration used when nothing overrides it.
+func Default() Config {
+	return Config{
+		Server: ServerConfig{
+			Addr:            ":8080",
+			ShutdownTimeout: 10 * time.Second,
+			DrainDelay:      5 * time.Second,
+			ForwardedHeader: "X-Forwarded-For",
+		},
+		Consul: ConsulConfig{
+			Address:         "consul:8500",
+			ProbeInterval:   15 * time.Second,
+			CallTimeout:     5 * time.Second,
+			ReadRetries:     2,
+			RetryBaseDelay:  50 * time.Millisecond,
+			RetryMaxDelay:   time.Second,
+			BreakerFailures: 5,
+			BreakerCooldown: 10 * time.Second,
+		},
+		Log: LogConfig{Level: "info"},
+		Idempotency: IdempotencyConfig{
+			Store:          "consul",
+			MemoryCapacity: 10000,
+			TTL:            24 * time.Hour,
+			Lease:          time.Minute,
+			SweepInterval:  5 * time.Minute,
+		},
+		RateLimit: RateLimitConfig{
+			BucketTTL:     2 * time.Minute,
+			Window:        10 * time.Second,
+			ClientIPRate:  50,
+			ClientIPBurst: 100,
+		},
+		Concurrency: ConcurrencyConfig{
+			InitialLimit:  100,
+			MinLimit:      4,
+			MaxLimit:      1000,
+			TargetLatency: 250 * time.Millisecond,
+			WriteShare:    0.75,
+		},
+		Readiness: ReadinessConfig{
+			Timeout:      2 * time.Second,
+			KVMaxLatency: 500 * time.Millisecond,
+		},
+		Inventory: InventoryConfig{Interval: time.Minute},
+	}
+}
+
+// setting describes how one field is named outside the YAML file.
+type setting struct {
+	// path is the dotted YAML path, e.g. "server.addr".
+	path string
+	env  string
+	flag string
+	// reloadable settings take effect on SIGHUP; all others need a restart.
+	reloadable bool
+	secret     bool
+	// zeroDisables numbers may be 0 to turn the feature off.
+	zeroDisables bool
+}
+
+var settings = []setting{
+	{path: "server.addr", env: "SERVER_ADDR", flag: "addr"},
+	{path: "server.shutdownTimeout", env: "SHUTDOWN_TIMEOUT", flag: "shutdown-timeout"},
+	{path: "server.drainDelay", env: "SHUTDOWN_DRAIN_DELAY", flag: "drain-delay"},
+	{path: "server.trustedProxies", env: "TRUSTED_PROXIES", flag: "trusted-proxies"},
+	{path: "server.forwardedHeader", env: "FORWARDED_HEADER", flag: "forwarded-header"},
+	{path: "consul.address", env: "CONSUL_HTTP_ADDR", flag: "consul-addr"},
+	{path: "consul.datacenter", env: "CONSUL_DATACENTER", flag: "consul-datacenter"},
+	{path: "consul.token", env: "CONSUL_HTTP_TOKEN", secret: true},
+	{path: "consul.tokenFile", env: "CONSUL_HTTP_TOKEN_FILE", flag: "consul-token-file"},
+	{path: "consul.tls", env: "CONSUL_HTTP_SSL", flag: "consul-tls"},
+	{path: "consul.caFile", env: "CONSUL_CACERT", flag: "consul-cacert"},
+	{path: "consul.certFile", env: "CONSUL_CLIENT_CERT", flag: "consul-client-cert"},
+	{path: "consul.keyFile", env: "CONSUL_CLIENT_KEY", flag: "consul-client-key"},
+	{path: "consul.tlsServerName", env: "CONSUL_TLS_SERVER_NAME", flag: "consul-tls-server-name"},
+	{path: "consul.keyPrefix", env: "CONSUL_KEY_PREFIX", flag: "consul-key-prefix"},
+	{path: "consul.probeInterval", env: "CONSUL_PROBE_INTERVAL", flag: "consul-probe-interval"},
+	{path: "consul.callTimeout", env: "CONSUL_CALL_TIMEOUT", flag: "consul-call-timeout", zeroDisables: true},
+	{path: "consul.readRetries", env: "CONSUL_READ_RETRIES", flag: "consul-read-retries", zeroDisables: true},
+	{path: "consul.retryBaseDelay", env: "CONSUL_RETRY_BASE_DELAY"},
+	{path: "consul.retryMaxDelay", env: "CONSUL_RETRY_MAX_DELAY"},
+	{path: "consul.breakerFailures", env: "CONSUL_BREAKER_FAILURES", flag: "consul-breaker-failures", zeroDisables: true},
+	{path: "consul.breakerCooldown", env: "CONSUL_BREAKER_COOLDOWN", flag: "consul-breaker-cooldown"},
+	{path: "log.level", env: "LOG_LEVEL", flag: "log-level", reloadable: true},
+	{path: "tracing.configFile", env: "TRACING_CONFIG_FILE", flag: "tracing-config"},
+	{path: "auth.jwksFile", env: "AUTH_JWKS_FILE", flag: "jwks-file"},
+	{path: "auth.jwtIssuer", env: "AUTH_JWT_ISSUER", flag: "jwt-issuer"},
+	{path: "auth.jwtAudience", env: "AUTH_JWT_AUDIENCE", flag: "jwt-audience"},
+	{path: "auth.bootstrapApiKey", env: "AUTH_BOOTSTRAP_API_KEY", secret: true},
+	{path: "auth.allowAnonymous", env: "AUTH_ALLOW_ANONYMOUS", flag: "allow-anonymous"},
+	{path: "secrets.keyringFile", env: "SECRETS_KEYRING_FILE", flag: "keyring-file"},
+	{path: "idempotency.store", env: "IDEMPOTENCY_STORE", flag: "idempotency-store"},
+	{path: "idempotency.memoryCapacity", env: "IDEMPOTENCY_MEMORY_CAPACITY"},
+	{path: "idempotency.ttl", env: "IDEMPOTENCY_TTL"},
+	{path: "idempotency.lease", env: "IDEMPOTENCY_LEASE"},
+	{path: "idempotency.sweepInterval", env: "IDEMPOTENCY_SWEEP_INTERVAL"},
+	{path: "rateLimit.policyFile", env: "RATE_LIMIT_POLICY_FILE", flag: "rate-limit-policy-file", reloadable: true},
+	{path: "rateLimit.bucketTtl", env: "RATE_LIMIT_BUCKET_TTL"},
+	{path: "rateLimit.shared", env: "RATE_LIMIT_SHARED", flag: "rate-limit-shared"},
+	{path: "rateLimit.window", env: "RATE_LIMIT_WINDOW"},
+	{path: "rateLimit.failClosed", env: "RATE_LIMIT_FAIL_CLOSED"},
+	{path: "rateLimit.clientIpRate", env: "RATE_LIMIT_CLIENT_IP_RATE"},
+	{path: "rateLimit.clientIpBurst", env: "RATE_LIMIT_CLIENT_IP_BURST"},
+	{path: "concurrency.initialLimit", env: "CONCURRENCY_INITIAL_LIMIT"},
+	{path: "concurrency.minLimit", env: "CONCURRENCY_MIN_LIMIT"},
+	{path: "concurrency.maxLimit", env: "CONCURRENCY_MAX_LIMIT"},
+	{path: "concurrency.targetLatency", env: "CONCURRENCY_TARGET_LATENCY"},
+	{path: "concurrency.writeShare", env: "CONCURRENCY_WRITE_SHARE"},
+	{path: "readiness.timeout", env: "READINESS_TIMEOUT"},
+	{path: "readiness.kvMaxLatency", env: "READINESS_KV_MAX_LATENCY"},
+	{path: "inventory.interval", env: "INVENTORY_INTERVAL"},
+}
+
+// field returns the struct field at a dotted YAML path.
+func field(c *Config, path string) reflect.Value {
+	v := reflect.ValueOf(c).Elem()
+	for _, name := range strings.Split(path, ".") {
+		t := v.Type()
+		found := false
+		for i := 0; i < t.NumField(); i++ {
+			if strings.Split(t.Field(i).Tag.Get("yaml"), ",")[0] == name {
+				v = v.Field(i)
+				found = true
+				break
+			}
+		}
+		if !found {
+			panic("appconfig: unknown setting " + path)
+		}
+	}
+	return v
+}
+
+// set parses s into the field at path.
+func set(c *Config, path, s string) error {
+	v := field(c, path)
+	switch v.Interface().(type) {
+	case string:
+		v.SetString(s)
+	case bool:
+		b, err := strconv.ParseBool(s)
+		if err != nil {
+			return fmt.Errorf("%s: %w", path, err)
+		}
+		v.SetBool(b)
+	case int:
+		n, err := strconv.Atoi(s)
+		if err != nil {
+			return fmt.Errorf("%s: %w", path, err)
+		}
+		v.SetInt(int64(n))
+	case float64:
+		f, err := strconv.ParseFloat(s, 64)
+		if err != nil {
+			return fmt.Errorf("%s: %w", path, err)
+		}
+		v.SetFloat(f)
+	case time.Duration:
+		d, err := time.ParseDuration(s)
+		if err != nil {
+			return fmt.Errorf("%s: %w", path, err)
+		}
+		v.SetInt(int64(d))
+	default:
+		return fmt.Errorf("%s: unsupported type %s", path, v.Type())
+	}
+	return nil
+}
+
+// Options are the command line arguments that are not settings.
+type Options struct {
+	// File is the YAML configuration file, from --config or CONFIG_FILE.
+	File string
+	// PrintConfig asks to print the effective configuration and exit.
+	PrintConfig bool
+	// Args are the arguments left after the flags, e.g. a subcommand.
+	Args []string
+}
+
+// Load builds the configuration from defaults, the YAML file, the
+// environment and the command line args (without the program name), in
+// that order of precedence, and validates it.
+func Load(args []string) (Config, Options, error) {
+	var opts Options
+
+	fs := flag.NewFlagSet("config-service", flag.ContinueOnError)
+	fs.StringVar(&opts.File, "config", os.Getenv("CONFIG_FILE"), "YAML configuration file")
+	fs.BoolVar(&opts.PrintConfig, "print-config", false, "print the effective configuration and exit")
+	flags := map[string]*string{}
+	for _, s := range settings {
+		if s.flag != "" {
+			flags[s.flag] = fs.String(s.flag, "", fmt.Sprintf("%s (env %s)", s.path, s.env))
+		}
+	}
+	if err := fs.Parse(args); err != nil {
+		return Config{}, opts, err
+	}
+	opts.Args = fs.Args()
+
+	cfg := Default()
+	if opts.File != "" {
+		data, err := os.ReadFile(opts.File)
+		if err != nil {
+			return cfg, opts, err
+		}
+		// Unknown keys are rejected so typos do not silently fall back
+		dec := yaml.NewDecoder(bytes.NewReader(data))
+		dec.KnownFields(true)
+		if err := dec.Decode(&cfg); err != nil && !errors.Is(err, io.EOF) {
+			return cfg, opts, fmt.Errorf("%s: %w", opts.File, err)
+		}
+	}
+
+	for _, s := range settings {
+		if v, ok := os.LookupEnv(s.env); ok && v != "" {
+			if err := set(&cfg, s.path, v); err != nil {
+				return cfg, opts, fmt.Errorf("%s: %w", s.env, err)
+			}
+		}
+	}
+
+	var flagErr error
+	fs.Visit(func(f *flag.Flag) {
+		if p, ok := flags[f.Name]; ok && flagErr == nil {
+			for _, s := range settings {
+				if s.flag == f.Name {
+					flagErr = set(&cfg, s.path, *p)
+				}
+			}
+		}
+	})
+	if flagErr != nil {
+		return cfg, opts, flagErr
+	}
+
+	return cfg, opts, cfg.Validate()
+}
+
+// Validate checks the settings the service can not start without.
+func (c Config) Validate() error {
+	var errs []error
+	if _, _, err := net.SplitHostPort(c.Server.Addr); err != nil {
+		errs = append(errs, fmt.Errorf("server.addr: %w", err))
+	}
+	switch strings.ToLower(c.Server.ForwardedHeader) {
+	case "x-forwarded-for", "forwarded":
+	default:
+		errs = append(errs, fmt.Errorf("server.forwardedHeader: expected X-Forwarded-For or Forwarded, got %q", c.Server.ForwardedHeader))
+	}
+	if c.Consul.Address == "" {
+		errs = append(errs, errors.New("consul.address is required"))
+	}
+	if c.Consul.Token != "" && c.Consul.TokenFile != "" {
+		errs = append(errs, errors.New("consul: set either token or tokenFile, not both"))
+	}
+	if (c.Consul.CertFile == "") != (c.Consul.KeyFile == "") {
+		errs = append(errs, errors.New("consul: certFile and keyFile must be set together"))
+	}
+	if c.Consul.RetryBaseDelay > c.Consul.RetryMaxDelay {
+		errs = append(errs, errors.New("consul: retryBaseDelay must not exceed retryMaxDelay"))
+	}
+	switch c.Log.Level {
+	case "debug", "info", "warn", "error":
+	default:
+		errs = append(errs, fmt.Errorf("log.level: unknown level %q", c.Log.Level))
+	}
+	switch c.Idempotency.Store {
+	case "consul", "memory":
+	default:
+		errs = append(errs, fmt.Errorf("idempotency.store: unknown store %q", c.Idempotency.Store))
+	}
+	if c.Concurrency.MinLimit > c.Concurrency.InitialLimit || c.Concurrency.InitialLimit > c.Concurrency.MaxLimit {
+		errs = append(errs, errors.New("concurrency: expected minLimit <= initialLimit <= maxLimit"))
+	}
+	if c.RateLimit.ClientIPRate < 0 {
+		errs = append(errs, errors.New("rateLimit.clientIpRate must not be negative"))
+	}
+	if c.Concurrency.WriteShare <= 0 || c.Concurrency.WriteShare > 1 {
+		errs = append(errs, errors.New("concurrency.writeShare must be in (0, 1]"))
+	}
+
+	for _, s := range settings {
+		v := field(&c, s.path)
+		switch x := v.Interface().(type) {
+		case time.Duration:
+			errs = append(errs, s.checkNumber(x < 0, x == 0))
+		case int:
+			errs = append(errs, s.checkNumber(x < 0, x == 0))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// checkNumber rejects negative numbers, and zero unless it disables s.
+func (s setting) checkNumber(negative, zero bool) error {
+	switch {
+	case negative && s.zeroDisables:
+		return fmt.Errorf("%s must not be negative", s.path)
+	case negative || zero && !s.zeroDisables:
+		return fmt.Errorf("%s must be positive", s.path)
+	}
+	return nil
+}
+
+// Masked returns a copy with secrets replaced, safe to print or log.
+func (c Config) Masked() Config {
+	for _, s := range settings {
+		if v := field(&c, s.path); s.secret && v.String() != "" {
+			v.SetString("********")
+		}
+	}
+	return c
+}
+
+// Print writes the configuration as YAML with secrets masked.
+func (c Config) Print(w io.Writer) error {
+	enc := yaml.NewEncoder(w)
+	enc.SetIndent(2)
+	if err := enc.Encode(c.Masked()); err != nil {
+		return err
+	}
+	return enc.Close()
+}
+
+// RestartRequired lists the settings that differ in next but only take
+// effect after a restart.
+func (c Config) RestartRequired(next Config) []string {
+	var changed []string
+	for _, s := range settings {
+		if s.reloadable {
+			continue
+		}
+		if !reflect.DeepEqual(field(&c, s.path).Interface(), field(&next, s.path).Interface()) {
+			changed = append(changed, s.path)
+		}
+	}
+	return changed
+}
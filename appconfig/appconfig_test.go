@@ -0,0 +1,118 @@
+package appconfig
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func writeFile(t *testing.T, content string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "config.yaml")
+	if err := os.WriteFile(path, []byte(content), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestLoadPrecedence(t *testing.T) {
+	path := writeFile(t, `
+server:
+  addr: ":9000"
+  shutdownTimeout: 30s
+consul:
+  address: file:8500
+log:
+  level: warn
+`)
+	t.Setenv("CONSUL_HTTP_ADDR", "env:8500")
+	t.Setenv("LOG_LEVEL", "error")
+
+	cfg, opts, err := Load([]string{"--config", path, "--log-level", "debug", "rotate-secrets"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if cfg.Server.Addr != ":9000" || cfg.Server.ShutdownTimeout != 30*time.Second {
+		t.Errorf("file settings not applied: %+v", cfg.Server)
+	}
+	if cfg.Consul.Address != "env:8500" {
+		t.Errorf("consul.address = %q, env should override the file", cfg.Consul.Address)
+	}
+	if cfg.Log.Level != "debug" {
+		t.Errorf("log.level = %q, flag should override env", cfg.Log.Level)
+	}
+	if cfg.Idempotency.TTL != 24*time.Hour {
+		t.Errorf("idempotency.ttl = %s, want the default", cfg.Idempotency.TTL)
+	}
+	if len(opts.Args) != 1 || opts.Args[0] != "rotate-secrets" {
+		t.Errorf("args = %v", opts.Args)
+	}
+}
+
+func TestLoadRejectsInvalid(t *testing.T) {
+	cases := map[string]string{
+		"bad duration":     "server:\n  shutdownTimeout: soon\n",
+		"bad level":        "log:\n  level: loud\n",
+		"bad store":        "idempotency:\n  store: redis\n",
+		"zero interval":    "inventory:\n  interval: 0s\n",
+		"negative retries": "consul:\n  readRetries: -1\n",
+		"unknown key":      "server:\n  adress: \":9000\"\n",
+	}
+	for name, content := range cases {
+		t.Run(name, func(t *testing.T) {
+			if _, _, err := Load([]string{"--config", writeFile(t, content)}); err == nil {
+				t.Fatal("expected error")
+			}
+		})
+	}
+}
+
+func TestLoadAllowsZeroToDisable(t *testing.T) {
+	path := writeFile(t, "consul:\n  callTimeout: 0s\n  readRetries: 0\n  breakerFailures: 0\n")
+
+	cfg, _, err := Load([]string{"--config", path})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cfg.Consul.CallTimeout != 0 || cfg.Consul.ReadRetries != 0 || cfg.Consul.BreakerFailures != 0 {
+		t.Errorf("zero values not kept: %+v", cfg.Consul)
+	}
+}
+
+func TestPrintMasksSecrets(t *testing.T) {
+	cfg := Default()
+	cfg.Auth.BootstrapAPIKey = "s3cr3t"
+
+	var buf bytes.Buffer
+	if err := cfg.Print(&buf); err != nil {
+		t.Fatal(err)
+	}
+	out := buf.String()
+	if strings.Contains(out, "s3cr3t") {
+		t.Fatalf("secret printed:\n%s", out)
+	}
+	if !strings.Contains(out, "shutdownTimeout: 10s") {
+		t.Fatalf("durations should print as strings:\n%s", out)
+	}
+	if cfg.Auth.BootstrapAPIKey != "s3cr3t" {
+		t.Fatal("Print must not modify the config")
+	}
+}
+
+func TestRestartRequired(t *testing.T) {
+	cur := Default()
+	next := Default()
+	next.Log.Level = "debug"
+	if changed := cur.RestartRequired(next); len(changed) != 0 {
+		t.Fatalf("log level is reloadable, got %v", changed)
+	}
+
+	next.Consul.Address = "other:8500"
+	if changed := cur.RestartRequired(next); len(changed) != 1 || changed[0] != "consul.address" {
+		t.Fatalf("changed = %v, want [consul.address]", changed)
+	}
+}
@@ -0,0 +1,27 @@
+package auth
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+)
+
+// APIKeyPrefix marks keys issued by this service so they are easy to spot in
+// secret scanners.
+const APIKeyPrefix = "cfgsvc_"
+
+// GenerateAPIKey returns a new random API key. Only its hash is ever stored.
+func GenerateAPIKey() (string, error) {
+	buf := make([]byte, 32)
+	if _, err := rand.Read(buf); err != nil {
+		return "", err
+	}
+	return APIKeyPrefix + hex.EncodeToString(buf), nil
+}
+
+// HashAPIKey returns the hex SHA-256 of key. API keys are long random
+// strings, so a fast unsalted hash is enough to make the stored form useless.
+func HashAPIKey(key string) string {
+	sum := sha256.Sum256([]byte(key))
+	return hex.EncodeToString(sum[:])
+}
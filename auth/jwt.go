@@ -0,0 +1,254 @@
+package auth
+
+import (
+	"crypto"
+	"crypto/hmac"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/big"
+	"os"
+	"strings"
+	"time"
+)
+
+var (
+	ErrInvalidToken = errors.New("invalid token")
+	ErrTokenExpired = errors.New("token expired")
+	ErrUnknownKey   = errors.New("unknown signing key")
+)
+
+// clockSkew tolerates small clock differences between issuer and service.
+const clockSkew = 30 * time.Second
+
+// jwk is the subset of RFC 7517 we need for HS256 ("oct") and RS256 ("RSA").
+type jwk struct {
+	Kty string `json:"kty"`
+	Kid string `json:"kid"`
+	Alg string `json:"alg"`
+	K   string `json:"k"`
+	N   string `json:"n"`
+	E   string `json:"e"`
+}
+
+type verificationKey struct {
+	kid    string
+	alg    string
+	secret []byte
+	public *rsa.PublicKey
+}
+
+// Claims are the JWT claims the service understands.
+type Claims struct {
+	Subject   string   `json:"sub"`
+	Issuer    string   `json:"iss"`
+	Audience  audience `json:"aud"`
+	ExpiresAt int64    `json:"exp"`
+	NotBefore int64    `json:"nbf"`
+	IssuedAt  int64    `json:"iat"`
+	Roles     []string `json:"roles"`
+}
+
+// audience accepts both the string and the array form of "aud".
+type audience []string
+
+func (a *audience) UnmarshalJSON(b []byte) error {
+	var single string
+	if err := json.Unmarshal(b, &single); err == nil {
+		*a = audience{single}
+		return nil
+	}
+	var many []string
+	if err := json.Unmarshal(b, &many); err != nil {
+		return err
+	}
+	*a = many
+	return nil
+}
+
+// JWTVerifier checks HS256 and RS256 tokens locally against a fixed key set.
+type JWTVerifier struct {
+	keys     []verificationKey
+	issuer   string
+	audience string
+	now      func() time.Time
+}
+
+// NewJWTVerifier builds a verifier from a JWKS document. Empty issuer or
+// audience disables that check.
+func NewJWTVerifier(jwks []byte, issuer, audience string) (*JWTVerifier, error) {
+	var set struct {
+		Keys []jwk `json:"keys"`
+	}
+	if err := json.Unmarshal(jwks, &set); err != nil {
+		return nil, fmt.Errorf("parse JWKS: %w", err)
+	}
+
+	v := &JWTVerifier{issuer: issuer, audience: audience, now: time.Now}
+	for _, k := range set.Keys {
+		key, err := parseJWK(k)
+		if err != nil {
+			return nil, fmt.Errorf("key %q: %w", k.Kid, err)
+		}
+		v.keys = append(v.keys, key)
+	}
+	if len(v.keys) == 0 {
+		return nil, errors.New("JWKS contains no keys")
+	}
+	return v, nil
+}
+
+// LoadJWTVerifier reads a JWKS file.
+func LoadJWTVerifier(path, issuer, audience string) (*JWTVerifier, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	return NewJWTVerifier(data, issuer, audience)
+}
+
+func parseJWK(k jwk) (verificationKey, error) {
+	switch k.Kty {
+	case "oct":
+		if k.Alg != "" && k.Alg != "HS256" {
+			return verificationKey{}, fmt.Errorf("unsupported alg %q for oct key", k.Alg)
+		}
+		secret, err := base64.RawURLEncoding.DecodeString(k.K)
+		if err != nil || len(secret) == 0 {
+			return verificationKey{}, errors.New("invalid oct key material")
+		}
+		return verificationKey{kid: k.Kid, alg: "HS256", secret: secret}, nil
+	case "RSA":
+		if k.Alg != "" && k.Alg != "RS256" {
+			return verificationKey{}, fmt.Errorf("unsupported alg %q for RSA key", k.Alg)
+		}
+		n, err := base64.RawURLEncoding.DecodeString(k.N)
+		if err != nil {
+			return verificationKey{}, errors.New("invalid RSA modulus")
+		}
+		e, err := base64.RawURLEncoding.DecodeString(k.E)
+		if err != nil {
+			return verificationKey{}, errors.New("invalid RSA exponent")
+		}
+		pub := &rsa.PublicKey{N: new(big.Int).SetBytes(n), E: int(new(big.Int).SetBytes(e).Int64())}
+		return verificationKey{kid: k.Kid, alg: "RS256", public: pub}, nil
+	default:
+		return verificationKey{}, fmt.Errorf("unsupported key type %q", k.Kty)
+	}
+}
+
+// Verify checks the token's signature and time/issuer/audience claims and
+// returns its claims together with the ID of the key that verified it.
+func (v *JWTVerifier) Verify(token string) (*Claims, string, error) {
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return nil, "", ErrInvalidToken
+	}
+
+	var header struct {
+		Alg string `json:"alg"`
+		Kid string `json:"kid"`
+	}
+	if err := decodeSegment(parts[0], &header); err != nil {
+		return nil, "", ErrInvalidToken
+	}
+
+	sig, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil {
+		return nil, "", ErrInvalidToken
+	}
+	signed := []byte(parts[0] + "." + parts[1])
+
+	key, err := v.verify(header.Alg, header.Kid, signed, sig)
+	if err != nil {
+		return nil, "", err
+	}
+
+	var claims Claims
+	if err := decodeSegment(parts[1], &claims); err != nil {
+		return nil, "", ErrInvalidToken
+	}
+	if err := v.validate(&claims); err != nil {
+		return nil, "", err
+	}
+	return &claims, key.kid, nil
+}
+
+// verify finds a key for alg (and kid, if set) whose signature matches. The
+// key type decides the algorithm, so an RSA key can never verify an HMAC.
+func (v *JWTVerifier) verify(alg, kid string, signed, sig []byte) (verificationKey, error) {
+	if alg != "HS256" && alg != "RS256" {
+		return verificationKey{}, fmt.Errorf("%w: unsupported alg %q", ErrInvalidToken, alg)
+	}
+
+	found := false
+	for _, key := range v.keys {
+		if key.alg != alg || (kid != "" && key.kid != kid) {
+			continue
+		}
+		found = true
+
+		switch alg {
+		case "HS256":
+			mac := hmac.New(sha256.New, key.secret)
+			mac.Write(signed)
+			if hmac.Equal(mac.Sum(nil), sig) {
+				return key, nil
+			}
+		case "RS256":
+			digest := sha256.Sum256(signed)
+			if rsa.VerifyPKCS1v15(key.public, crypto.SHA256, digest[:], sig) == nil {
+				return key, nil
+			}
+		}
+	}
+
+	if !found {
+		return verificationKey{}, ErrUnknownKey
+	}
+	return verificationKey{}, fmt.Errorf("%w: bad signature", ErrInvalidToken)
+}
+
+func (v *JWTVerifier) validate(c *Claims) error {
+	now := v.now()
+
+	if c.Subject == "" {
+		return fmt.Errorf("%w: missing sub", ErrInvalidToken)
+	}
+	if c.ExpiresAt == 0 {
+		return fmt.Errorf("%w: missing exp", ErrInvalidToken)
+	}
+	if now.After(time.Unix(c.ExpiresAt, 0).Add(clockSkew)) {
+		return ErrTokenExpired
+	}
+	if c.NotBefore != 0 && now.Add(clockSkew).Before(time.Unix(c.NotBefore, 0)) {
+		return fmt.Errorf("%w: not valid yet", ErrInvalidToken)
+	}
+	if v.issuer != "" && c.Issuer != v.issuer {
+		return fmt.Errorf("%w: unexpected issuer", ErrInvalidToken)
+	}
+	if v.audience != "" {
+		ok := false
+		for _, a := range c.Audience {
+			if a == v.audience {
+				ok = true
+				break
+			}
+		}
+		if !ok {
+			return fmt.Errorf("%w: unexpected audience", ErrInvalidToken)
+		}
+	}
+	return nil
+}
+
+func decodeSegment(seg string, out any) error {
+	data, err := base64.RawURLEncoding.DecodeString(seg)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(data, out)
+}
@@ -0,0 +1,117 @@
+package auth
+
+import (
+	"crypto"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"math/big"
+	"testing"
+	"time"
+)
+
+func b64(b []byte) string {
+	return base64.RawURLEncoding.EncodeToString(b)
+}
+
+func signHS256(t *testing.T, secret []byte, header, claims map[string]any) string {
+	t.Helper()
+	h, _ := json.Marshal(header)
+	c, _ := json.Marshal(claims)
+	signing := b64(h) + "." + b64(c)
+	mac := hmac.New(sha256.New, secret)
+	mac.Write([]byte(signing))
+	return signing + "." + b64(mac.Sum(nil))
+}
+
+func TestVerifyHS256(t *testing.T) {
+	secret := []byte("super-secret-key")
+	jwks := `{"keys":[{"kty":"oct","kid":"hs","k":"` + b64(secret) + `"}]}`
+
+	v, err := NewJWTVerifier([]byte(jwks), "issuer", "config-service")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	token := signHS256(t, secret, map[string]any{"alg": "HS256", "kid": "hs"}, map[string]any{
+		"sub":   "alice",
+		"iss":   "issuer",
+		"aud":   "config-service",
+		"exp":   time.Now().Add(time.Hour).Unix(),
+		"roles": []string{"editor"},
+	})
+
+	claims, kid, err := v.Verify(token)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if claims.Subject != "alice" || kid != "hs" {
+		t.Errorf("expected alice/hs, got %s/%s", claims.Subject, kid)
+	}
+	if len(claims.Roles) != 1 || claims.Roles[0] != "editor" {
+		t.Errorf("expected roles [editor], got %v", claims.Roles)
+	}
+}
+
+func TestVerifyHS256_Expired(t *testing.T) {
+	secret := []byte("super-secret-key")
+	jwks := `{"keys":[{"kty":"oct","kid":"hs","k":"` + b64(secret) + `"}]}`
+	v, _ := NewJWTVerifier([]byte(jwks), "", "")
+
+	token := signHS256(t, secret, map[string]any{"alg": "HS256"}, map[string]any{
+		"sub": "alice",
+		"exp": time.Now().Add(-time.Hour).Unix(),
+	})
+
+	if _, _, err := v.Verify(token); !errors.Is(err, ErrTokenExpired) {
+		t.Fatalf("expected ErrTokenExpired, got %v", err)
+	}
+}
+
+func TestVerifyRS256(t *testing.T) {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	jwks := `{"keys":[{"kty":"RSA","kid":"rs","n":"` + b64(key.N.Bytes()) + `","e":"` + b64(big.NewInt(int64(key.E)).Bytes()) + `"}]}`
+	v, err := NewJWTVerifier([]byte(jwks), "", "")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	h, _ := json.Marshal(map[string]any{"alg": "RS256", "kid": "rs"})
+	c, _ := json.Marshal(map[string]any{"sub": "bob", "exp": time.Now().Add(time.Hour).Unix()})
+	signing := b64(h) + "." + b64(c)
+	digest := sha256.Sum256([]byte(signing))
+	sig, err := rsa.SignPKCS1v15(rand.Reader, key, crypto.SHA256, digest[:])
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	claims, _, err := v.Verify(signing + "." + b64(sig))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if claims.Subject != "bob" {
+		t.Errorf("expected bob, got %s", claims.Subject)
+	}
+}
+
+func TestVerify_RejectsAlgorithmMismatch(t *testing.T) {
+	secret := []byte("super-secret-key")
+	jwks := `{"keys":[{"kty":"oct","kid":"hs","k":"` + b64(secret) + `"}]}`
+	v, _ := NewJWTVerifier([]byte(jwks), "", "")
+
+	token := signHS256(t, secret, map[string]any{"alg": "none"}, map[string]any{
+		"sub": "mallory",
+		"exp": time.Now().Add(time.Hour).Unix(),
+	})
+
+	if _, _, err := v.Verify(token); err == nil {
+		t.Fatal("expected error, got nil")
+	}
+}
@@ -0,0 +1,120 @@
+package auth
+
+import (
+	"context"
+	"strings"
+)
+
+// Authentication methods a principal can come from.
+const (
+	MethodAPIKey    = "api_key"
+	MethodJWT       = "jwt"
+	MethodAnonymous = "anonymous"
+)
+
+// Subject prefixes qualify a subject by how the caller authenticated, so a
+// JWT "sub" claim can never be mistaken for an API key.
+const (
+	SubjectPrefixAPIKey = "apikey:"
+	SubjectPrefixJWT    = "jwt:"
+)
+
+// APIKeySubject is the subject of callers using the API key with id.
+func APIKeySubject(id string) string {
+	return SubjectPrefixAPIKey + id
+}
+
+// JWTSubject is the subject of callers presenting a JWT with the sub claim.
+func JWTSubject(sub string) string {
+	return SubjectPrefixJWT + sub
+}
+
+// IsQualifiedSubject reports whether subject carries a method prefix and a
+// non-empty identifier.
+func IsQualifiedSubject(subject string) bool {
+	for _, prefix := range []string{SubjectPrefixAPIKey, SubjectPrefixJWT} {
+		if strings.HasPrefix(subject, prefix) && len(subject) > len(prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+// Built-in role names.
+const (
+	RoleReader       = "reader"
+	RoleEditor       = "editor"
+	RoleSecretReader = "secret-reader"
+	RoleAdmin        = "admin"
+)
+
+// KnownRoles lists the roles credentials may be granted.
+var KnownRoles = []string{RoleReader, RoleEditor, RoleSecretReader, RoleAdmin}
+
+// IsKnownRole reports whether role is one of KnownRoles.
+func IsKnownRole(role string) bool {
+	for _, r := range KnownRoles {
+		if r == role {
+			return true
+		}
+	}
+	return false
+}
+
+// Principal is the authenticated caller of a request.
+type Principal struct {
+	// Subject identifies the caller, qualified by method: "apikey:<key id>"
+	// or "jwt:<sub claim>". Bindings, rate limits and idempotency keys are
+	// scoped by it.
+	Subject string `json:"subject"`
+
+	// Name is the API key name or the JWT "sub" claim, for display.
+	Name string `json:"name,omitempty"`
+
+	// Method is how the caller authenticated.
+	Method string `json:"method"`
+
+	// Roles granted to the caller by its credential.
+	Roles []string `json:"roles"`
+
+	// KeyID is the API key ID or the JWT "kid" used to verify the token.
+	KeyID string `json:"keyId,omitempty"`
+}
+
+// Anonymous is the principal of unauthenticated requests when anonymous
+// access is allowed.
+var Anonymous = &Principal{Subject: "anonymous", Name: "anonymous", Method: MethodAnonymous, Roles: []string{}}
+
+// HasRole reports whether the principal was granted role.
+func (p *Principal) HasRole(role string) bool {
+	if p == nil {
+		return false
+	}
+	for _, r := range p.Roles {
+		if r == role {
+			return true
+		}
+	}
+	return false
+}
+
+type principalKey struct{}
+
+// WithPrincipal returns a copy of ctx carrying p.
+func WithPrincipal(ctx context.Context, p *Principal) context.Context {
+	return context.WithValue(ctx, principalKey{}, p)
+}
+
+// FromContext returns the principal stored by the authentication middleware.
+func FromContext(ctx context.Context) (*Principal, bool) {
+	p, ok := ctx.Value(principalKey{}).(*Principal)
+	return p, ok && p != nil
+}
+
+// SubjectFromContext returns the caller's subject, or "anonymous".
+func SubjectFromContext(ctx context.Context) string {
+	if p, ok := FromContext(ctx); ok {
+		return p.Subject
+	}
+	return Anonymous.Subject
+}
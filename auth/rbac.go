@@ -0,0 +1,163 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"strings"
+)
+
+// ErrForbidden is returned when the caller's grants do not cover an action.
+var ErrForbidden = errors.New("forbidden")
+
+// Permission is an action a role may perform.
+type Permission string
+
+const (
+	PermRead   Permission = "read"
+	PermWrite  Permission = "write"
+	PermAdmin  Permission = "admin"
+	PermReveal Permission = "reveal"
+)
+
+// RolePermissions maps each role to the permissions it carries.
+var RolePermissions = map[string][]Permission{
+	RoleReader:       {PermRead},
+	RoleEditor:       {PermRead, PermWrite},
+	RoleSecretReader: {PermRead, PermReveal},
+	RoleAdmin:        {PermRead, PermWrite, PermAdmin, PermReveal},
+}
+
+// Resource kinds checked by Grant.Allows.
+const (
+	KindConfig = "config"
+	KindGroup  = "group"
+	KindSystem = "system"
+)
+
+// Resource is what a request acts on.
+type Resource struct {
+	Kind string
+	Name string
+
+	// Labels of the labeled configuration inside a group, if known.
+	Labels map[string]string
+
+	// Membership marks group requests whose labels are only known deeper in
+	// the stack. Label-scoped grants pass here and are enforced by the service.
+	Membership bool
+}
+
+// Grant is a role applied to a scope. A grant with no scope is global.
+// ConfigPrefix scopes it to configurations; Group (a name or "*") scopes it
+// to groups and, with Labels, to labeled configurations inside them.
+type Grant struct {
+	Role         string            `json:"role"`
+	ConfigPrefix string            `json:"configPrefix,omitempty"`
+	Group        string            `json:"group,omitempty"`
+	Labels       map[string]string `json:"labels,omitempty"`
+}
+
+// Global reports whether the grant has no scope.
+func (g Grant) Global() bool {
+	return g.ConfigPrefix == "" && g.Group == "" && len(g.Labels) == 0
+}
+
+// Permissions returns what the grant's role may do.
+func (g Grant) Permissions() []Permission {
+	return RolePermissions[g.Role]
+}
+
+func (g Grant) has(perm Permission) bool {
+	for _, p := range RolePermissions[g.Role] {
+		if p == perm {
+			return true
+		}
+	}
+	return false
+}
+
+// Allows reports whether the grant permits perm on res.
+func (g Grant) Allows(perm Permission, res Resource) bool {
+	if !g.has(perm) {
+		return false
+	}
+	if g.Global() {
+		return true
+	}
+
+	switch res.Kind {
+	case KindConfig:
+		return g.ConfigPrefix != "" && strings.HasPrefix(res.Name, g.ConfigPrefix)
+	case KindGroup:
+		if g.Group == "" || (g.Group != "*" && g.Group != res.Name) {
+			return false
+		}
+		if len(g.Labels) == 0 {
+			return true
+		}
+		if res.Labels == nil {
+			return res.Membership
+		}
+		for k, v := range g.Labels {
+			if res.Labels[k] != v {
+				return false
+			}
+		}
+		return true
+	default:
+		return false
+	}
+}
+
+// Grants is the effective set of grants of a principal.
+type Grants []Grant
+
+// Allows reports whether any grant permits perm on res.
+func (gs Grants) Allows(perm Permission, res Resource) bool {
+	for _, g := range gs {
+		if g.Allows(perm, res) {
+			return true
+		}
+	}
+	return false
+}
+
+// AllowsKind reports whether perm is granted on at least some resource of
+// kind. It is used before the exact resource is known, e.g. for creates
+// whose name is in the request body.
+func (gs Grants) AllowsKind(perm Permission, kind string) bool {
+	for _, g := range gs {
+		if !g.has(perm) {
+			continue
+		}
+		if g.Global() ||
+			(kind == KindConfig && g.ConfigPrefix != "") ||
+			(kind == KindGroup && g.Group != "") {
+			return true
+		}
+	}
+	return false
+}
+
+type grantsKey struct{}
+
+// WithGrants returns a copy of ctx carrying the caller's effective grants.
+func WithGrants(ctx context.Context, gs Grants) context.Context {
+	return context.WithValue(ctx, grantsKey{}, gs)
+}
+
+// GrantsFromContext returns the grants stored by the authorization
+// middleware, or none.
+func GrantsFromContext(ctx context.Context) Grants {
+	gs, _ := ctx.Value(grantsKey{}).(Grants)
+	return gs
+}
+
+// Authorize checks perm on res against the grants in ctx. A context without
+// grants is denied.
+func Authorize(ctx context.Context, perm Permission, res Resource) error {
+	if !GrantsFromContext(ctx).Allows(perm, res) {
+		return ErrForbidden
+	}
+	return nil
+}
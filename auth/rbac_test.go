@@ -0,0 +1,47 @@
+package auth
+
+import (
+	"context"
+	"testing"
+)
+
+func TestGrantAllows_ConfigPrefix(t *testing.T) {
+	g := Grant{Role: RoleEditor, ConfigPrefix: "payments-"}
+
+	if !g.Allows(PermWrite, Resource{Kind: KindConfig, Name: "payments-db"}) {
+		t.Error("expected write on payments-db to be allowed")
+	}
+	if g.Allows(PermWrite, Resource{Kind: KindConfig, Name: "orders-db"}) {
+		t.Error("expected write on orders-db to be denied")
+	}
+	if g.Allows(PermWrite, Resource{Kind: KindGroup, Name: "backend"}) {
+		t.Error("expected config-scoped grant not to cover groups")
+	}
+}
+
+func TestGrantAllows_LabelScope(t *testing.T) {
+	g := Grant{Role: RoleEditor, Group: "*", Labels: map[string]string{"env": "staging"}}
+
+	staging := Resource{Kind: KindGroup, Name: "backend", Labels: map[string]string{"env": "staging"}}
+	prod := Resource{Kind: KindGroup, Name: "backend", Labels: map[string]string{"env": "prod"}}
+
+	if !g.Allows(PermWrite, staging) {
+		t.Error("expected staging config to be writable")
+	}
+	if g.Allows(PermWrite, prod) {
+		t.Error("expected prod config to be denied")
+	}
+	if g.Allows(PermWrite, Resource{Kind: KindGroup, Name: "backend"}) {
+		t.Error("expected whole-group write to be denied for a label-scoped grant")
+	}
+	if !g.Allows(PermWrite, Resource{Kind: KindGroup, Name: "backend", Membership: true}) {
+		t.Error("expected membership request to be deferred to the service")
+	}
+}
+
+func TestAuthorize_NoGrants(t *testing.T) {
+	err := Authorize(context.Background(), PermRead, Resource{Kind: KindConfig, Name: "db"})
+	if err != ErrForbidden {
+		t.Fatalf("expected ErrForbidden, got %v", err)
+	}
+}
@@ -0,0 +1,118 @@
+package consulkv
+
+import (
+	"errors"
+	"strings"
+
+	"github.com/hashicorp/consul/api"
+)
+
+// Config describes how to reach Consul.
+type Config struct {
+	Address    string
+	Datacenter string
+
+	// Token is the ACL token; TokenFile, if set instead, is read once when
+	// the client is created.
+	Token     string
+	TokenFile string
+
+	// TLS is used when CAFile or a client certificate is set, or when
+	// UseTLS is true. CertFile and KeyFile enable mutual TLS.
+	UseTLS        bool
+	CAFile        string
+	CertFile      string
+	KeyFile       string
+	TLSServerName string
+
+	// KeyPrefix is prepended to every key, so several deployments can share
+	// one cluster. Repositories never see it.
+	KeyPrefix string
+
+	Resilience Resilience
+}
+
+// Validate rejects settings that can not work together.
+func (c Config) Validate() error {
+	var errs []error
+	if c.Address == "" {
+		errs = append(errs, errors.New("consul: address is required"))
+	}
+	if c.Token != "" && c.TokenFile != "" {
+		errs = append(errs, errors.New("consul: set either a token or a token file, not both"))
+	}
+	if (c.CertFile == "") != (c.KeyFile == "") {
+		errs = append(errs, errors.New("consul: client certificate and key must be set together"))
+	}
+	return errors.Join(errs...)
+}
+
+func (c Config) tls() bool {
+	return c.UseTLS || c.CAFile != "" || c.CertFile != ""
+}
+
+// normalizePrefix turns "/team-a/prod" into "team-a/prod/".
+func normalizePrefix(p string) string {
+	p = strings.Trim(p, "/")
+	if p == "" {
+		return ""
+	}
+	return p + "/"
+}
+
+// Client is the one Consul client of the process, shared by all
+// repositories.
+type Client struct {
+	api *api.Client
+	kv  *KV
+}
+
+// NewClient creates the client described by cfg. Settings not in cfg keep
+// the defaults of the Consul API, which include its CONSUL_* variables.
+func NewClient(cfg Config) (*Client, error) {
+	if err := cfg.Validate(); err != nil {
+		return nil, err
+	}
+
+	apiCfg := api.DefaultConfig()
+	apiCfg.Address = cfg.Address
+	if cfg.Datacenter != "" {
+		apiCfg.Datacenter = cfg.Datacenter
+	}
+	if cfg.Token != "" {
+		apiCfg.Token = cfg.Token
+	}
+	if cfg.TokenFile != "" {
+		apiCfg.TokenFile = cfg.TokenFile
+	}
+	if cfg.tls() {
+		apiCfg.Scheme = "https"
+		apiCfg.TLSConfig = api.TLSConfig{
+			Address:  cfg.TLSServerName,
+			CAFile:   cfg.CAFile,
+			CertFile: cfg.CertFile,
+			KeyFile:  cfg.KeyFile,
+		}
+	}
+
+	client, err := api.NewClient(apiCfg)
+	if err != nil {
+		return nil, err
+	}
+
+	kv := &KV{kv: client.KV(), prefix: normalizePrefix(cfg.KeyPrefix), res: cfg.Resilience}
+	if cfg.Resilience.BreakerFailures > 0 {
+		kv.breaker = newBreaker(cfg.Resilience.BreakerFailures, cfg.Resilience.BreakerCooldown)
+	}
+	return &Client{api: client, kv: kv}, nil
+}
+
+// KV returns the instrumented, prefixed KV client.
+func (c *Client) KV() *KV {
+	return c.kv
+}
+
+// API returns the underlying client for non-KV endpoints such as Status.
+func (c *Client) API() *api.Client {
+	return c.api
+}
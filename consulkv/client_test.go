@@ -0,0 +1,82 @@
+package consulkv
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/hashicorp/consul/api"
+)
+
+func TestNormalizePrefix(t *testing.T) {
+	cases := map[string]string{
+		"":             "",
+		"/":            "",
+		"team-a":       "team-a/",
+		"/team-a/prod": "team-a/prod/",
+	}
+	for in, want := range cases {
+		if got := normalizePrefix(in); got != want {
+			t.Errorf("normalizePrefix(%q) = %q, want %q", in, got, want)
+		}
+	}
+}
+
+func TestConfigValidate(t *testing.T) {
+	if err := (Config{Address: "consul:8500"}).Validate(); err != nil {
+		t.Fatalf("valid config rejected: %v", err)
+	}
+	bad := []Config{
+		{},
+		{Address: "consul:8500", Token: "t", TokenFile: "/run/token"},
+		{Address: "consul:8500", CertFile: "client.pem"},
+	}
+	for _, c := range bad {
+		if err := c.Validate(); err == nil {
+			t.Errorf("expected error for %+v", c)
+		}
+	}
+}
+
+func TestKeyPrefix(t *testing.T) {
+	var paths []string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		paths = append(paths, r.Method+" "+r.URL.Path)
+		switch r.Method {
+		case http.MethodPut:
+			_, _ = w.Write([]byte("true"))
+		case http.MethodGet:
+			w.Header().Set("Content-Type", "application/json")
+			_, _ = w.Write([]byte(`[{"Key":"team-a/configs/db/v1","Value":"e30="}]`))
+		}
+	}))
+	defer srv.Close()
+
+	client, err := NewClient(Config{Address: strings.TrimPrefix(srv.URL, "http://"), KeyPrefix: "/team-a/"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	kv := client.KV()
+
+	pair := &api.KVPair{Key: "configs/db/v1", Value: []byte("{}")}
+	if _, err := kv.Put(pair, nil); err != nil {
+		t.Fatal(err)
+	}
+	if pair.Key != "configs/db/v1" {
+		t.Fatalf("Put changed the caller's key to %q", pair.Key)
+	}
+
+	got, _, err := kv.Get("configs/db/v1", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got == nil || got.Key != "configs/db/v1" {
+		t.Fatalf("Get returned %+v, want the key without prefix", got)
+	}
+
+	want := []string{"PUT /v1/kv/team-a/configs/db/v1", "GET /v1/kv/team-a/configs/db/v1"}
+	if strings.Join(paths, ",") != strings.Join(want, ",") {
+		t.Fatalf("requests = %v, want %v", paths, want)
+	}
+}
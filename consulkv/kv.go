@@ -0,0 +1,209 @@
+// Package consulkv creates the shared Consul client and wraps its KV API
+// with Prometheus metrics and a key prefix. KV has the same methods as
+// *api.KV, so repositories use it unchanged.
+package consulkv
+
+import (
+	"context"
+	"log/slog"
+	"strings"
+	"time"
+
+	"github.com/anjaobradovic/ars-sit-2025/metrics"
+	"github.com/hashicorp/consul/api"
+)
+
+// KV is an instrumented *api.KV. Every call is timed and failures are
+// counted, labeled by operation and the first segment of the key. Calls get
+// the timeouts, read retries and circuit breaker of its Resilience.
+//
+// Keys are relative to the client's key prefix: it is added to every key
+// sent and stripped from every key returned.
+type KV struct {
+	kv      *api.KV
+	prefix  string
+	res     Resilience
+	breaker *breaker
+}
+
+func (k *KV) strip(pair *api.KVPair) {
+	if pair != nil {
+		pair.Key = strings.TrimPrefix(pair.Key, k.prefix)
+	}
+}
+
+// prefixed returns a copy of p with the prefix added, leaving the caller's
+// pair relative.
+func (k *KV) prefixed(p *api.KVPair) *api.KVPair {
+	cp := *p
+	cp.Key = k.prefix + p.Key
+	return &cp
+}
+
+// keyPrefix keeps label cardinality bounded: "configs/db/v1" -> "configs".
+func keyPrefix(key string) string {
+	if i := strings.IndexByte(key, '/'); i >= 0 {
+		return key[:i]
+	}
+	if key == "" {
+		return "root"
+	}
+	return key
+}
+
+// observe records one call. Any error means Consul could not be reached or
+// refused the call; a lost CAS is not an error.
+func observe(op, key string, start time.Time, err error) {
+	prefix := keyPrefix(key)
+	metrics.ConsulKVDuration.WithLabelValues(op, prefix).Observe(time.Since(start).Seconds())
+	if err != nil {
+		metrics.ConsulKVErrorsTotal.WithLabelValues(op, prefix).Inc()
+		metrics.ConsulUp.Set(0)
+		return
+	}
+	metrics.ConsulUp.Set(1)
+}
+
+// queryOptions returns the caller's context and a function giving a copy
+// of q bound to another context.
+func queryOptions(q *api.QueryOptions) (context.Context, func(context.Context) *api.QueryOptions) {
+	if q == nil {
+		q = &api.QueryOptions{}
+	}
+	return q.Context(), q.WithContext
+}
+
+func writeOptions(w *api.WriteOptions) (context.Context, func(context.Context) *api.WriteOptions) {
+	if w == nil {
+		w = &api.WriteOptions{}
+	}
+	return w.Context(), w.WithContext
+}
+
+func (k *KV) Get(key string, q *api.QueryOptions) (pair *api.KVPair, meta *api.QueryMeta, err error) {
+	ctx, opts := queryOptions(q)
+	o := callOptions{read: true, blocking: q != nil && q.WaitIndex > 0}
+	err = k.call(ctx, "get", key, o, func(ctx context.Context) (err error) {
+		pair, meta, err = k.kv.Get(k.prefix+key, opts(ctx))
+		return err
+	})
+	k.strip(pair)
+	return pair, meta, err
+}
+
+func (k *KV) List(prefix string, q *api.QueryOptions) (pairs api.KVPairs, meta *api.QueryMeta, err error) {
+	ctx, opts := queryOptions(q)
+	err = k.call(ctx, "list", prefix, callOptions{read: true}, func(ctx context.Context) (err error) {
+		pairs, meta, err = k.kv.List(k.prefix+prefix, opts(ctx))
+		return err
+	})
+	for _, pair := range pairs {
+		k.strip(pair)
+	}
+	return pairs, meta, err
+}
+
+func (k *KV) Keys(prefix, separator string, q *api.QueryOptions) (keys []string, meta *api.QueryMeta, err error) {
+	ctx, opts := queryOptions(q)
+	err = k.call(ctx, "keys", prefix, callOptions{read: true}, func(ctx context.Context) (err error) {
+		keys, meta, err = k.kv.Keys(k.prefix+prefix, separator, opts(ctx))
+		return err
+	})
+	for i := range keys {
+		keys[i] = strings.TrimPrefix(keys[i], k.prefix)
+	}
+	return keys, meta, err
+}
+
+func (k *KV) Put(p *api.KVPair, w *api.WriteOptions) (meta *api.WriteMeta, err error) {
+	ctx, opts := writeOptions(w)
+	err = k.call(ctx, "put", p.Key, callOptions{}, func(ctx context.Context) (err error) {
+		meta, err = k.kv.Put(k.prefixed(p), opts(ctx))
+		return err
+	})
+	return meta, err
+}
+
+func (k *KV) CAS(p *api.KVPair, w *api.WriteOptions) (ok bool, meta *api.WriteMeta, err error) {
+	ctx, opts := writeOptions(w)
+	err = k.call(ctx, "cas", p.Key, callOptions{}, func(ctx context.Context) (err error) {
+		ok, meta, err = k.kv.CAS(k.prefixed(p), opts(ctx))
+		return err
+	})
+	return ok, meta, err
+}
+
+func (k *KV) Delete(key string, w *api.WriteOptions) (meta *api.WriteMeta, err error) {
+	ctx, opts := writeOptions(w)
+	err = k.call(ctx, "delete", key, callOptions{}, func(ctx context.Context) (err error) {
+		meta, err = k.kv.Delete(k.prefix+key, opts(ctx))
+		return err
+	})
+	return meta, err
+}
+
+func (k *KV) DeleteCAS(p *api.KVPair, w *api.WriteOptions) (ok bool, meta *api.WriteMeta, err error) {
+	ctx, opts := writeOptions(w)
+	err = k.call(ctx, "delete", p.Key, callOptions{}, func(ctx context.Context) (err error) {
+		ok, meta, err = k.kv.DeleteCAS(k.prefixed(p), opts(ctx))
+		return err
+	})
+	return ok, meta, err
+}
+
+func (k *KV) DeleteTree(prefix string, w *api.WriteOptions) (meta *api.WriteMeta, err error) {
+	ctx, opts := writeOptions(w)
+	err = k.call(ctx, "delete", prefix, callOptions{}, func(ctx context.Context) (err error) {
+		meta, err = k.kv.DeleteTree(k.prefix+prefix, opts(ctx))
+		return err
+	})
+	return meta, err
+}
+
+// Txn is labeled with the prefix of its first operation. It is never
+// retried, even when it only reads.
+func (k *KV) Txn(txn api.KVTxnOps, q *api.QueryOptions) (ok bool, resp *api.KVTxnResponse, meta *api.QueryMeta, err error) {
+	key := ""
+	if len(txn) > 0 {
+		key = txn[0].Key
+	}
+	ops := make(api.KVTxnOps, len(txn))
+	for i, op := range txn {
+		cp := *op
+		cp.Key = k.prefix + op.Key
+		ops[i] = &cp
+	}
+	ctx, opts := queryOptions(q)
+	err = k.call(ctx, "txn", key, callOptions{}, func(ctx context.Context) (err error) {
+		ok, resp, meta, err = k.kv.Txn(ops, opts(ctx))
+		return err
+	})
+	if resp != nil {
+		for _, pair := range resp.Results {
+			k.strip(pair)
+		}
+	}
+	return ok, resp, meta, err
+}
+
+// MonitorReachability asks Consul for its leader every interval, so the
+// reachability gauge is current even when no requests come in.
+func MonitorReachability(ctx context.Context, client *Client, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		if _, err := client.API().Status().Leader(); err != nil {
+			slog.WarnContext(ctx, "consul: unreachable", "error", err)
+			metrics.ConsulUp.Set(0)
+		} else {
+			metrics.ConsulUp.Set(1)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
@@ -0,0 +1,269 @@
+package consulkv
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"math/rand/v2"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/anjaobradovic/ars-sit-2025/metrics"
+	"github.com/hashicorp/consul/api"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// ErrUnavailable marks calls that failed because Consul could not serve
+// them: it was unreachable, timed out or answered with a server error, or
+// the circuit breaker is open. Handlers answer these with 503.
+var ErrUnavailable = errors.New("consul unavailable")
+
+// CircuitOpenError is returned without calling Consul while the breaker is
+// open. It matches ErrUnavailable.
+type CircuitOpenError struct {
+	// RetryAfter is how long until the breaker lets a call through again.
+	RetryAfter time.Duration
+}
+
+func (e *CircuitOpenError) Error() string {
+	return "consul unavailable: circuit breaker open"
+}
+
+func (e *CircuitOpenError) Is(target error) bool {
+	return target == ErrUnavailable
+}
+
+// Resilience controls timeouts, retries and circuit breaking of KV calls.
+// Zero values disable the corresponding mechanism.
+type Resilience struct {
+	// CallTimeout bounds every call except blocking queries.
+	CallTimeout time.Duration
+	// ReadRetries is how many times an idempotent read is retried after a
+	// transient failure. Writes are never retried.
+	ReadRetries int
+	// RetryBaseDelay is the first backoff; it doubles per retry up to
+	// RetryMaxDelay, with full jitter.
+	RetryBaseDelay time.Duration
+	RetryMaxDelay  time.Duration
+	// BreakerFailures consecutive failures open the breaker; it lets a
+	// trial call through after BreakerCooldown.
+	BreakerFailures int
+	BreakerCooldown time.Duration
+}
+
+// backoff returns the delay before retry number attempt (starting at 1).
+func (r Resilience) backoff(attempt int) time.Duration {
+	d := r.RetryBaseDelay << (attempt - 1)
+	if r.RetryMaxDelay > 0 && (d > r.RetryMaxDelay || d <= 0) {
+		d = r.RetryMaxDelay
+	}
+	if d <= 0 {
+		return 0
+	}
+	return rand.N(d) + 1
+}
+
+// transient reports whether err may go away on retry. A caller that gave up
+// is not a Consul failure, and 4xx answers are not transient.
+func transient(ctx context.Context, err error) bool {
+	if ctx.Err() != nil {
+		return false
+	}
+	var status api.StatusError
+	if errors.As(err, &status) {
+		return status.Code >= http.StatusInternalServerError || status.Code == http.StatusTooManyRequests
+	}
+	return true
+}
+
+type breakerState int
+
+const (
+	breakerClosed breakerState = iota
+	breakerHalfOpen
+	breakerOpen
+)
+
+func (s breakerState) String() string {
+	switch s {
+	case breakerHalfOpen:
+		return "half_open"
+	case breakerOpen:
+		return "open"
+	}
+	return "closed"
+}
+
+// breaker is a consecutive-failure circuit breaker. While open it fails
+// calls fast; after the cooldown one trial call decides whether it closes.
+// Every state change starts a new generation, and results of calls admitted
+// in an older generation are ignored.
+type breaker struct {
+	failures int
+	cooldown time.Duration
+
+	mu       sync.Mutex
+	state    breakerState
+	gen      uint64
+	failed   int
+	openedAt time.Time
+	trial    bool
+	now      func() time.Time
+}
+
+// ticket is handed to an admitted call and given back to record.
+type ticket struct {
+	gen   uint64
+	trial bool
+}
+
+func newBreaker(failures int, cooldown time.Duration) *breaker {
+	return &breaker{failures: failures, cooldown: cooldown, now: time.Now}
+}
+
+// allow admits a call or returns a *CircuitOpenError. Blocking queries are
+// only admitted while the breaker is closed: they may wait for minutes, so
+// they must never hold the half-open trial.
+func (b *breaker) allow(ctx context.Context, blocking bool) (ticket, error) {
+	if b == nil {
+		return ticket{}, nil
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	switch b.state {
+	case breakerOpen:
+		wait := b.openedAt.Add(b.cooldown).Sub(b.now())
+		if wait > 0 {
+			return ticket{}, &CircuitOpenError{RetryAfter: wait}
+		}
+		b.transition(ctx, breakerHalfOpen)
+		fallthrough
+	case breakerHalfOpen:
+		if blocking || b.trial {
+			// One short trial call at a time
+			return ticket{}, &CircuitOpenError{RetryAfter: b.cooldown}
+		}
+		b.trial = true
+		return ticket{gen: b.gen, trial: true}, nil
+	}
+	return ticket{gen: b.gen}, nil
+}
+
+// record reports the outcome of an admitted call: failed for transient
+// failures, neither for calls abandoned by the caller.
+func (b *breaker) record(ctx context.Context, t ticket, failed, abandoned bool) {
+	if b == nil {
+		return
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if t.gen != b.gen {
+		// Admitted before the last state change; says nothing about now
+		return
+	}
+	if t.trial {
+		b.trial = false
+	}
+	switch {
+	case abandoned:
+	case failed:
+		b.failed++
+		if t.trial || (b.state == breakerClosed && b.failed >= b.failures) {
+			b.openedAt = b.now()
+			b.transition(ctx, breakerOpen)
+		}
+	default:
+		b.failed = 0
+		if b.state != breakerClosed {
+			b.transition(ctx, breakerClosed)
+		}
+	}
+}
+
+// transition is called with b.mu held.
+func (b *breaker) transition(ctx context.Context, to breakerState) {
+	from := b.state
+	b.state = to
+	b.gen++
+	b.trial = false
+
+	metrics.ConsulCircuitState.Set(float64(to))
+	metrics.ConsulCircuitTransitionsTotal.WithLabelValues(to.String()).Inc()
+	trace.SpanFromContext(ctx).AddEvent("consul.circuit_breaker", trace.WithAttributes(
+		attribute.String("consul.breaker.from", from.String()),
+		attribute.String("consul.breaker.to", to.String()),
+	))
+	if to == breakerOpen {
+		slog.WarnContext(ctx, "consul: circuit breaker opened", "from", from.String(), "cooldown", b.cooldown)
+	} else {
+		slog.InfoContext(ctx, "consul: circuit breaker state changed", "from", from.String(), "to", to.String())
+	}
+}
+
+// callOptions describe one KV call.
+type callOptions struct {
+	// read calls are idempotent and may be retried.
+	read bool
+	// blocking queries wait on purpose; they get no timeout and are not
+	// timed.
+	blocking bool
+}
+
+// call runs fn under the breaker and the call timeout, retrying transient
+// failures of reads with backoff. fn gets the context to issue the call with.
+func (k *KV) call(ctx context.Context, op, key string, o callOptions, fn func(ctx context.Context) error) error {
+	attempts := 1
+	if o.read {
+		attempts += k.res.ReadRetries
+	}
+
+	var err error
+	for attempt := 0; attempt < attempts; attempt++ {
+		if attempt > 0 {
+			metrics.ConsulKVRetriesTotal.WithLabelValues(op, keyPrefix(key)).Inc()
+			trace.SpanFromContext(ctx).AddEvent("consul.retry", trace.WithAttributes(
+				attribute.String("consul.operation", op),
+				attribute.Int("consul.attempt", attempt+1),
+				attribute.String("consul.error", err.Error()),
+			))
+			select {
+			case <-ctx.Done():
+				return err
+			case <-time.After(k.res.backoff(attempt)):
+			}
+		}
+
+		t, open := k.breaker.allow(ctx, o.blocking)
+		if open != nil {
+			return open
+		}
+
+		callCtx, cancel := ctx, context.CancelFunc(func() {})
+		if k.res.CallTimeout > 0 && !o.blocking {
+			callCtx, cancel = context.WithTimeout(ctx, k.res.CallTimeout)
+		}
+		start := time.Now()
+		err = fn(callCtx)
+		cancel()
+		if !o.blocking {
+			observe(op, key, start, err)
+		}
+
+		if err == nil {
+			k.breaker.record(ctx, t, false, false)
+			return nil
+		}
+		if !transient(ctx, err) {
+			k.breaker.record(ctx, t, false, ctx.Err() != nil)
+			return err
+		}
+		k.breaker.record(ctx, t, true, false)
+	}
+	return fmt.Errorf("%w: %w", ErrUnavailable, err)
+}
@@ -0,0 +1,169 @@
+package consulkv
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/hashicorp/consul/api"
+)
+
+func TestBreakerTransitions(t *testing.T) {
+	ctx := context.Background()
+	now := time.Unix(0, 0)
+	b := newBreaker(2, 10*time.Second)
+	b.now = func() time.Time { return now }
+
+	for i := 0; i < 2; i++ {
+		tk, err := b.allow(ctx, false)
+		if err != nil {
+			t.Fatalf("closed breaker rejected call %d: %v", i, err)
+		}
+		b.record(ctx, tk, true, false)
+	}
+	if b.state != breakerOpen {
+		t.Fatalf("state = %s after 2 failures, want open", b.state)
+	}
+
+	now = now.Add(4 * time.Second)
+	var open *CircuitOpenError
+	if _, err := b.allow(ctx, false); !errors.As(err, &open) || open.RetryAfter != 6*time.Second {
+		t.Fatalf("open breaker allowed call or wrong RetryAfter: %v", err)
+	}
+	if _, err := b.allow(ctx, false); !errors.Is(err, ErrUnavailable) {
+		t.Fatalf("CircuitOpenError does not match ErrUnavailable: %v", err)
+	}
+
+	// After the cooldown one trial call goes through; a failure reopens.
+	now = now.Add(6 * time.Second)
+	trial, err := b.allow(ctx, false)
+	if err != nil {
+		t.Fatalf("trial call rejected: %v", err)
+	}
+	if _, err := b.allow(ctx, false); err == nil {
+		t.Fatal("second call allowed during the trial")
+	}
+	b.record(ctx, trial, true, false)
+	if b.state != breakerOpen {
+		t.Fatalf("state = %s after failed trial, want open", b.state)
+	}
+
+	// A successful trial closes it; an abandoned call changes nothing.
+	now = now.Add(10 * time.Second)
+	trial, err = b.allow(ctx, false)
+	if err != nil {
+		t.Fatalf("trial call rejected: %v", err)
+	}
+	b.record(ctx, trial, false, false)
+	if b.state != breakerClosed {
+		t.Fatalf("state = %s after successful trial, want closed", b.state)
+	}
+	tk, _ := b.allow(ctx, false)
+	b.record(ctx, tk, false, true)
+	b.record(ctx, tk, true, false)
+	if b.state != breakerClosed || b.failed != 1 {
+		t.Fatalf("state = %s, failed = %d, want closed with 1 failure", b.state, b.failed)
+	}
+}
+
+func TestBreakerLongPollNeverHoldsTrial(t *testing.T) {
+	ctx := context.Background()
+	now := time.Unix(0, 0)
+	b := newBreaker(1, 10*time.Second)
+	b.now = func() time.Time { return now }
+
+	// A long-poll admitted while closed is still waiting when the breaker
+	// opens and goes half-open.
+	poll, err := b.allow(ctx, true)
+	if err != nil {
+		t.Fatalf("closed breaker rejected long-poll: %v", err)
+	}
+	tk, _ := b.allow(ctx, false)
+	b.record(ctx, tk, true, false)
+	now = now.Add(10 * time.Second)
+
+	if _, err := b.allow(ctx, true); err == nil {
+		t.Fatal("long-poll admitted while half-open")
+	}
+	trial, err := b.allow(ctx, false)
+	if err != nil {
+		t.Fatalf("short call could not take the trial: %v", err)
+	}
+
+	// The old long-poll finishing is not the trial's result
+	b.record(ctx, poll, true, false)
+	if b.state != breakerHalfOpen || !b.trial {
+		t.Fatalf("stale result changed the breaker: state = %s, trial = %v", b.state, b.trial)
+	}
+
+	b.record(ctx, trial, false, false)
+	if b.state != breakerClosed {
+		t.Fatalf("state = %s after successful trial, want closed", b.state)
+	}
+	if _, err := b.allow(ctx, true); err != nil {
+		t.Fatalf("closed breaker rejected long-poll: %v", err)
+	}
+}
+
+// failingKV answers every request with status.
+func failingKV(t *testing.T, status int, res Resilience) (*KV, *atomic.Int32) {
+	t.Helper()
+	var calls atomic.Int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls.Add(1)
+		http.Error(w, "failed", status)
+	}))
+	t.Cleanup(srv.Close)
+
+	client, err := NewClient(Config{Address: strings.TrimPrefix(srv.URL, "http://"), Resilience: res})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return client.KV(), &calls
+}
+
+func TestRetriesReadsOnly(t *testing.T) {
+	kv, calls := failingKV(t, http.StatusInternalServerError, Resilience{
+		ReadRetries:    2,
+		RetryBaseDelay: time.Millisecond,
+		RetryMaxDelay:  time.Millisecond,
+	})
+
+	if _, _, err := kv.Get("configs/db/v1", nil); !errors.Is(err, ErrUnavailable) {
+		t.Fatalf("Get error = %v, want ErrUnavailable", err)
+	}
+	if n := calls.Swap(0); n != 3 {
+		t.Fatalf("Get made %d requests, want 3", n)
+	}
+
+	if _, err := kv.Put(&api.KVPair{Key: "configs/db/v1"}, nil); !errors.Is(err, ErrUnavailable) {
+		t.Fatalf("Put error = %v, want ErrUnavailable", err)
+	}
+	if n := calls.Load(); n != 1 {
+		t.Fatalf("Put made %d requests, want 1", n)
+	}
+}
+
+func TestClientErrorsAreNotRetried(t *testing.T) {
+	kv, calls := failingKV(t, http.StatusForbidden, Resilience{
+		ReadRetries:     2,
+		RetryBaseDelay:  time.Millisecond,
+		BreakerFailures: 1,
+		BreakerCooldown: time.Minute,
+	})
+
+	for i := 0; i < 2; i++ {
+		_, _, err := kv.Get("configs/db/v1", nil)
+		if err == nil || errors.Is(err, ErrUnavailable) {
+			t.Fatalf("Get error = %v, want a plain 403", err)
+		}
+	}
+	if n := calls.Load(); n != 2 {
+		t.Fatalf("made %d requests, want 2 (no retries, breaker closed)", n)
+	}
+}
@@ -1,5 +1,7 @@
 package dtos
 
+import "github.com/anjaobradovic/ars-sit-2025/model"
+
 // ConfigurationGroupConfigurationDto represents a configuration reference in a group
 // swagger:model ConfigurationGroupConfigurationDto
 type ConfigurationGroupConfigurationDto struct {
@@ -43,3 +45,65 @@ type ConfigurationGroupDto struct {
 	// minItems: 1
 	ConfigurationList []*ConfigurationGroupConfigurationDto `json:"configuration_list"`
 }
+
+// CreateWebhookDto represents the request body for registering a webhook subscription
+// swagger:model CreateWebhookDto
+type CreateWebhookDto struct {
+	// Receiver URL, events are POSTed here
+	// example: https://hooks.example.com/config-events
+	URL string `json:"url"`
+
+	// Shared secret used to sign payloads, generated when empty
+	// example: s3cr3t
+	Secret string `json:"secret"`
+
+	// Event types to deliver, empty means all
+	// example: ["config.created","group.config.added"]
+	EventTypes []model.WebhookEventType `json:"eventTypes"`
+
+	// Only deliver events for configurations whose name starts with this prefix
+	// example: database-
+	NamePrefix string `json:"namePrefix"`
+
+	// Only deliver group events whose labels contain all of these; not
+	// allowed together with config event types
+	// example: {"env":"prod"}
+	Labels map[string]string `json:"labels"`
+}
+
+// CreateAPIKeyDto represents the request body for issuing an API key
+// swagger:model CreateAPIKeyDto
+type CreateAPIKeyDto struct {
+	// Unique human readable name
+	// example: ci-pipeline
+	Name string `json:"name"`
+
+	// Roles granted to callers using this key
+	// example: ["editor"]
+	Roles []string `json:"roles"`
+}
+
+// CreateRoleBindingDto represents the request body for creating a role binding
+// swagger:model CreateRoleBindingDto
+type CreateRoleBindingDto struct {
+	// Qualified principal subject, "apikey:<key id>" or "jwt:<sub>", or "*"
+	// for every caller
+	// example: apikey:3c6e0b8a-9c0a-4f1e-8b1e-2f6d1a7c5e90
+	Subject string `json:"subject"`
+
+	// Role granted: reader, editor, secret-reader or admin
+	// example: editor
+	Role string `json:"role"`
+
+	// Limit to configurations whose name starts with this prefix
+	// example: payments-
+	ConfigPrefix string `json:"configPrefix"`
+
+	// Limit to this group, "*" for every group
+	// example: backend-group
+	Group string `json:"group"`
+
+	// Limit a group binding to labeled configurations carrying these labels
+	// example: {"env":"staging"}
+	Labels map[string]string `json:"labels"`
+}
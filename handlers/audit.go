@@ -0,0 +1,161 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/anjaobradovic/ars-sit-2025/auth"
+	"github.com/anjaobradovic/ars-sit-2025/logging"
+	"github.com/anjaobradovic/ars-sit-2025/middleware"
+	"github.com/anjaobradovic/ars-sit-2025/model"
+	"github.com/anjaobradovic/ars-sit-2025/services"
+)
+
+type AuditHandler struct {
+	service *services.AuditService
+}
+
+func NewAuditHandler(service *services.AuditService) *AuditHandler {
+	return &AuditHandler{service: service}
+}
+
+// recordAudit writes one audit entry for a successful mutation. before and
+// after are the resource states around it; nil means absent.
+func recordAudit(audit *services.AuditService, r *http.Request, action model.AuditAction, target string, before, after any) {
+	audit.Record(r.Context(), model.AuditEntry{
+		Actor:      auditActor(r),
+		Action:     action,
+		Target:     target,
+		BeforeHash: services.AuditHash(before),
+		AfterHash:  services.AuditHash(after),
+		RequestID:  logging.RequestIDFromContext(r.Context()),
+		ClientIP:   middleware.ClientIPFromContext(r.Context()),
+	})
+}
+
+// auditActor identifies the caller by its authenticated principal.
+func auditActor(r *http.Request) string {
+	return auth.SubjectFromContext(r.Context())
+}
+
+// Page size of GET /audit when no limit is given, and the largest allowed.
+const (
+	defaultAuditLimit = 100
+	maxAuditLimit     = 1000
+)
+
+// NextCursorHeader carries the cursor of the next page of a listing.
+const NextCursorHeader = "X-Next-Cursor"
+
+func parseAuditFilter(r *http.Request) (model.AuditFilter, error) {
+	q := r.URL.Query()
+	filter := model.AuditFilter{
+		Target: q.Get("target"),
+		Actor:  q.Get("actor"),
+		After:  q.Get("cursor"),
+	}
+	if raw := q.Get("since"); raw != "" {
+		since, err := time.Parse(time.RFC3339, raw)
+		if err != nil {
+			return filter, errors.New("invalid since, expected RFC3339 timestamp")
+		}
+		filter.Since = since
+	}
+	return filter, nil
+}
+
+// parseLimit reads the limit query parameter, def when absent.
+func parseLimit(r *http.Request, def, max int) (int, error) {
+	raw := r.URL.Query().Get("limit")
+	if raw == "" {
+		return def, nil
+	}
+	n, err := strconv.Atoi(raw)
+	if err != nil || n < 1 || n > max {
+		return 0, fmt.Errorf("invalid limit, expected 1 to %d", max)
+	}
+	return n, nil
+}
+
+// ListAudit returns audit entries
+// swagger:route GET /audit audit listAudit
+//
+// Query the audit trail.
+//
+// Returns recorded mutations matching the filters, oldest first, at most limit per page.
+// When more entries may follow, the X-Next-Cursor header holds the cursor to pass for the
+// next page.
+//
+// Produces:
+// - application/json
+//
+// Responses:
+//
+//	200: auditEntriesResponse
+//	400: body:ErrorResponse
+//	500: body:ErrorResponse
+func (h *AuditHandler) ListAudit(w http.ResponseWriter, r *http.Request) {
+	filter, err := parseAuditFilter(r)
+	if err == nil {
+		filter.Limit, err = parseLimit(r, defaultAuditLimit, maxAuditLimit)
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	entries, next, err := h.service.Query(r.Context(), filter)
+	if err != nil {
+		httpError(w, err, http.StatusInternalServerError)
+		return
+	}
+
+	if next != "" {
+		w.Header().Set(NextCursorHeader, next)
+	}
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(entries)
+}
+
+// ExportAudit streams audit entries as NDJSON
+// swagger:route GET /audit/export audit exportAudit
+//
+// Export the audit trail as NDJSON.
+//
+// Same filters as GET /audit, one JSON entry per line. Everything from the cursor on is
+// exported, without a page limit.
+//
+// Produces:
+// - application/x-ndjson
+//
+// Responses:
+//
+//	200: auditEntriesResponse
+//	400: body:ErrorResponse
+//	500: body:ErrorResponse
+func (h *AuditHandler) ExportAudit(w http.ResponseWriter, r *http.Request) {
+	filter, err := parseAuditFilter(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	entries, _, err := h.service.Query(r.Context(), filter)
+	if err != nil {
+		httpError(w, err, http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/x-ndjson")
+	w.Header().Set("Content-Disposition", `attachment; filename="audit.ndjson"`)
+	enc := json.NewEncoder(w)
+	for _, e := range entries {
+		if err := enc.Encode(e); err != nil {
+			return
+		}
+	}
+}
@@ -0,0 +1,254 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+
+	"github.com/anjaobradovic/ars-sit-2025/auth"
+	"github.com/anjaobradovic/ars-sit-2025/dtos"
+	"github.com/anjaobradovic/ars-sit-2025/model"
+	"github.com/anjaobradovic/ars-sit-2025/repositories"
+	"github.com/anjaobradovic/ars-sit-2025/services"
+	"github.com/gorilla/mux"
+)
+
+type AuthHandler struct {
+	service *services.AuthService
+	authz   *services.AuthzService
+	audit   *services.AuditService
+}
+
+func NewAuthHandler(service *services.AuthService, authz *services.AuthzService, audit *services.AuditService) *AuthHandler {
+	return &AuthHandler{service: service, authz: authz, audit: audit}
+}
+
+func apiKeyTarget(id string) string {
+	return "auth/apikeys/" + id
+}
+
+// CreateAPIKey issues a new API key
+// swagger:route POST /admin/api-keys admin createAPIKey
+//
+// Issue an API key.
+//
+// The plaintext key is only returned in this response; the service stores its hash.
+// Key names are unique. Requires the admin role.
+//
+// Consumes:
+// - application/json
+//
+// Produces:
+// - application/json
+//
+// Responses:
+//
+//	201: body:CreatedAPIKey
+//	400: body:ErrorResponse
+//	403: body:ErrorResponse
+//	409: body:ErrorResponse
+func (h *AuthHandler) CreateAPIKey(w http.ResponseWriter, r *http.Request) {
+	var dto dtos.CreateAPIKeyDto
+	if err := json.NewDecoder(r.Body).Decode(&dto); err != nil {
+		http.Error(w, "invalid JSON", http.StatusBadRequest)
+		return
+	}
+
+	created, err := h.service.CreateAPIKey(r.Context(), dto)
+	if errors.Is(err, repositories.ErrAPIKeyNameTaken) {
+		http.Error(w, err.Error(), http.StatusConflict)
+		return
+	}
+	if err != nil {
+		httpError(w, err, http.StatusBadRequest)
+		return
+	}
+
+	recordAudit(h.audit, r, model.AuditAPIKeyCreate, apiKeyTarget(created.ID), nil, created.APIKey)
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	_ = json.NewEncoder(w).Encode(created)
+}
+
+// ListAPIKeys lists issued API keys
+// swagger:route GET /admin/api-keys admin listAPIKeys
+//
+// List API keys.
+//
+// Requires the admin role.
+//
+// Produces:
+// - application/json
+//
+// Responses:
+//
+//	200: apiKeysResponse
+//	403: body:ErrorResponse
+func (h *AuthHandler) ListAPIKeys(w http.ResponseWriter, r *http.Request) {
+	keys, err := h.service.ListAPIKeys(r.Context())
+	if err != nil {
+		httpError(w, err, http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(keys)
+}
+
+// DeleteAPIKey revokes an API key
+// swagger:route DELETE /admin/api-keys/{id} admin deleteAPIKey
+//
+// Revoke an API key.
+//
+// Requires the admin role.
+//
+// Responses:
+//
+//	204: body:NoContentResponse
+//	403: body:ErrorResponse
+//	404: body:ErrorResponse
+func (h *AuthHandler) DeleteAPIKey(w http.ResponseWriter, r *http.Request) {
+	id := mux.Vars(r)["id"]
+
+	deleted, err := h.service.DeleteAPIKey(r.Context(), id)
+	if err != nil {
+		if errors.Is(err, repositories.ErrAPIKeyNotFound) {
+			http.Error(w, err.Error(), http.StatusNotFound)
+			return
+		}
+		httpError(w, err, http.StatusInternalServerError)
+		return
+	}
+
+	recordAudit(h.audit, r, model.AuditAPIKeyDelete, apiKeyTarget(id), deleted, nil)
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// WhoAmI describes the caller
+// swagger:route GET /auth/whoami auth whoAmI
+//
+// Show the caller and its effective permissions.
+//
+// Lists the roles carried by the credential and every role binding that applies,
+// with the permissions and scope of each.
+//
+// Produces:
+// - application/json
+//
+// Responses:
+//
+//	200: body:WhoAmI
+//	401: body:ErrorResponse
+func (h *AuthHandler) WhoAmI(w http.ResponseWriter, r *http.Request) {
+	p, ok := auth.FromContext(r.Context())
+	if !ok {
+		http.Error(w, "authentication required", http.StatusUnauthorized)
+		return
+	}
+
+	who, err := h.authz.WhoAmI(r.Context(), p)
+	if err != nil {
+		httpError(w, err, http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(who)
+}
+
+// CreateRoleBinding grants a role in a scope
+// swagger:route POST /admin/policies admin createRoleBinding
+//
+// Create a role binding.
+//
+// Binds a role (reader, editor, secret-reader, admin) to a subject, optionally limited to a config name
+// prefix, a group, or labeled configurations inside groups. Subjects are qualified by authentication
+// method: "apikey:<key id>" or "jwt:<sub>"; "*" binds every caller. Requires the admin role.
+//
+// Consumes:
+// - application/json
+//
+// Produces:
+// - application/json
+//
+// Responses:
+//
+//	201: body:RoleBinding
+//	400: body:ErrorResponse
+//	403: body:ErrorResponse
+func (h *AuthHandler) CreateRoleBinding(w http.ResponseWriter, r *http.Request) {
+	var dto dtos.CreateRoleBindingDto
+	if err := json.NewDecoder(r.Body).Decode(&dto); err != nil {
+		http.Error(w, "invalid JSON", http.StatusBadRequest)
+		return
+	}
+
+	b, err := h.authz.CreateBinding(r.Context(), dto)
+	if err != nil {
+		httpError(w, err, http.StatusBadRequest)
+		return
+	}
+
+	recordAudit(h.audit, r, model.AuditRoleBindingCreate, repositories.RoleBindingKey(b.ID), nil, b)
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	_ = json.NewEncoder(w).Encode(b)
+}
+
+// ListRoleBindings lists role bindings
+// swagger:route GET /admin/policies admin listRoleBindings
+//
+// List role bindings.
+//
+// Requires the admin role.
+//
+// Produces:
+// - application/json
+//
+// Responses:
+//
+//	200: roleBindingsResponse
+//	403: body:ErrorResponse
+func (h *AuthHandler) ListRoleBindings(w http.ResponseWriter, r *http.Request) {
+	bindings, err := h.authz.ListBindings(r.Context())
+	if err != nil {
+		httpError(w, err, http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(bindings)
+}
+
+// DeleteRoleBinding removes a role binding
+// swagger:route DELETE /admin/policies/{id} admin deleteRoleBinding
+//
+// Delete a role binding.
+//
+// Requires the admin role.
+//
+// Responses:
+//
+//	204: body:NoContentResponse
+//	403: body:ErrorResponse
+//	404: body:ErrorResponse
+func (h *AuthHandler) DeleteRoleBinding(w http.ResponseWriter, r *http.Request) {
+	id := mux.Vars(r)["id"]
+
+	deleted, err := h.authz.DeleteBinding(r.Context(), id)
+	if err != nil {
+		if errors.Is(err, repositories.ErrRoleBindingNotFound) {
+			http.Error(w, err.Error(), http.StatusNotFound)
+			return
+		}
+		httpError(w, err, http.StatusInternalServerError)
+		return
+	}
+
+	recordAudit(h.audit, r, model.AuditRoleBindingDelete, repositories.RoleBindingKey(id), deleted, nil)
+
+	w.WriteHeader(http.StatusNoContent)
+}
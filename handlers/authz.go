@@ -0,0 +1,55 @@
+package handlers
+
+import (
+	"errors"
+	"math"
+	"net/http"
+	"strconv"
+
+	"github.com/anjaobradovic/ars-sit-2025/auth"
+	"github.com/anjaobradovic/ars-sit-2025/consulkv"
+	"github.com/anjaobradovic/ars-sit-2025/model"
+	"github.com/anjaobradovic/ars-sit-2025/secrets"
+)
+
+// errorStatus maps errors with a well-known meaning to their HTTP status and
+// falls back to def for the rest.
+func errorStatus(err error, def int) int {
+	switch {
+	case errors.Is(err, auth.ErrForbidden):
+		return http.StatusForbidden
+	case errors.Is(err, secrets.ErrUnknownKey), errors.Is(err, secrets.ErrMalformed):
+		return http.StatusInternalServerError
+	case errors.Is(err, consulkv.ErrUnavailable):
+		return http.StatusServiceUnavailable
+	}
+	return def
+}
+
+// httpError writes err with its errorStatus. While the Consul circuit
+// breaker is open it also tells the client when to retry.
+func httpError(w http.ResponseWriter, err error, def int) {
+	var open *consulkv.CircuitOpenError
+	if errors.As(err, &open) {
+		w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(open.RetryAfter.Seconds()))))
+	}
+	http.Error(w, err.Error(), errorStatus(err, def))
+}
+
+// readableConfigurations drops the labeled configurations of a group the
+// caller's grants do not allow it to read.
+func readableConfigurations(r *http.Request, groupName string, cfgs []*model.LabeledConfiguration) []*model.LabeledConfiguration {
+	grants := auth.GrantsFromContext(r.Context())
+
+	out := []*model.LabeledConfiguration{}
+	for _, c := range cfgs {
+		labels := c.Labels
+		if labels == nil {
+			labels = map[string]string{}
+		}
+		if grants.Allows(auth.PermRead, auth.Resource{Kind: auth.KindGroup, Name: groupName, Labels: labels}) {
+			out = append(out, c)
+		}
+	}
+	return out
+}
@@ -0,0 +1,90 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// IndexHeader carries the Consul index of the returned resource so clients
+// can pass it back as ?index= on their next long-poll.
+const IndexHeader = "X-Config-Index"
+
+const (
+	defaultBlockingWait = 5 * time.Minute
+	maxBlockingWait     = 10 * time.Minute
+)
+
+// parseBlockingQuery reads ?index=N&wait=30s. Without index the read is not
+// blocking; with index and no wait the Consul default of 5 minutes applies.
+func parseBlockingQuery(r *http.Request) (uint64, time.Duration, error) {
+	q := r.URL.Query()
+
+	rawIndex := q.Get("index")
+	rawWait := q.Get("wait")
+	if rawIndex == "" {
+		if rawWait != "" {
+			return 0, 0, errors.New("wait requires index")
+		}
+		return 0, 0, nil
+	}
+
+	index, err := strconv.ParseUint(rawIndex, 10, 64)
+	if err != nil {
+		return 0, 0, errors.New("invalid index, expected a non-negative integer")
+	}
+
+	wait := defaultBlockingWait
+	if rawWait != "" {
+		wait, err = time.ParseDuration(rawWait)
+		if err != nil || wait <= 0 {
+			return 0, 0, errors.New("invalid wait, expected a duration such as 30s or 5m")
+		}
+	}
+	if wait > maxBlockingWait {
+		wait = maxBlockingWait
+	}
+
+	return index, wait, nil
+}
+
+func setIndexHeader(w http.ResponseWriter, index uint64) {
+	if index > 0 {
+		w.Header().Set(IndexHeader, strconv.FormatUint(index, 10))
+	}
+}
+
+type shutdownKey struct{}
+
+// WithShutdown returns the server's base context. shutdown is cancelled when
+// the server starts shutting down, which ends every long-poll early.
+func WithShutdown(ctx, shutdown context.Context) context.Context {
+	return context.WithValue(ctx, shutdownKey{}, shutdown)
+}
+
+// watchFunc is a blocking read: it returns once the resource's index exceeds
+// index or wait expires.
+type watchFunc[T any] func(ctx context.Context, index uint64, wait time.Duration) (T, uint64, error)
+
+// watch runs a blocking read that stops waiting when the server shuts down.
+// The read is then repeated without waiting, so the client gets the current
+// state and index instead of holding up the shutdown.
+func watch[T any](ctx context.Context, index uint64, wait time.Duration, read watchFunc[T]) (T, uint64, error) {
+	shutdown, ok := ctx.Value(shutdownKey{}).(context.Context)
+	if !ok || index == 0 {
+		return read(ctx, index, wait)
+	}
+
+	waitCtx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	stop := context.AfterFunc(shutdown, cancel)
+	defer stop()
+
+	v, lastIndex, err := read(waitCtx, index, wait)
+	if err != nil && shutdown.Err() != nil && ctx.Err() == nil {
+		return read(ctx, 0, 0)
+	}
+	return v, lastIndex, err
+}
@@ -0,0 +1,53 @@
+package handlers
+
+import (
+	"context"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestParseBlockingQuery(t *testing.T) {
+	req := httptest.NewRequest("GET", "/configs/db/versions/v1?index=42&wait=30s", nil)
+
+	index, wait, err := parseBlockingQuery(req)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if index != 42 {
+		t.Errorf("expected index 42, got %d", index)
+	}
+	if wait != 30*time.Second {
+		t.Errorf("expected wait 30s, got %s", wait)
+	}
+}
+
+func TestParseBlockingQuery_WaitWithoutIndex(t *testing.T) {
+	req := httptest.NewRequest("GET", "/configs/db/versions/v1?wait=30s", nil)
+
+	if _, _, err := parseBlockingQuery(req); err == nil {
+		t.Fatal("expected error, got nil")
+	}
+}
+
+func TestWatch_ShutdownReturnsCurrentState(t *testing.T) {
+	shutdown, startShutdown := context.WithCancel(context.Background())
+	ctx := WithShutdown(context.Background(), shutdown)
+
+	read := func(ctx context.Context, index uint64, wait time.Duration) (string, uint64, error) {
+		if index == 0 {
+			return "current", 7, nil
+		}
+		<-ctx.Done()
+		return "", 0, ctx.Err()
+	}
+
+	time.AfterFunc(10*time.Millisecond, startShutdown)
+	v, index, err := watch(ctx, 7, time.Minute, read)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if v != "current" || index != 7 {
+		t.Errorf("expected current state at index 7, got %q at %d", v, index)
+	}
+}
@@ -1,22 +1,26 @@
 package handlers
 
 import (
+	"context"
 	"encoding/json"
-	"log"
 	"net/http"
 	"strings"
+	"time"
 
+	"github.com/anjaobradovic/ars-sit-2025/auth"
 	"github.com/anjaobradovic/ars-sit-2025/model"
+	"github.com/anjaobradovic/ars-sit-2025/repositories"
 	"github.com/anjaobradovic/ars-sit-2025/services"
 	"github.com/gorilla/mux"
 )
 
 type GroupHandler struct {
 	service *services.GroupService
+	audit   *services.AuditService
 }
 
-func NewGroupHandler(service *services.GroupService) *GroupHandler {
-	return &GroupHandler{service: service}
+func NewGroupHandler(service *services.GroupService, audit *services.AuditService) *GroupHandler {
+	return &GroupHandler{service: service, audit: audit}
 }
 
 // CreateGroup creates a new configuration group
@@ -42,11 +46,18 @@ func (h *GroupHandler) CreateGroup(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	if err := h.service.Create(&group); err != nil {
-		http.Error(w, err.Error(), http.StatusBadRequest)
+	if err := auth.Authorize(r.Context(), auth.PermWrite, auth.Resource{Kind: auth.KindGroup, Name: group.Name}); err != nil {
+		http.Error(w, err.Error(), http.StatusForbidden)
+		return
+	}
+
+	if err := h.service.Create(r.Context(), &group); err != nil {
+		httpError(w, err, http.StatusBadRequest)
 		return
 	}
 
+	recordAudit(h.audit, r, model.AuditGroupCreate, repositories.GroupKey(group.Name, group.Version), nil, group)
+
 	w.WriteHeader(http.StatusCreated)
 	json.NewEncoder(w).Encode(group)
 }
@@ -57,6 +68,8 @@ func (h *GroupHandler) CreateGroup(w http.ResponseWriter, r *http.Request) {
 // Get a configuration group.
 //
 // This endpoint retrieves a specific configuration group by name and version.
+// When ?index= is set the request blocks until the group changes past that
+// index or ?wait= expires. The current index is returned in X-Config-Index.
 //
 // Produces:
 // - application/json
@@ -68,9 +81,18 @@ func (h *GroupHandler) CreateGroup(w http.ResponseWriter, r *http.Request) {
 func (h *GroupHandler) GetGroup(w http.ResponseWriter, r *http.Request) {
 	vars := mux.Vars(r)
 
-	group, err := h.service.Get(vars["name"], vars["version"])
+	index, wait, err := parseBlockingQuery(r)
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusNotFound)
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	group, lastIndex, err := watch(r.Context(), index, wait, func(ctx context.Context, index uint64, wait time.Duration) (*model.ConfigurationGroup, uint64, error) {
+		return h.service.Watch(ctx, vars["name"], vars["version"], index, wait)
+	})
+	setIndexHeader(w, lastIndex)
+	if err != nil {
+		httpError(w, err, http.StatusNotFound)
 		return
 	}
 
@@ -92,11 +114,15 @@ func (h *GroupHandler) GetGroup(w http.ResponseWriter, r *http.Request) {
 func (h *GroupHandler) DeleteGroup(w http.ResponseWriter, r *http.Request) {
 	vars := mux.Vars(r)
 
-	if err := h.service.Delete(vars["name"], vars["version"]); err != nil {
-		http.Error(w, err.Error(), http.StatusBadRequest)
+	before, _ := h.service.Get(r.Context(), vars["name"], vars["version"])
+
+	if err := h.service.Delete(r.Context(), vars["name"], vars["version"]); err != nil {
+		httpError(w, err, http.StatusBadRequest)
 		return
 	}
 
+	recordAudit(h.audit, r, model.AuditGroupDelete, repositories.GroupKey(vars["name"], vars["version"]), before, nil)
+
 	w.WriteHeader(http.StatusNoContent)
 }
 
@@ -126,15 +152,15 @@ func (h *GroupHandler) AddConfig(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	log.Println("Handler: AddConfig called")
-	log.Printf("Group: %s %s\n", vars["name"], vars["version"])
-	log.Printf("Config payload: %+v\n", cfg)
+	before, _ := h.service.Get(r.Context(), vars["name"], vars["version"])
 
-	if err := h.service.AddConfig(vars["name"], vars["version"], cfg); err != nil {
-		http.Error(w, err.Error(), http.StatusBadRequest)
+	if err := h.service.AddConfig(r.Context(), vars["name"], vars["version"], cfg); err != nil {
+		httpError(w, err, http.StatusBadRequest)
 		return
 	}
 
+	h.auditGroupChange(r, model.AuditGroupAddConfig, before)
+
 	w.WriteHeader(http.StatusOK)
 }
 
@@ -167,11 +193,15 @@ func (h *GroupHandler) RemoveConfig(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	if err := h.service.RemoveConfig(vars["name"], vars["version"], payload.ConfigID); err != nil {
-		http.Error(w, err.Error(), http.StatusBadRequest)
+	before, _ := h.service.Get(r.Context(), vars["name"], vars["version"])
+
+	if err := h.service.RemoveConfig(r.Context(), vars["name"], vars["version"], payload.ConfigID); err != nil {
+		httpError(w, err, http.StatusBadRequest)
 		return
 	}
 
+	h.auditGroupChange(r, model.AuditGroupRemoveConfig, before)
+
 	w.WriteHeader(http.StatusOK)
 }
 
@@ -194,18 +224,21 @@ func (h *GroupHandler) RemoveConfig(w http.ResponseWriter, r *http.Request) {
 func (h *GroupHandler) GetConfigsByLabels(w http.ResponseWriter, r *http.Request) {
 	vars := mux.Vars(r)
 
-	group, err := h.service.Get(vars["name"], vars["version"])
+	group, err := h.service.Get(r.Context(), vars["name"], vars["version"])
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusNotFound)
+		httpError(w, err, http.StatusNotFound)
 		return
 	}
 
 	// Očekujemo: ?labels=env:prod;region:eu
 	raw := strings.TrimSpace(r.URL.Query().Get("labels"))
 
+	// Label-scoped readers only see the configurations their grants cover
+	readable := readableConfigurations(r, vars["name"], group.Configurations)
+
 	// Ako nema labels parametra, vrati sve konfiguracije u grupi
 	if raw == "" {
-		_ = json.NewEncoder(w).Encode(group.Configurations)
+		_ = json.NewEncoder(w).Encode(readable)
 		return
 	}
 
@@ -237,7 +270,7 @@ func (h *GroupHandler) GetConfigsByLabels(w http.ResponseWriter, r *http.Request
 	result := []*model.LabeledConfiguration{}
 
 	// AND matching: sve labele iz upita moraju postojati u cfg.Labels i biti jednake
-	for _, cfg := range group.Configurations {
+	for _, cfg := range readable {
 		match := true
 		for k, v := range queryLabels {
 			if cfg.Labels == nil || cfg.Labels[k] != v {
@@ -273,17 +306,28 @@ func (h *GroupHandler) DeleteConfigsByLabels(w http.ResponseWriter, r *http.Requ
 	vars := mux.Vars(r)
 	raw := strings.TrimSpace(r.URL.Query().Get("labels"))
 
-	deleted, err := h.service.DeleteConfigsByLabels(vars["name"], vars["version"], raw)
+	before, _ := h.service.Get(r.Context(), vars["name"], vars["version"])
+
+	_, err := h.service.DeleteConfigsByLabels(r.Context(), vars["name"], vars["version"], raw)
 	if err != nil {
 		// Ako nema grupe -> 404; ostalo 400
 		if strings.Contains(err.Error(), "group not found") {
 			http.Error(w, err.Error(), http.StatusNotFound)
 			return
 		}
-		http.Error(w, err.Error(), http.StatusBadRequest)
+		httpError(w, err, http.StatusBadRequest)
 		return
 	}
 
-	log.Printf("Handler: DeleteConfigsByLabels deleted=%d", deleted)
+	h.auditGroupChange(r, model.AuditGroupDeleteByLabels, before)
+
 	w.WriteHeader(http.StatusNoContent)
 }
+
+// auditGroupChange records a membership change, reading the group again to
+// hash its new state.
+func (h *GroupHandler) auditGroupChange(r *http.Request, action model.AuditAction, before *model.ConfigurationGroup) {
+	vars := mux.Vars(r)
+	after, _ := h.service.Get(r.Context(), vars["name"], vars["version"])
+	recordAudit(h.audit, r, action, repositories.GroupKey(vars["name"], vars["version"]), before, after)
+}
@@ -1,15 +1,19 @@
 package handlers
 
 import (
+	"context"
 	"encoding/json"
-	"log"
+	"log/slog"
 	"net/http"
+	"time"
 
 	"go.opentelemetry.io/otel"
 	"go.opentelemetry.io/otel/attribute"
 	"go.opentelemetry.io/otel/codes"
 
+	"github.com/anjaobradovic/ars-sit-2025/auth"
 	"github.com/anjaobradovic/ars-sit-2025/model"
+	"github.com/anjaobradovic/ars-sit-2025/repositories"
 	"github.com/anjaobradovic/ars-sit-2025/services"
 	"github.com/gorilla/mux"
 )
@@ -18,10 +22,11 @@ var tracer = otel.Tracer("handlers/config")
 
 type ConfigHandler struct {
 	service *services.ConfigService
+	audit   *services.AuditService
 }
 
-func NewConfigHandler(service *services.ConfigService) *ConfigHandler {
-	return &ConfigHandler{service: service}
+func NewConfigHandler(service *services.ConfigService, audit *services.AuditService) *ConfigHandler {
+	return &ConfigHandler{service: service, audit: audit}
 }
 
 // CreateConfig creates a new configuration
@@ -52,7 +57,7 @@ func (h *ConfigHandler) CreateConfig(w http.ResponseWriter, r *http.Request) {
 	if err := json.NewDecoder(r.Body).Decode(&config); err != nil {
 		span.RecordError(err)
 		span.SetStatus(codes.Error, "invalid JSON body")
-		log.Printf("JSON decode error: %+v\n", err)
+		slog.DebugContext(ctx, "invalid config body", "error", err)
 		http.Error(w, "invalid JSON body", http.StatusBadRequest)
 		return
 	}
@@ -62,13 +67,22 @@ func (h *ConfigHandler) CreateConfig(w http.ResponseWriter, r *http.Request) {
 		attribute.String("config.version", config.Version),
 	)
 
+	if err := auth.Authorize(ctx, auth.PermWrite, auth.Resource{Kind: auth.KindConfig, Name: config.Name}); err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, "forbidden")
+		http.Error(w, err.Error(), http.StatusForbidden)
+		return
+	}
+
 	if err := h.service.Create(ctx, &config); err != nil {
 		span.RecordError(err)
 		span.SetStatus(codes.Error, "create failed")
-		http.Error(w, err.Error(), http.StatusBadRequest)
+		httpError(w, err, http.StatusBadRequest)
 		return
 	}
 
+	recordAudit(h.audit, r, model.AuditConfigCreate, repositories.ConfigKey(config.Name, config.Version), nil, config)
+
 	w.WriteHeader(http.StatusCreated)
 	_ = json.NewEncoder(w).Encode(config)
 }
@@ -79,6 +93,8 @@ func (h *ConfigHandler) CreateConfig(w http.ResponseWriter, r *http.Request) {
 // Get configuration by name and version.
 //
 // This endpoint retrieves a specific configuration by its name and version.
+// When ?index= is set the request blocks until the configuration changes past
+// that index or ?wait= expires. The current index is returned in X-Config-Index.
 //
 // Produces:
 // - application/json
@@ -103,11 +119,22 @@ func (h *ConfigHandler) GetConfigByVersion(w http.ResponseWriter, r *http.Reques
 		attribute.String("config.version", version),
 	)
 
-	config, err := h.service.Get(ctx, name, version)
+	index, wait, err := parseBlockingQuery(r)
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, "invalid blocking query")
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	config, lastIndex, err := watch(ctx, index, wait, func(ctx context.Context, index uint64, wait time.Duration) (*model.Config, uint64, error) {
+		return h.service.Watch(ctx, name, version, index, wait)
+	})
+	setIndexHeader(w, lastIndex)
 	if err != nil {
 		span.RecordError(err)
 		span.SetStatus(codes.Error, "not found")
-		http.Error(w, err.Error(), http.StatusNotFound)
+		httpError(w, err, http.StatusNotFound)
 		return
 	}
 
@@ -141,12 +168,16 @@ func (h *ConfigHandler) DeleteConfigByVersion(w http.ResponseWriter, r *http.Req
 		attribute.String("config.version", version),
 	)
 
+	before, _ := h.service.Get(ctx, name, version)
+
 	if err := h.service.Delete(ctx, name, version); err != nil {
 		span.RecordError(err)
 		span.SetStatus(codes.Error, "delete failed")
-		http.Error(w, err.Error(), http.StatusBadRequest)
+		httpError(w, err, http.StatusBadRequest)
 		return
 	}
 
+	recordAudit(h.audit, r, model.AuditConfigDelete, repositories.ConfigKey(name, version), before, nil)
+
 	w.WriteHeader(http.StatusNoContent)
 }
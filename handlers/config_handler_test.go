@@ -15,7 +15,7 @@ func TestCreateConfigHandler_InvalidJSON(t *testing.T) {
 
 	rr := httptest.NewRecorder()
 
-	handler := NewConfigHandler(nil)
+	handler := NewConfigHandler(nil, nil)
 
 	handler.CreateConfig(rr, req)
 
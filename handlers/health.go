@@ -0,0 +1,66 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/anjaobradovic/ars-sit-2025/model"
+	"github.com/anjaobradovic/ars-sit-2025/services"
+)
+
+type HealthHandler struct {
+	service *services.HealthService
+}
+
+func NewHealthHandler(service *services.HealthService) *HealthHandler {
+	return &HealthHandler{service: service}
+}
+
+// Livez reports that the process is up
+// swagger:route GET /livez health livez
+//
+// Liveness probe.
+//
+// Succeeds as long as the process serves HTTP; dependencies are not checked.
+//
+// Produces:
+// - text/plain
+//
+// Responses:
+//
+//	200: description:ok
+func (h *HealthHandler) Livez(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	w.WriteHeader(http.StatusOK)
+	_, _ = w.Write([]byte("ok"))
+}
+
+// Readyz reports whether the service can take traffic
+// swagger:route GET /readyz health readyz
+//
+// Readiness probe.
+//
+// Checks Consul leader status and KV round-trip latency, and reports the tracing
+// exporter. Fails with 503 when a Consul check fails or the service is shutting down;
+// a failing tracing exporter is reported as "warn" and does not affect readiness.
+//
+// Produces:
+// - application/json
+//
+// Responses:
+//
+//	200: body:ReadinessReport
+//	503: body:ReadinessReport
+func (h *HealthHandler) Readyz(w http.ResponseWriter, r *http.Request) {
+	report := h.service.Ready(r.Context())
+
+	status := http.StatusOK
+	if report.Status != model.StatusReady {
+		status = http.StatusServiceUnavailable
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(report)
+}
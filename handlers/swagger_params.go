@@ -1,6 +1,9 @@
 package handlers
 
-import "github.com/anjaobradovic/ars-sit-2025/model"
+import (
+	"github.com/anjaobradovic/ars-sit-2025/dtos"
+	"github.com/anjaobradovic/ars-sit-2025/model"
+)
 
 // -------------------- CONFIGS --------------------
 
@@ -22,6 +25,21 @@ type configPathParams struct {
 	Version string `json:"version"`
 }
 
+// -------------------- BLOCKING QUERIES --------------------
+
+// swagger:parameters getConfigurationByNameAndVersion getGroup
+type blockingQueryParams struct {
+	// Consul index from a previous X-Config-Index header; the request blocks until the resource changes past it
+	// in: query
+	// required: false
+	Index uint64 `json:"index"`
+
+	// Maximum time to block, e.g. 30s or 5m (default 5m, max 10m). Only valid together with index
+	// in: query
+	// required: false
+	Wait string `json:"wait"`
+}
+
 // -------------------- GROUPS --------------------
 
 // swagger:parameters createGroup
@@ -72,3 +90,85 @@ type getConfigsByLabelsParams struct {
 	// required: false
 	Labels string `json:"labels"`
 }
+
+// -------------------- WEBHOOKS --------------------
+
+// swagger:parameters createWebhook
+type createWebhookParams struct {
+	// in: body
+	// required: true
+	Body dtos.CreateWebhookDto `json:"body"`
+}
+
+// swagger:parameters deleteWebhook listWebhookDeliveries
+type webhookPathParams struct {
+	// in: path
+	// required: true
+	ID string `json:"id"`
+}
+
+// swagger:parameters listWebhookDeliveries
+type webhookDeliveriesParams struct {
+	// Number of deliveries, 1 to 1000
+	// in: query
+	// required: false
+	// default: 100
+	Limit int `json:"limit"`
+}
+
+// -------------------- AUDIT --------------------
+
+// swagger:parameters listAudit exportAudit
+type auditQueryParams struct {
+	// Only entries for this storage key, e.g. configs/database-config/v1.0
+	// in: query
+	// required: false
+	Target string `json:"target"`
+
+	// Only entries by this actor
+	// in: query
+	// required: false
+	Actor string `json:"actor"`
+
+	// Only entries at or after this RFC3339 timestamp
+	// in: query
+	// required: false
+	Since string `json:"since"`
+
+	// Cursor from the X-Next-Cursor header of the previous page
+	// in: query
+	// required: false
+	Cursor string `json:"cursor"`
+}
+
+// swagger:parameters listAudit
+type auditPageParams struct {
+	// Page size, 1 to 1000
+	// in: query
+	// required: false
+	// default: 100
+	Limit int `json:"limit"`
+}
+
+// -------------------- ADMIN --------------------
+
+// swagger:parameters createAPIKey
+type createAPIKeyParams struct {
+	// in: body
+	// required: true
+	Body dtos.CreateAPIKeyDto `json:"body"`
+}
+
+// swagger:parameters createRoleBinding
+type createRoleBindingParams struct {
+	// in: body
+	// required: true
+	Body dtos.CreateRoleBindingDto `json:"body"`
+}
+
+// swagger:parameters deleteAPIKey deleteRoleBinding
+type apiKeyPathParams struct {
+	// in: path
+	// required: true
+	ID string `json:"id"`
+}
@@ -8,3 +8,41 @@ type labeledConfigurationsResponse struct {
 	// in:body
 	Body []*model.LabeledConfiguration
 }
+
+// Webhook subscriptions response
+// swagger:response webhookSubscriptionsResponse
+type webhookSubscriptionsResponse struct {
+	// in:body
+	Body []model.WebhookSubscription
+}
+
+// Webhook deliveries response
+// swagger:response webhookDeliveriesResponse
+type webhookDeliveriesResponse struct {
+	// in:body
+	Body []model.WebhookDelivery
+}
+
+// Audit entries response
+// swagger:response auditEntriesResponse
+type auditEntriesResponse struct {
+	// Cursor of the next page, absent on the last one
+	NextCursor string `json:"X-Next-Cursor"`
+
+	// in:body
+	Body []model.AuditEntry
+}
+
+// API keys response
+// swagger:response apiKeysResponse
+type apiKeysResponse struct {
+	// in:body
+	Body []model.APIKey
+}
+
+// Role bindings response
+// swagger:response roleBindingsResponse
+type roleBindingsResponse struct {
+	// in:body
+	Body []model.RoleBinding
+}
@@ -15,7 +15,7 @@ func TestCreateConfig_InvalidBody(t *testing.T) {
 
 	rr := httptest.NewRecorder()
 
-	handler := NewConfigHandler(nil)
+	handler := NewConfigHandler(nil, nil)
 	handler.CreateConfig(rr, req)
 
 	if rr.Code != http.StatusBadRequest {
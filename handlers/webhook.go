@@ -0,0 +1,157 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+
+	"github.com/anjaobradovic/ars-sit-2025/dtos"
+	"github.com/anjaobradovic/ars-sit-2025/model"
+	"github.com/anjaobradovic/ars-sit-2025/repositories"
+	"github.com/anjaobradovic/ars-sit-2025/services"
+	"github.com/gorilla/mux"
+)
+
+type WebhookHandler struct {
+	service *services.WebhookService
+	audit   *services.AuditService
+}
+
+func NewWebhookHandler(service *services.WebhookService, audit *services.AuditService) *WebhookHandler {
+	return &WebhookHandler{service: service, audit: audit}
+}
+
+// CreateWebhook registers a webhook subscription
+// swagger:route POST /webhooks webhooks createWebhook
+//
+// Register a webhook subscription.
+//
+// Events matching the subscription are POSTed as JSON and signed with
+// HMAC-SHA256 in the X-Webhook-Signature header. The secret is only returned here.
+//
+// Consumes:
+// - application/json
+//
+// Produces:
+// - application/json
+//
+// Responses:
+//
+//	201: body:WebhookSubscription
+//	400: body:ErrorResponse
+func (h *WebhookHandler) CreateWebhook(w http.ResponseWriter, r *http.Request) {
+	var dto dtos.CreateWebhookDto
+	if err := json.NewDecoder(r.Body).Decode(&dto); err != nil {
+		http.Error(w, "invalid JSON", http.StatusBadRequest)
+		return
+	}
+
+	sub, err := h.service.CreateSubscription(r.Context(), dto)
+	if err != nil {
+		httpError(w, err, http.StatusBadRequest)
+		return
+	}
+
+	recordAudit(h.audit, r, model.AuditWebhookCreate, repositories.SubscriptionKey(sub.ID), nil, sub)
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	_ = json.NewEncoder(w).Encode(sub)
+}
+
+// ListWebhooks lists webhook subscriptions
+// swagger:route GET /webhooks webhooks listWebhooks
+//
+// List webhook subscriptions.
+//
+// Produces:
+// - application/json
+//
+// Responses:
+//
+//	200: webhookSubscriptionsResponse
+//	500: body:ErrorResponse
+func (h *WebhookHandler) ListWebhooks(w http.ResponseWriter, r *http.Request) {
+	subs, err := h.service.ListSubscriptions(r.Context())
+	if err != nil {
+		httpError(w, err, http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(subs)
+}
+
+// DeleteWebhook removes a webhook subscription
+// swagger:route DELETE /webhooks/{id} webhooks deleteWebhook
+//
+// Delete a webhook subscription.
+//
+// Pending deliveries for the subscription are dropped.
+//
+// Responses:
+//
+//	204: body:NoContentResponse
+//	404: body:ErrorResponse
+func (h *WebhookHandler) DeleteWebhook(w http.ResponseWriter, r *http.Request) {
+	id := mux.Vars(r)["id"]
+
+	if err := h.service.DeleteSubscription(r.Context(), id); err != nil {
+		if errors.Is(err, repositories.ErrSubscriptionNotFound) {
+			http.Error(w, err.Error(), http.StatusNotFound)
+			return
+		}
+		httpError(w, err, http.StatusInternalServerError)
+		return
+	}
+
+	recordAudit(h.audit, r, model.AuditWebhookDelete, repositories.SubscriptionKey(id), nil, nil)
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// Page size of GET /webhooks/{id}/deliveries when no limit is given, and the
+// largest allowed.
+const (
+	defaultDeliveriesLimit = 100
+	maxDeliveriesLimit     = 1000
+)
+
+// ListWebhookDeliveries returns the delivery log of a subscription
+// swagger:route GET /webhooks/{id}/deliveries webhooks listWebhookDeliveries
+//
+// List deliveries of a webhook subscription.
+//
+// The newest events sent to the subscription, newest first, with their status, attempt
+// count and last error. Finished deliveries are kept for 7 days, at most 1000 per subscription.
+//
+// Produces:
+// - application/json
+//
+// Responses:
+//
+//	200: webhookDeliveriesResponse
+//	400: body:ErrorResponse
+//	404: body:ErrorResponse
+func (h *WebhookHandler) ListWebhookDeliveries(w http.ResponseWriter, r *http.Request) {
+	id := mux.Vars(r)["id"]
+
+	limit, err := parseLimit(r, defaultDeliveriesLimit, maxDeliveriesLimit)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	deliveries, err := h.service.ListDeliveries(r.Context(), id, limit)
+	if err != nil {
+		if errors.Is(err, repositories.ErrSubscriptionNotFound) {
+			http.Error(w, err.Error(), http.StatusNotFound)
+			return
+		}
+		httpError(w, err, http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(deliveries)
+}
@@ -2,20 +2,29 @@ package main
 
 import (
 	"context"
-	"log"
+	"errors"
+	"flag"
+	"fmt"
+	"log/slog"
+	"net"
 	"net/http"
 	"os"
 	"os/signal"
+	"strings"
 	"syscall"
 	"time"
 
 	"github.com/gorilla/mux"
-	"github.com/hashicorp/consul/api"
 
+	"github.com/anjaobradovic/ars-sit-2025/appconfig"
+	"github.com/anjaobradovic/ars-sit-2025/auth"
+	"github.com/anjaobradovic/ars-sit-2025/consulkv"
 	"github.com/anjaobradovic/ars-sit-2025/handlers"
+	"github.com/anjaobradovic/ars-sit-2025/logging"
 	"github.com/anjaobradovic/ars-sit-2025/metrics"
 	"github.com/anjaobradovic/ars-sit-2025/middleware"
 	"github.com/anjaobradovic/ars-sit-2025/repositories"
+	"github.com/anjaobradovic/ars-sit-2025/secrets"
 	"github.com/anjaobradovic/ars-sit-2025/services"
 	"github.com/anjaobradovic/ars-sit-2025/tracing"
 	"go.opentelemetry.io/contrib/instrumentation/github.com/gorilla/mux/otelmux"
@@ -24,69 +33,208 @@ import (
 func main() {
 	rootCtx := context.Background()
 
-	shutdownTracer, err := tracing.InitTracer(rootCtx)
+	// Defaults < YAML file (--config) < environment < flags
+	cfg, opts, err := appconfig.Load(os.Args[1:])
+	if errors.Is(err, flag.ErrHelp) {
+		return
+	}
 	if err != nil {
-		log.Fatal(err)
+		fmt.Fprintln(os.Stderr, "invalid configuration:", err)
+		os.Exit(2)
+	}
+	if opts.PrintConfig {
+		if err := cfg.Print(os.Stdout); err != nil {
+			fatal("cannot print configuration", err)
+		}
+		return
 	}
 
-	consulAddr := "consul:8500"
+	// JSON logs
+	if err := logging.Setup(os.Stderr, cfg.Log.Level); err != nil {
+		fatal("invalid log configuration", err)
+	}
 
-	configRepo, err := repositories.NewConfigRepository(consulAddr)
+	tracingConfig, err := tracing.LoadConfig(cfg.Tracing.ConfigFile)
 	if err != nil {
-		log.Fatal(err)
+		fatal("invalid tracing configuration", err)
 	}
-	configService := services.NewConfigService(configRepo)
-	configHandler := handlers.NewConfigHandler(configService)
+	shutdownTracer := tracing.InitTracer(rootCtx, tracingConfig)
 
-	groupRepo, err := repositories.NewGroupRepository(consulAddr)
+	// One Consul client, shared by every repository
+	consul, err := consulkv.NewClient(consulkv.Config{
+		Address:       cfg.Consul.Address,
+		Datacenter:    cfg.Consul.Datacenter,
+		Token:         cfg.Consul.Token,
+		TokenFile:     cfg.Consul.TokenFile,
+		UseTLS:        cfg.Consul.TLS,
+		CAFile:        cfg.Consul.CAFile,
+		CertFile:      cfg.Consul.CertFile,
+		KeyFile:       cfg.Consul.KeyFile,
+		TLSServerName: cfg.Consul.TLSServerName,
+		KeyPrefix:     cfg.Consul.KeyPrefix,
+		Resilience: consulkv.Resilience{
+			CallTimeout:     cfg.Consul.CallTimeout,
+			ReadRetries:     cfg.Consul.ReadRetries,
+			RetryBaseDelay:  cfg.Consul.RetryBaseDelay,
+			RetryMaxDelay:   cfg.Consul.RetryMaxDelay,
+			BreakerFailures: cfg.Consul.BreakerFailures,
+			BreakerCooldown: cfg.Consul.BreakerCooldown,
+		},
+	})
 	if err != nil {
-		log.Fatal(err)
+		fatal("cannot create Consul client", err)
 	}
-	groupService := services.NewGroupService(groupRepo)
-	groupHandler := handlers.NewGroupHandler(groupService)
 
-	cfg := api.DefaultConfig()
-	cfg.Address = consulAddr
-	consulClient, err := api.NewClient(cfg)
-	if err != nil {
-		log.Fatal(err)
+	var keyring *secrets.Keyring
+	if keyringFile := cfg.Secrets.KeyringFile; keyringFile != "" {
+		keyring, err = secrets.LoadKeyring(keyringFile)
+		if err != nil {
+			fatal("cannot load secrets keyring", err)
+		}
+	} else {
+		slog.Warn("no secrets keyring configured: secret parameters are rejected and webhook secrets are stored unencrypted")
 	}
 
-	r := mux.NewRouter()
+	auditRepo := repositories.NewAuditRepository(consul)
+	auditService := services.NewAuditService(auditRepo)
+	auditHandler := handlers.NewAuditHandler(auditService)
 
-	// Health
-	r.HandleFunc("/healthz", func(w http.ResponseWriter, r *http.Request) {
-		w.WriteHeader(http.StatusOK)
-		_, _ = w.Write([]byte("ok"))
-	}).Methods("GET")
+	webhookRepo := repositories.NewWebhookRepository(consul)
+	webhookService := services.NewWebhookService(webhookRepo, keyring)
+	webhookHandler := handlers.NewWebhookHandler(webhookService, auditService)
 
-	// Metrics middleware
-	r.Use(middleware.MetricsMiddleware)
+	configRepo := repositories.NewConfigRepository(consul)
+	configService := services.NewConfigService(configRepo, webhookService, keyring)
+	configHandler := handlers.NewConfigHandler(configService, auditService)
 
-	// Rate limiter (SKIP: metrics + swagger ui + swagger spec)
-	rl := middleware.NewRateLimiter(10, 20, 2*time.Minute)
-	r.Use(func(next http.Handler) http.Handler {
-		return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
-			p := req.URL.Path
+	groupRepo := repositories.NewGroupRepository(consul)
+	groupService := services.NewGroupService(groupRepo, webhookService, keyring)
 
-			// bitno: /docs/ i sve ispod mora da se preskoči (css/js)
-			if p == "/metrics" || p == "/swagger.yaml" || p == "/docs" || len(p) >= 6 && p[:6] == "/docs/" {
-				next.ServeHTTP(w, req)
-				return
-			}
+	// "rotate-secrets" rewraps every stored secret under the primary key of
+	// the keyring and exits instead of serving.
+	if len(opts.Args) > 0 && opts.Args[0] == "rotate-secrets" {
+		n, err := services.RotateSecrets(rootCtx, configRepo, groupRepo, webhookRepo, keyring)
+		if err != nil {
+			slog.Error("rotate-secrets failed", "rewritten", n, "error", err)
+			os.Exit(1)
+		}
+		slog.Info("rotate-secrets done", "rewritten", n)
+		_ = shutdownTracer(rootCtx)
+		return
+	}
+	groupHandler := handlers.NewGroupHandler(groupService, auditService)
 
-			rl.Middleware(next).ServeHTTP(w, req)
-		})
-	})
+	apiKeyRepo := repositories.NewAPIKeyRepository(consul)
+	var jwtVerifier *auth.JWTVerifier
+	if jwksFile := cfg.Auth.JWKSFile; jwksFile != "" {
+		jwtVerifier, err = auth.LoadJWTVerifier(jwksFile, cfg.Auth.JWTIssuer, cfg.Auth.JWTAudience)
+		if err != nil {
+			fatal("cannot load JWKS", err)
+		}
+	}
+	authService := services.NewAuthService(apiKeyRepo, jwtVerifier, cfg.Auth.BootstrapAPIKey)
+	policyRepo := repositories.NewPolicyRepository(consul)
+	authzService := services.NewAuthzService(policyRepo)
+	authHandler := handlers.NewAuthHandler(authService, authzService, auditService)
+
+	// The memory store keeps keys in process, for single-node setups
+	var idempotencyStore repositories.IdempotencyStore
+	if cfg.Idempotency.Store == "memory" {
+		idempotencyStore = repositories.NewMemoryIdempotencyStore(cfg.Idempotency.MemoryCapacity)
+	} else {
+		idempotencyStore = repositories.NewConsulIdempotencyStore(consul)
+	}
+	idempotencyConfig := middleware.IdempotencyConfig{
+		TTL:   cfg.Idempotency.TTL,
+		Lease: cfg.Idempotency.Lease,
+	}
+
+	r := mux.NewRouter()
+
+	// Health: /livez (and the older /healthz) only check the process,
+	// /readyz checks the dependencies
+	healthRepo := repositories.NewHealthRepository(consul)
+	healthService := services.NewHealthService(cfg.Readiness.Timeout)
+	healthService.Register("consul_leader", healthRepo.Leader)
+	healthService.Register("consul_kv", services.MaxLatency(healthRepo.RoundTrip, cfg.Readiness.KVMaxLatency))
+	// Tracing is not needed to serve requests, so it is only reported
+	healthService.RegisterNonCritical("tracing_exporter", func(context.Context) error { return tracing.ExporterHealth() })
+	healthHandler := handlers.NewHealthHandler(healthService)
+
+	r.HandleFunc("/healthz", healthHandler.Livez).Methods("GET")
+	r.HandleFunc("/livez", healthHandler.Livez).Methods("GET")
+	r.HandleFunc("/readyz", healthHandler.Readyz).Methods("GET")
+
+	// Client IP, read from forwarding headers only when sent by trusted proxies
+	trustedProxies, err := middleware.ParseTrustedProxies(cfg.Server.TrustedProxies)
+	if err != nil {
+		fatal("invalid server.trustedProxies", err)
+	}
+	forwardedHeader, err := middleware.ParseForwardingHeader(cfg.Server.ForwardedHeader)
+	if err != nil {
+		fatal("invalid server.forwardedHeader", err)
+	}
+	r.Use(middleware.ClientIPMiddleware(trustedProxies, forwardedHeader))
 
-	// Tracing (skip metrics)
+	// Request ID (X-Request-ID), carried in every log record of the request
+	r.Use(middleware.RequestIDMiddleware)
+
+	// Tracing (skip metrics and probes), outside metrics so observations
+	// carry the trace ID as an exemplar
 	r.Use(otelmux.Middleware(
 		"config-service",
 		otelmux.WithFilter(func(req *http.Request) bool {
-			return req.URL.Path != "/metrics"
+			switch req.URL.Path {
+			case "/metrics", "/healthz", "/livez", "/readyz":
+				return false
+			}
+			return true
 		}),
 	))
 
+	// Access log, inside tracing so records carry the trace ID
+	r.Use(middleware.AccessLogMiddleware)
+
+	// Metrics middleware
+	r.Use(middleware.MetricsMiddleware)
+
+	// Load shedding, inside metrics so observed latency drives the limit
+	r.Use(unlessPublic(middleware.NewConcurrencyLimiter(middleware.ConcurrencyLimiterConfig{
+		InitialLimit:  cfg.Concurrency.InitialLimit,
+		MinLimit:      cfg.Concurrency.MinLimit,
+		MaxLimit:      cfg.Concurrency.MaxLimit,
+		TargetLatency: cfg.Concurrency.TargetLatency,
+		WriteShare:    cfg.Concurrency.WriteShare,
+	}).Middleware))
+
+	// Rate limiter: per client IP before authentication, so failed logins
+	// and key guessing are limited too, then per principal after it
+	rateLimitPolicies, err := loadRateLimitPolicies(cfg.RateLimit.PolicyFile)
+	if err != nil {
+		fatal("cannot load rate limit policies", err)
+	}
+	rl := middleware.NewRateLimiter(rateLimitPolicies, cfg.RateLimit.BucketTTL).
+		UseClientIPLimit(cfg.RateLimit.ClientIPRate, cfg.RateLimit.ClientIPBurst)
+	// Shared limits hold across all replicas
+	if cfg.RateLimit.Shared {
+		rateLimitRepo := repositories.NewRateLimitRepository(consul)
+		rl.UseShared(&middleware.SharedRateLimit{
+			Store:    rateLimitRepo,
+			Window:   cfg.RateLimit.Window,
+			FailOpen: !cfg.RateLimit.FailClosed,
+		})
+	}
+	r.Use(unlessPublic(rl.PreAuthMiddleware))
+
+	// Authentication (SKIP: health, metrics, swagger ui + swagger spec)
+	r.Use(unlessPublic(middleware.AuthMiddleware(authService, cfg.Auth.AllowAnonymous)))
+
+	// Authorization (RBAC), routes outside configs and groups need admin
+	r.Use(unlessPublic(middleware.AuthorizationMiddleware(authzService)))
+
+	// Per-principal limits, now that the caller is known
+	r.Use(rl.Middleware)
+
 	// ---- Routes ----
 
 	// Prometheus metrics endpoint
@@ -110,48 +258,173 @@ func main() {
 		Handler(http.StripPrefix("/docs/", middleware.SwaggerUI(middleware.SwaggerUIOpts{}, nil))).
 		Methods("GET")
 
+	// Every mutating route honours Idempotency-Key, except API key and
+	// webhook creation: their responses carry a plaintext credential, which
+	// must never be stored.
+	idempotent := func(h http.HandlerFunc) http.Handler {
+		return middleware.IdempotencyMiddleware(idempotencyStore, idempotencyConfig)(h)
+	}
+
 	// Config routes
-	r.Handle("/configs",
-		middleware.IdempotencyMiddleware(consulClient)(http.HandlerFunc(configHandler.CreateConfig)),
-	).Methods("POST")
+	r.Handle("/configs", idempotent(configHandler.CreateConfig)).Methods("POST")
 	r.HandleFunc("/configs/{name}/versions/{version}", configHandler.GetConfigByVersion).Methods("GET")
-	r.HandleFunc("/configs/{name}/versions/{version}", configHandler.DeleteConfigByVersion).Methods("DELETE")
+	r.Handle("/configs/{name}/versions/{version}", idempotent(configHandler.DeleteConfigByVersion)).Methods("DELETE")
 
 	// Group routes
-	r.HandleFunc("/groups", groupHandler.CreateGroup).Methods("POST")
+	r.Handle("/groups", idempotent(groupHandler.CreateGroup)).Methods("POST")
 	r.HandleFunc("/groups/{name}/versions/{version}", groupHandler.GetGroup).Methods("GET")
-	r.HandleFunc("/groups/{name}/versions/{version}", groupHandler.DeleteGroup).Methods("DELETE")
-	r.HandleFunc("/groups/{name}/versions/{version}/add-config", groupHandler.AddConfig).Methods("POST")
-	r.HandleFunc("/groups/{name}/versions/{version}/remove-config", groupHandler.RemoveConfig).Methods("POST")
+	r.Handle("/groups/{name}/versions/{version}", idempotent(groupHandler.DeleteGroup)).Methods("DELETE")
+	r.Handle("/groups/{name}/versions/{version}/add-config", idempotent(groupHandler.AddConfig)).Methods("POST")
+	r.Handle("/groups/{name}/versions/{version}/remove-config", idempotent(groupHandler.RemoveConfig)).Methods("POST")
 	r.HandleFunc("/groups/{name}/versions/{version}/configs", groupHandler.GetConfigsByLabels).Methods("GET")
-	r.HandleFunc("/groups/{name}/versions/{version}/configs", groupHandler.DeleteConfigsByLabels).Methods("DELETE")
+	r.Handle("/groups/{name}/versions/{version}/configs", idempotent(groupHandler.DeleteConfigsByLabels)).Methods("DELETE")
+
+	// Webhook routes
+	r.HandleFunc("/webhooks", webhookHandler.CreateWebhook).Methods("POST")
+	r.HandleFunc("/webhooks", webhookHandler.ListWebhooks).Methods("GET")
+	r.Handle("/webhooks/{id}", idempotent(webhookHandler.DeleteWebhook)).Methods("DELETE")
+	r.HandleFunc("/webhooks/{id}/deliveries", webhookHandler.ListWebhookDeliveries).Methods("GET")
+
+	// Audit routes
+	r.HandleFunc("/audit", auditHandler.ListAudit).Methods("GET")
+	r.HandleFunc("/audit/export", auditHandler.ExportAudit).Methods("GET")
+
+	// Auth + admin routes
+	r.HandleFunc("/auth/whoami", authHandler.WhoAmI).Methods("GET")
+	r.HandleFunc("/admin/api-keys", authHandler.CreateAPIKey).Methods("POST")
+	r.HandleFunc("/admin/api-keys", authHandler.ListAPIKeys).Methods("GET")
+	r.Handle("/admin/api-keys/{id}", idempotent(authHandler.DeleteAPIKey)).Methods("DELETE")
+	r.Handle("/admin/policies", idempotent(authHandler.CreateRoleBinding)).Methods("POST")
+	r.HandleFunc("/admin/policies", authHandler.ListRoleBindings).Methods("GET")
+	r.Handle("/admin/policies/{id}", idempotent(authHandler.DeleteRoleBinding)).Methods("DELETE")
 
 	// ---- Server + graceful shutdown ----
+	// Long-poll reads stop waiting as soon as shutdown starts
+	watchCtx, stopWatches := context.WithCancel(rootCtx)
 	srv := &http.Server{
-		Addr:    ":8080",
+		Addr:    cfg.Server.Addr,
 		Handler: r,
+		BaseContext: func(net.Listener) context.Context {
+			return handlers.WithShutdown(rootCtx, watchCtx)
+		},
 	}
+	srv.RegisterOnShutdown(stopWatches)
+
+	// Webhook dispatcher (retry queue lives in Consul)
+	dispatchCtx, stopDispatch := context.WithCancel(rootCtx)
+	go webhookService.Run(dispatchCtx)
+
+	// Consul reachability gauge, probed even when no requests come in
+	go consulkv.MonitorReachability(dispatchCtx, consul, cfg.Consul.ProbeInterval)
+
+	// Idempotency records are swept in the background on every replica
+	go middleware.RunIdempotencySweeper(dispatchCtx, idempotencyStore, cfg.Idempotency.SweepInterval)
+
+	// Inventory gauges (configs, groups, idempotency records)
+	inventory := services.NewInventoryCollector(configRepo, groupRepo, idempotencyStore)
+	go inventory.Run(dispatchCtx, cfg.Inventory.Interval)
+
+	// SIGHUP reloads the settings that can change without a restart
+	hup := make(chan os.Signal, 1)
+	signal.Notify(hup, syscall.SIGHUP)
+	go func() {
+		running := cfg
+		for range hup {
+			running = reloadConfig(running, os.Args[1:], rl)
+		}
+	}()
 
 	quit := make(chan os.Signal, 1)
 	signal.Notify(quit, os.Interrupt, syscall.SIGTERM)
 
 	go func() {
-		log.Println("Config service running on :8080")
+		slog.Info("config service running", "addr", srv.Addr)
 		if err := srv.ListenAndServe(); err != nil && err != http.ErrServerClosed {
-			log.Fatal(err)
+			fatal("server failed", err)
 		}
 	}()
 
 	<-quit
-	log.Println("Shutting down Config service...")
+	slog.Info("shutting down config service")
 
-	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	// Report not ready first and give load balancers time to drain
+	healthService.SetShuttingDown()
+	time.Sleep(cfg.Server.DrainDelay)
+
+	ctx, cancel := context.WithTimeout(context.Background(), cfg.Server.ShutdownTimeout)
 	defer cancel()
 
 	if err := srv.Shutdown(ctx); err != nil {
-		log.Fatal("Server forced to shutdown:", err)
+		fatal("server forced to shutdown", err)
 	}
+	stopDispatch()
 
 	_ = shutdownTracer(ctx)
-	log.Println("Server stopped gracefully")
+	slog.Info("server stopped gracefully")
+}
+
+// fatal logs err and exits; for startup errors the service can not run with.
+func fatal(msg string, err error) {
+	slog.Error(msg, "error", err)
+	os.Exit(1)
+}
+
+// publicPath reports whether a path is served without authentication or rate
+// limiting. Everything under /docs/ is included so the UI assets load.
+func publicPath(p string) bool {
+	return p == "/healthz" || p == "/livez" || p == "/readyz" || p == "/metrics" || p == "/swagger.yaml" || p == "/docs" || strings.HasPrefix(p, "/docs/")
+}
+
+// unlessPublic applies mw to every request except those for public paths.
+func unlessPublic(mw func(http.Handler) http.Handler) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		wrapped := mw(next)
+		return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+			if publicPath(req.URL.Path) {
+				next.ServeHTTP(w, req)
+				return
+			}
+			wrapped.ServeHTTP(w, req)
+		})
+	}
+}
+
+// loadRateLimitPolicies reads the policy file, or returns the built-in
+// policies when there is none. A file replaces them, exemptions included.
+func loadRateLimitPolicies(path string) (middleware.RateLimitPolicies, error) {
+	if path == "" {
+		return middleware.DefaultRateLimitPolicies, nil
+	}
+	return middleware.LoadRateLimitPolicies(path)
+}
+
+// reloadConfig loads the configuration again and applies the settings that
+// can change at runtime: the log level and the rate limit policies. It
+// returns the configuration now in effect; on error nothing changes.
+func reloadConfig(cur appconfig.Config, args []string, rl *middleware.RateLimiter) appconfig.Config {
+	next, _, err := appconfig.Load(args)
+	if err != nil {
+		slog.Error("config reload failed, keeping current configuration", "error", err)
+		return cur
+	}
+	policies, err := loadRateLimitPolicies(next.RateLimit.PolicyFile)
+	if err != nil {
+		slog.Error("config reload failed, keeping current configuration", "error", err)
+		return cur
+	}
+
+	if err := logging.SetLevel(next.Log.Level); err != nil {
+		slog.Error("config reload failed, keeping current configuration", "error", err)
+		return cur
+	}
+	rl.SetPolicies(policies)
+	cur.Log = next.Log
+	cur.RateLimit.PolicyFile = next.RateLimit.PolicyFile
+
+	if changed := cur.RestartRequired(next); len(changed) > 0 {
+		slog.Warn("config reloaded, some changes need a restart", "settings", changed)
+	} else {
+		slog.Info("config reloaded")
+	}
+	return cur
 }
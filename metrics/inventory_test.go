@@ -0,0 +1,34 @@
+package metrics
+
+import (
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+func TestInventoryCollector_ExportsSnapshot(t *testing.T) {
+	c := &InventoryCollector{}
+	reg := prometheus.NewRegistry()
+	reg.MustRegister(c)
+
+	if families, err := reg.Gather(); err != nil || len(families) != 0 {
+		t.Fatalf("expected nothing before the first snapshot, got %d families (%v)", len(families), err)
+	}
+
+	c.Set(InventorySnapshot{Configs: 2, ConfigVersions: 5, MaxConfigVersions: 4})
+	families, err := reg.Gather()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	got := map[string]float64{}
+	for _, f := range families {
+		if len(f.GetMetric()) != 1 || len(f.GetMetric()[0].GetLabel()) != 0 {
+			t.Errorf("%s: expected one unlabeled series", f.GetName())
+		}
+		got[f.GetName()] = f.GetMetric()[0].GetGauge().GetValue()
+	}
+	if got["config_service_configs"] != 2 || got["config_service_config_versions"] != 5 || got["config_service_config_versions_max"] != 4 {
+		t.Errorf("unexpected values: %v", got)
+	}
+}
@@ -54,6 +54,121 @@ var (
 		[]string{"method", "endpoint"},
 	)
 
+	// Idempotency-Key pretrage: hit (zapis postoji) ili miss
+	IdempotencyLookupsTotal = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "config_service_idempotency_lookups_total",
+			Help: "Broj pretraga Idempotency-Key ključeva po rezultatu (hit, miss)",
+		},
+		[]string{"result"},
+	)
+
+	// Ishodi zahteva sa već viđenim ključem: replay, conflict, mismatch
+	IdempotencyOutcomesTotal = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "config_service_idempotency_outcomes_total",
+			Help: "Broj zahteva sa Idempotency-Key ključem koji nisu stigli do handlera, po ishodu",
+		},
+		[]string{"outcome"},
+	)
+
+	// Odbijeni zahtevi po rate limit politici i razlogu (local, shared, unavailable)
+	RateLimitRejectionsTotal = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "config_service_rate_limit_rejections_total",
+			Help: "Broj zahteva odbijenih zbog rate limita, po politici i razlogu",
+		},
+		[]string{"policy", "reason"},
+	)
+
+	// Trenutni limit adaptivnog concurrency limitera
+	ConcurrencyLimit = prometheus.NewGauge(
+		prometheus.GaugeOpts{
+			Name: "config_service_concurrency_limit",
+			Help: "Trenutni broj zahteva koji se mogu obrađivati istovremeno",
+		},
+	)
+
+	// Zahtevi odbačeni zbog preopterećenja, po vrsti (read, write)
+	LoadShedTotal = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "config_service_load_shed_total",
+			Help: "Broj zahteva odbijenih sa 503 zbog preopterećenja",
+		},
+		[]string{"kind"},
+	)
+
+	// Trajanje Consul KV operacija po operaciji i prefiksu ključa
+	ConsulKVDuration = prometheus.NewHistogramVec(
+		prometheus.HistogramOpts{
+			Name:    "config_service_consul_kv_duration_seconds",
+			Help:    "Trajanje Consul KV operacija u sekundama",
+			Buckets: []float64{.001, .0025, .005, .01, .025, .05, .1, .25, .5, 1, 2.5},
+		},
+		[]string{"operation", "prefix"},
+	)
+
+	// Neuspele Consul KV operacije
+	ConsulKVErrorsTotal = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "config_service_consul_kv_errors_total",
+			Help: "Broj Consul KV operacija koje su vratile grešku",
+		},
+		[]string{"operation", "prefix"},
+	)
+
+	// Dostupnost Consula (1 = dostupan)
+	ConsulUp = prometheus.NewGauge(
+		prometheus.GaugeOpts{
+			Name: "config_service_consul_up",
+			Help: "Da li je Consul dostupan (1) ili ne (0)",
+		},
+	)
+
+	// Ponovljeni pokušaji Consul čitanja
+	ConsulKVRetriesTotal = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "config_service_consul_kv_retries_total",
+			Help: "Broj ponovljenih Consul KV čitanja nakon prolazne greške",
+		},
+		[]string{"operation", "prefix"},
+	)
+
+	// Stanje circuit breaker-a (0 = zatvoren, 1 = poluotvoren, 2 = otvoren)
+	ConsulCircuitState = prometheus.NewGauge(
+		prometheus.GaugeOpts{
+			Name: "config_service_consul_circuit_state",
+			Help: "Stanje Consul circuit breaker-a (0 zatvoren, 1 poluotvoren, 2 otvoren)",
+		},
+	)
+
+	// Prelazi circuit breaker-a po novom stanju
+	ConsulCircuitTransitionsTotal = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "config_service_consul_circuit_transitions_total",
+			Help: "Broj prelaza Consul circuit breaker-a po novom stanju",
+		},
+		[]string{"state"},
+	)
+
+	// Kreiranja i brisanja konfiguracija po ishodu (success, error)
+	ConfigOperationsTotal = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "config_service_config_operations_total",
+			Help: "Broj kreiranja i brisanja konfiguracija po ishodu",
+		},
+		[]string{"operation", "outcome"},
+	)
+
+	// Brisanja po labelama po ishodu (deleted, no_match, forbidden, error)
+	LabelDeletesTotal = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "config_service_label_deletes_total",
+			Help: "Broj brisanja konfiguracija iz grupe po labelama, po ishodu",
+		},
+		[]string{"outcome"},
+	)
+
 	registry = prometheus.NewRegistry()
 )
 
@@ -64,9 +179,24 @@ func init() {
 		HttpRequestsFailed,
 		HttpResponseDuration,
 		HttpRequestsInFlight,
+		IdempotencyLookupsTotal,
+		IdempotencyOutcomesTotal,
+		RateLimitRejectionsTotal,
+		ConcurrencyLimit,
+		LoadShedTotal,
+		ConsulKVDuration,
+		ConsulKVErrorsTotal,
+		ConsulUp,
+		ConsulKVRetriesTotal,
+		ConsulCircuitState,
+		ConsulCircuitTransitionsTotal,
+		Inventory,
+		ConfigOperationsTotal,
+		LabelDeletesTotal,
 	)
 }
 
 func MetricsHandler() http.Handler {
-	return promhttp.HandlerFor(registry, promhttp.HandlerOpts{})
+	// OpenMetrics format je potreban da bi Prometheus preuzeo exemplar-e
+	return promhttp.HandlerFor(registry, promhttp.HandlerOpts{EnableOpenMetrics: true})
 }
@@ -0,0 +1,51 @@
+package middleware
+
+import (
+	"log/slog"
+	"net/http"
+	"time"
+
+	"github.com/anjaobradovic/ars-sit-2025/logging"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// probePath reports whether a path is polled by Prometheus or load
+// balancers rather than called by clients.
+func probePath(p string) bool {
+	return p == "/metrics" || p == "/healthz" || p == "/livez" || p == "/readyz"
+}
+
+// AccessLogMiddleware logs one line per request with the route, status,
+// response size and duration. Scrapes and health checks are logged at debug
+// level.
+func AccessLogMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+		rw := &responseWriter{ResponseWriter: w, statusCode: http.StatusOK}
+
+		ctx := r.Context()
+		trace.SpanFromContext(ctx).SetAttributes(attribute.String("http.request_id", logging.RequestIDFromContext(ctx)))
+
+		next.ServeHTTP(rw, r)
+
+		level := slog.LevelInfo
+		switch {
+		case rw.statusCode >= 500:
+			level = slog.LevelError
+		case probePath(r.URL.Path):
+			level = slog.LevelDebug
+		}
+
+		slog.Log(ctx, level, "http request",
+			"method", r.Method,
+			"route", getEndpointPattern(r),
+			"path", r.URL.Path,
+			"status", rw.statusCode,
+			"size", rw.size,
+			"duration_ms", float64(time.Since(start).Microseconds())/1000,
+			"client_ip", ClientIPFromContext(ctx),
+			"user_agent", r.UserAgent(),
+		)
+	})
+}
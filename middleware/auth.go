@@ -0,0 +1,71 @@
+package middleware
+
+import (
+	"errors"
+	"log/slog"
+	"net/http"
+	"strings"
+
+	"github.com/anjaobradovic/ars-sit-2025/auth"
+	"github.com/anjaobradovic/ars-sit-2025/services"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// credential extracts an API key or bearer token from the request.
+func credential(r *http.Request) string {
+	if key := strings.TrimSpace(r.Header.Get("X-API-Key")); key != "" {
+		return key
+	}
+	authz := r.Header.Get("Authorization")
+	if len(authz) > 7 && strings.EqualFold(authz[:7], "Bearer ") {
+		return strings.TrimSpace(authz[7:])
+	}
+	return ""
+}
+
+func unauthorized(w http.ResponseWriter, msg string) {
+	w.Header().Set("WWW-Authenticate", `Bearer realm="config-service"`)
+	http.Error(w, msg, http.StatusUnauthorized)
+}
+
+// AuthMiddleware authenticates every request and stores the principal in the
+// request context. Requests without credentials are rejected unless
+// allowAnonymous is set, in which case they run as auth.Anonymous.
+func AuthMiddleware(authService *services.AuthService, allowAnonymous bool) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			cred := credential(r)
+
+			var principal *auth.Principal
+			if cred == "" {
+				if !allowAnonymous {
+					unauthorized(w, "authentication required")
+					return
+				}
+				principal = auth.Anonymous
+			} else {
+				p, err := authService.Authenticate(r.Context(), cred)
+				if errors.Is(err, services.ErrUnauthenticated) {
+					unauthorized(w, err.Error())
+					return
+				}
+				if err != nil {
+					slog.ErrorContext(r.Context(), "auth: cannot authenticate request", "error", err)
+					http.Error(w, "authentication backend unavailable", http.StatusServiceUnavailable)
+					return
+				}
+				principal = p
+			}
+
+			trace.SpanFromContext(r.Context()).SetAttributes(
+				attribute.String("enduser.id", principal.Subject),
+				attribute.String("enduser.role", strings.Join(principal.Roles, ",")),
+				attribute.String("auth.method", principal.Method),
+			)
+
+			next.ServeHTTP(w, r.WithContext(auth.WithPrincipal(r.Context(), principal)))
+		})
+	}
+}
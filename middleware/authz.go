@@ -0,0 +1,85 @@
+package middleware
+
+import (
+	"log/slog"
+	"net/http"
+	"strings"
+
+	"github.com/anjaobradovic/ars-sit-2025/auth"
+	"github.com/anjaobradovic/ars-sit-2025/services"
+	"github.com/gorilla/mux"
+)
+
+// routeAccess is what a route requires. When exact is false only the kind is
+// checked here and the handler checks the concrete resource later, because
+// its name is in the request body.
+type routeAccess struct {
+	perm     auth.Permission
+	resource auth.Resource
+	exact    bool
+	open     bool
+}
+
+// accessFor maps a request to the permission and resource it needs.
+// Reads need read, everything else write; routes outside configs and groups
+// are administrative.
+func accessFor(r *http.Request) routeAccess {
+	perm := auth.PermWrite
+	if r.Method == http.MethodGet || r.Method == http.MethodHead {
+		perm = auth.PermRead
+	}
+	name := mux.Vars(r)["name"]
+
+	switch tpl := getEndpointPattern(r); {
+	case tpl == "/auth/whoami":
+		return routeAccess{open: true}
+	case tpl == "/configs":
+		return routeAccess{perm: perm, resource: auth.Resource{Kind: auth.KindConfig}}
+	case strings.HasPrefix(tpl, "/configs/"):
+		return routeAccess{perm: perm, resource: auth.Resource{Kind: auth.KindConfig, Name: name}, exact: true}
+	case tpl == "/groups":
+		return routeAccess{perm: perm, resource: auth.Resource{Kind: auth.KindGroup}}
+	case tpl == "/groups/{name}/versions/{version}":
+		return routeAccess{perm: perm, resource: auth.Resource{Kind: auth.KindGroup, Name: name}, exact: true}
+	case strings.HasPrefix(tpl, "/groups/"):
+		return routeAccess{perm: perm, resource: auth.Resource{Kind: auth.KindGroup, Name: name, Membership: true}, exact: true}
+	default:
+		return routeAccess{perm: auth.PermAdmin, resource: auth.Resource{Kind: auth.KindSystem}, exact: true}
+	}
+}
+
+// AuthorizationMiddleware resolves the caller's grants, stores them in the
+// request context for handlers and services, and rejects requests the grants
+// cannot possibly allow. It must run after AuthMiddleware.
+func AuthorizationMiddleware(authz *services.AuthzService) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			p, ok := auth.FromContext(r.Context())
+			if !ok {
+				unauthorized(w, "authentication required")
+				return
+			}
+
+			grants, err := authz.Grants(r.Context(), p)
+			if err != nil {
+				slog.ErrorContext(r.Context(), "authz: cannot load role bindings", "error", err)
+				http.Error(w, "authorization backend unavailable", http.StatusServiceUnavailable)
+				return
+			}
+
+			access := accessFor(r)
+			allowed := access.open
+			if !allowed && access.exact {
+				allowed = grants.Allows(access.perm, access.resource)
+			} else if !allowed {
+				allowed = grants.AllowsKind(access.perm, access.resource.Kind)
+			}
+			if !allowed {
+				http.Error(w, "forbidden", http.StatusForbidden)
+				return
+			}
+
+			next.ServeHTTP(w, r.WithContext(auth.WithGrants(r.Context(), grants)))
+		})
+	}
+}
@@ -0,0 +1,178 @@
+package middleware
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/http"
+	"strings"
+)
+
+// TrustedProxies are the networks whose forwarding headers are believed.
+type TrustedProxies []*net.IPNet
+
+// ParseTrustedProxies parses a comma-separated list of CIDRs or plain IPs.
+func ParseTrustedProxies(list string) (TrustedProxies, error) {
+	var out TrustedProxies
+	for _, raw := range strings.Split(list, ",") {
+		raw = strings.TrimSpace(raw)
+		if raw == "" {
+			continue
+		}
+		if !strings.Contains(raw, "/") {
+			ip := net.ParseIP(raw)
+			if ip == nil {
+				return nil, fmt.Errorf("trusted proxies: invalid address %q", raw)
+			}
+			bits := 8 * net.IPv6len
+			if ip.To4() != nil {
+				ip, bits = ip.To4(), 8*net.IPv4len
+			}
+			out = append(out, &net.IPNet{IP: ip, Mask: net.CIDRMask(bits, bits)})
+			continue
+		}
+		_, n, err := net.ParseCIDR(raw)
+		if err != nil {
+			return nil, fmt.Errorf("trusted proxies: %w", err)
+		}
+		out = append(out, n)
+	}
+	return out, nil
+}
+
+// Forwarding headers the trusted proxies may set. Exactly one is read: a
+// proxy only overwrites or appends to its own header, so a client could put
+// anything into the other one.
+const (
+	HeaderXForwardedFor = "X-Forwarded-For"
+	HeaderForwarded     = "Forwarded"
+)
+
+// ParseForwardingHeader validates the configured header name.
+func ParseForwardingHeader(name string) (string, error) {
+	switch {
+	case strings.EqualFold(name, HeaderXForwardedFor):
+		return HeaderXForwardedFor, nil
+	case strings.EqualFold(name, HeaderForwarded):
+		return HeaderForwarded, nil
+	}
+	return "", fmt.Errorf("forwarding header must be %s or %s, got %q", HeaderXForwardedFor, HeaderForwarded, name)
+}
+
+func (t TrustedProxies) trusts(ip net.IP) bool {
+	for _, n := range t {
+		if n.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// ClientIP derives the address of the real client. The forwarding header,
+// X-Forwarded-For or Forwarded (RFC 7239), is only read when the direct peer
+// is a trusted proxy, and then walked from the nearest hop outwards: the
+// first address not belonging to a trusted proxy is the client. The other
+// header is never looked at.
+func (t TrustedProxies) ClientIP(r *http.Request, header string) string {
+	peer := r.RemoteAddr
+	if host, _, err := net.SplitHostPort(peer); err == nil {
+		peer = host
+	}
+
+	peerIP := net.ParseIP(peer)
+	if peerIP == nil || !t.trusts(peerIP) {
+		return peer
+	}
+
+	var hops []string
+	if header == HeaderForwarded {
+		hops = forwardedFor(r.Header.Values(HeaderForwarded))
+	} else {
+		hops = xForwardedFor(r.Header.Values(HeaderXForwardedFor))
+	}
+
+	client := peer
+	for i := len(hops) - 1; i >= 0; i-- {
+		ip := net.ParseIP(hops[i])
+		if ip == nil {
+			// Obfuscated or "unknown" hop: nothing past it can be trusted
+			break
+		}
+		client = ip.String()
+		if !t.trusts(ip) {
+			break
+		}
+	}
+	return client
+}
+
+// xForwardedFor returns the addresses of X-Forwarded-For headers, client first.
+func xForwardedFor(values []string) []string {
+	var hops []string
+	for _, v := range values {
+		for _, part := range strings.Split(v, ",") {
+			if part = strings.TrimSpace(part); part != "" {
+				hops = append(hops, stripPort(part))
+			}
+		}
+	}
+	return hops
+}
+
+// forwardedFor returns the for= addresses of Forwarded headers, client first.
+func forwardedFor(values []string) []string {
+	var hops []string
+	for _, v := range values {
+		for _, elem := range strings.Split(v, ",") {
+			for _, pair := range strings.Split(elem, ";") {
+				k, val, ok := strings.Cut(strings.TrimSpace(pair), "=")
+				if !ok || !strings.EqualFold(k, "for") {
+					continue
+				}
+				hops = append(hops, stripPort(strings.Trim(val, `"`)))
+			}
+		}
+	}
+	return hops
+}
+
+// stripPort removes the port from "1.2.3.4:80" and "[::1]:80", and the
+// brackets from "[::1]".
+func stripPort(addr string) string {
+	if host, _, err := net.SplitHostPort(addr); err == nil {
+		return host
+	}
+	return strings.TrimSuffix(strings.TrimPrefix(addr, "["), "]")
+}
+
+type clientIPKey struct{}
+
+// ClientIPFromContext returns the address stored by ClientIPMiddleware.
+func ClientIPFromContext(ctx context.Context) string {
+	ip, _ := ctx.Value(clientIPKey{}).(string)
+	return ip
+}
+
+// clientIP returns the derived client address of r, falling back to the
+// direct peer when ClientIPMiddleware did not run.
+func clientIP(r *http.Request) string {
+	if ip := ClientIPFromContext(r.Context()); ip != "" {
+		return ip
+	}
+	if host, _, err := net.SplitHostPort(r.RemoteAddr); err == nil {
+		return host
+	}
+	return r.RemoteAddr
+}
+
+// ClientIPMiddleware stores the real client address in the request context
+// for the rate limiter, audit log and access log. It must run first. header
+// is the forwarding header the trusted proxies set.
+func ClientIPMiddleware(trusted TrustedProxies, header string) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			ctx := context.WithValue(r.Context(), clientIPKey{}, trusted.ClientIP(r, header))
+			next.ServeHTTP(w, r.WithContext(ctx))
+		})
+	}
+}
@@ -0,0 +1,60 @@
+package middleware
+
+import (
+	"net/http/httptest"
+	"testing"
+)
+
+func TestTrustedProxies_ClientIP(t *testing.T) {
+	trusted, err := ParseTrustedProxies("10.0.0.0/8, 192.168.1.1")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	cases := []struct {
+		name, remote, header, value, want string
+	}{
+		{"untrusted peer ignores headers", "203.0.113.9:1234", "X-Forwarded-For", "1.2.3.4", "203.0.113.9"},
+		{"trusted peer", "10.0.0.5:1234", "X-Forwarded-For", "1.2.3.4", "1.2.3.4"},
+		{"spoofed left entry", "10.0.0.5:1234", "X-Forwarded-For", "6.6.6.6, 1.2.3.4, 192.168.1.1", "1.2.3.4"},
+		{"other header is ignored", "10.0.0.5:1234", "Forwarded", `for=1.2.3.4`, "10.0.0.5"},
+		{"no header", "10.0.0.5:1234", "", "", "10.0.0.5"},
+	}
+	for _, c := range cases {
+		req := httptest.NewRequest("GET", "/configs", nil)
+		req.RemoteAddr = c.remote
+		if c.header != "" {
+			req.Header.Set(c.header, c.value)
+		}
+		if got := trusted.ClientIP(req, HeaderXForwardedFor); got != c.want {
+			t.Errorf("%s: expected %s, got %s", c.name, c.want, got)
+		}
+	}
+}
+
+func TestTrustedProxies_ForwardedHeader(t *testing.T) {
+	trusted, _ := ParseTrustedProxies("10.0.0.0/8")
+
+	req := httptest.NewRequest("GET", "/configs", nil)
+	req.RemoteAddr = "10.0.0.5:1234"
+	req.Header.Set("Forwarded", `for="[2001:db8::1]:4711";proto=https`)
+	req.Header.Set("X-Forwarded-For", "6.6.6.6")
+	if got := trusted.ClientIP(req, HeaderForwarded); got != "2001:db8::1" {
+		t.Errorf("expected 2001:db8::1, got %s", got)
+	}
+}
+
+func TestTrustedProxies_InjectedForwardedBehindXFFProxy(t *testing.T) {
+	trusted, _ := ParseTrustedProxies("10.0.0.0/8")
+
+	// The client forges Forwarded; the proxy only appends the real address
+	// to X-Forwarded-For and passes Forwarded through untouched.
+	req := httptest.NewRequest("GET", "/configs", nil)
+	req.RemoteAddr = "10.0.0.5:1234"
+	req.Header.Set("Forwarded", "for=1.2.3.4")
+	req.Header.Set("X-Forwarded-For", "203.0.113.9")
+
+	if got := trusted.ClientIP(req, HeaderXForwardedFor); got != "203.0.113.9" {
+		t.Errorf("expected the address appended by the proxy, got %s", got)
+	}
+}
@@ -0,0 +1,161 @@
+package middleware
+
+import (
+	"encoding/json"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/anjaobradovic/ars-sit-2025/metrics"
+	"github.com/anjaobradovic/ars-sit-2025/model"
+)
+
+// ConcurrencyLimiterConfig tunes the adaptive concurrency limiter.
+type ConcurrencyLimiterConfig struct {
+	// InitialLimit, MinLimit and MaxLimit bound the number of requests
+	// served at the same time.
+	InitialLimit int
+	MinLimit     int
+	MaxLimit     int
+
+	// TargetLatency is the latency above which the service counts as
+	// overloaded and the limit is cut.
+	TargetLatency time.Duration
+
+	// WriteShare is the part of the limit writes may use; the rest is kept
+	// for reads, so reads keep working when writes pile up.
+	WriteShare float64
+}
+
+var DefaultConcurrencyLimiterConfig = ConcurrencyLimiterConfig{
+	InitialLimit:  100,
+	MinLimit:      4,
+	MaxLimit:      1000,
+	TargetLatency: 250 * time.Millisecond,
+	WriteShare:    0.75,
+}
+
+// AIMD steps: every fast request adds 1/limit (so the limit grows by one per
+// limit requests) and a slow or failed one cuts it by decreaseFactor. Only
+// requests that started after the last cut can cut it again, so a burst of
+// slow requests sent under the old limit counts once.
+const concurrencyDecreaseFactor = 0.9
+
+// ConcurrencyLimiter sheds load with 503 once more requests are in flight
+// than the service currently copes with. The limit adapts (additive increase,
+// multiplicative decrease) to the latency MetricsMiddleware observes.
+type ConcurrencyLimiter struct {
+	mu           sync.Mutex
+	cfg          ConcurrencyLimiterConfig
+	limit        float64
+	inFlight     int
+	lastDecrease time.Time
+	now          func() time.Time
+}
+
+// NewConcurrencyLimiter creates the limiter and subscribes it to the latency
+// measured by MetricsMiddleware.
+func NewConcurrencyLimiter(cfg ConcurrencyLimiterConfig) *ConcurrencyLimiter {
+	cl := &ConcurrencyLimiter{cfg: cfg, limit: float64(cfg.InitialLimit), now: time.Now}
+	metrics.ConcurrencyLimit.Set(cl.limit)
+	ObserveLatency(cl.observe)
+	return cl
+}
+
+func isWrite(r *http.Request) bool {
+	return r.Method != http.MethodGet && r.Method != http.MethodHead && r.Method != http.MethodOptions
+}
+
+// acquire admits a request if there is room for its kind.
+func (cl *ConcurrencyLimiter) acquire(write bool) bool {
+	cl.mu.Lock()
+	defer cl.mu.Unlock()
+
+	limit := cl.limit
+	if write {
+		limit *= cl.cfg.WriteShare
+	}
+	if float64(cl.inFlight) >= limit {
+		return false
+	}
+	cl.inFlight++
+	return true
+}
+
+func (cl *ConcurrencyLimiter) release() {
+	cl.mu.Lock()
+	cl.inFlight--
+	cl.mu.Unlock()
+}
+
+// observe adapts the limit to one latency sample. Requests rejected by the
+// rate limiter did no work and tell nothing about the load.
+func (cl *ConcurrencyLimiter) observe(_ *http.Request, status int, latency time.Duration) {
+	if status == http.StatusTooManyRequests {
+		return
+	}
+
+	cl.mu.Lock()
+	defer cl.mu.Unlock()
+
+	now := cl.now()
+	switch {
+	case latency <= cl.cfg.TargetLatency && status < http.StatusInternalServerError:
+		cl.limit += 1 / cl.limit
+	case !now.Add(-latency).Before(cl.lastDecrease):
+		cl.limit *= concurrencyDecreaseFactor
+		cl.lastDecrease = now
+	}
+
+	if cl.limit < float64(cl.cfg.MinLimit) {
+		cl.limit = float64(cl.cfg.MinLimit)
+	}
+	if cl.limit > float64(cl.cfg.MaxLimit) {
+		cl.limit = float64(cl.cfg.MaxLimit)
+	}
+	metrics.ConcurrencyLimit.Set(cl.limit)
+}
+
+// blockingRoutes are the reads that accept ?index= long-polls.
+var blockingRoutes = map[string]bool{
+	"/configs/{name}/versions/{version}": true,
+	"/groups/{name}/versions/{version}":  true,
+}
+
+// isBlockingRead reports a long-poll GET on one of the blocking routes. Any
+// other request with ?index= is admitted like the rest.
+func isBlockingRead(r *http.Request) bool {
+	return r.Method == http.MethodGet && r.URL.Query().Get("index") != "" && blockingRoutes[getEndpointPattern(r)]
+}
+
+// Middleware must run inside MetricsMiddleware so the latency it reports
+// feeds the limit. Only admitted requests are sampled.
+func (cl *ConcurrencyLimiter) Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// Blocking queries wait on purpose; they neither take a slot nor
+		// count as slow.
+		if isBlockingRead(r) {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		write := isWrite(r)
+		if !cl.acquire(write) {
+			kind := "read"
+			if write {
+				kind = "write"
+			}
+			metrics.LoadShedTotal.WithLabelValues(kind).Inc()
+
+			w.Header().Set("Content-Type", "application/json")
+			w.Header().Set("Retry-After", "1")
+			w.WriteHeader(http.StatusServiceUnavailable)
+			_ = json.NewEncoder(w).Encode(model.ErrorResponse{Message: "service overloaded, retry later"})
+			return
+		}
+		defer cl.release()
+
+		sampleLatency(r.Context())
+		next.ServeHTTP(w, r)
+	})
+}
@@ -0,0 +1,102 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gorilla/mux"
+)
+
+func TestConcurrencyLimiter_ShedsWritesBeforeReads(t *testing.T) {
+	cl := &ConcurrencyLimiter{cfg: ConcurrencyLimiterConfig{WriteShare: 0.5}, limit: 2}
+
+	if !cl.acquire(true) {
+		t.Fatal("expected first write to be admitted")
+	}
+	if cl.acquire(true) {
+		t.Fatal("expected second write to be shed at half the limit")
+	}
+	if !cl.acquire(false) {
+		t.Fatal("expected read to use the remaining capacity")
+	}
+}
+
+func TestConcurrencyLimiter_OneDecreasePerWindow(t *testing.T) {
+	now := time.Unix(100, 0)
+	cl := &ConcurrencyLimiter{
+		cfg:   ConcurrencyLimiterConfig{MinLimit: 1, MaxLimit: 1000, TargetLatency: 100 * time.Millisecond},
+		limit: 100,
+		now:   func() time.Time { return now },
+	}
+
+	// A burst of slow requests that all started before the first cut
+	for i := 0; i < 10; i++ {
+		cl.observe(nil, http.StatusOK, time.Second)
+	}
+	if cl.limit != 90 {
+		t.Fatalf("limit = %v after one slow burst, want 90", cl.limit)
+	}
+
+	// Rejected requests say nothing about the load
+	cl.observe(nil, http.StatusTooManyRequests, time.Millisecond)
+	if cl.limit != 90 {
+		t.Fatalf("limit = %v after a 429, want 90", cl.limit)
+	}
+
+	// A request sent after the cut may cut again
+	now = now.Add(2 * time.Second)
+	cl.observe(nil, http.StatusOK, time.Second)
+	if cl.limit != 81 {
+		t.Fatalf("limit = %v after a later slow request, want 81", cl.limit)
+	}
+}
+
+func TestConcurrencyLimiter_SamplesOnlyAdmittedRequests(t *testing.T) {
+	var sampled []string
+	latencyObservers = []LatencyObserver{func(r *http.Request, _ int, _ time.Duration) {
+		sampled = append(sampled, r.URL.Path)
+	}}
+	t.Cleanup(func() { latencyObservers = nil })
+
+	cl := &ConcurrencyLimiter{cfg: ConcurrencyLimiterConfig{WriteShare: 1}, limit: 10, now: time.Now}
+	ok := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {})
+
+	router := mux.NewRouter()
+	router.Use(MetricsMiddleware)
+	router.Handle("/metrics", ok)
+	router.Handle("/configs", cl.Middleware(ok))
+
+	for _, path := range []string{"/metrics", "/configs"} {
+		router.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", path, nil))
+	}
+	if len(sampled) != 1 || sampled[0] != "/configs" {
+		t.Errorf("sampled %v, want only /configs", sampled)
+	}
+}
+
+func TestIsBlockingRead(t *testing.T) {
+	router := mux.NewRouter()
+	var got bool
+	record := func(w http.ResponseWriter, r *http.Request) { got = isBlockingRead(r) }
+	router.HandleFunc("/configs/{name}/versions/{version}", record).Methods("GET", "DELETE")
+	router.HandleFunc("/configs", record).Methods("GET")
+
+	cases := []struct {
+		method, target string
+		want           bool
+	}{
+		{"GET", "/configs/db/versions/v1?index=3", true},
+		{"GET", "/configs/db/versions/v1", false},
+		{"DELETE", "/configs/db/versions/v1?index=3", false},
+		{"GET", "/configs?index=3", false},
+	}
+	for _, c := range cases {
+		got = false
+		router.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(c.method, c.target, nil))
+		if got != c.want {
+			t.Errorf("%s %s: isBlockingRead = %v, want %v", c.method, c.target, got, c.want)
+		}
+	}
+}
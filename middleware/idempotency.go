@@ -2,15 +2,23 @@ package middleware
 
 import (
 	"bytes"
-	"encoding/json"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
 	"fmt"
 	"io"
-	"log"
+	"log/slog"
 	"net/http"
 	"net/http/httptest"
+	"net/url"
+	"time"
 
+	"github.com/anjaobradovic/ars-sit-2025/auth"
+	"github.com/anjaobradovic/ars-sit-2025/consulkv"
+	"github.com/anjaobradovic/ars-sit-2025/metrics"
 	"github.com/anjaobradovic/ars-sit-2025/model"
-	"github.com/hashicorp/consul/api"
+	"github.com/anjaobradovic/ars-sit-2025/repositories"
 
 	"go.opentelemetry.io/otel"
 	"go.opentelemetry.io/otel/attribute"
@@ -19,8 +27,76 @@ import (
 
 var idempoTracer = otel.Tracer("middleware/idempotency")
 
-// IdempotencyMiddleware obezbeđuje idempotent operacije koristeći Consul kao storage
-func IdempotencyMiddleware(consulClient *api.Client) func(http.Handler) http.Handler {
+// requestFingerprint identifies the request an Idempotency-Key was first used
+// with: a hash of method, path, query and body. The query is canonicalized
+// (sorted keys, standard escaping), so only its meaning counts.
+func requestFingerprint(r *http.Request, body []byte) string {
+	h := sha256.New()
+	h.Write([]byte(r.Method))
+	h.Write([]byte{0})
+	h.Write([]byte(r.URL.Path))
+	h.Write([]byte{0})
+	h.Write([]byte(r.URL.Query().Encode()))
+	h.Write([]byte{0})
+	h.Write(body)
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// idempotencyStoreKey scopes keys per authenticated client, so two callers
+// choosing the same key never see each other's responses.
+func idempotencyStoreKey(subject, key string) string {
+	return fmt.Sprintf("%s/%s", url.PathEscape(subject), url.PathEscape(key))
+}
+
+// IdempotentReplayedHeader marks a response served from the idempotency
+// store instead of by the handler.
+const IdempotentReplayedHeader = "Idempotent-Replayed"
+
+// replayedHeaders are the response headers stored with a completed request.
+var replayedHeaders = []string{"Content-Type", "Location", "ETag", "Last-Modified", "X-Config-Index"}
+
+func replayableHeaders(h http.Header) map[string][]string {
+	out := map[string][]string{}
+	for _, name := range replayedHeaders {
+		if v := h.Values(name); len(v) > 0 {
+			out[name] = v
+		}
+	}
+	return out
+}
+
+// replayResponse writes a stored response back as the handler produced it.
+func replayResponse(w http.ResponseWriter, record model.IdempotencyRecord) {
+	for k, v := range record.Headers {
+		w.Header()[k] = v
+	}
+	if record.Headers == nil {
+		// Zapisi pre čuvanja zaglavlja su uvek bili JSON
+		w.Header().Set("Content-Type", "application/json")
+	}
+	w.Header().Set(IdempotentReplayedHeader, "true")
+	w.WriteHeader(record.StatusCode)
+	_, _ = w.Write([]byte(record.Body))
+}
+
+// IdempotencyConfig controls how long idempotency records live.
+type IdempotencyConfig struct {
+	// TTL is how long a completed response is kept for replay.
+	TTL time.Duration
+	// Lease is how long a request may stay in progress before another
+	// request with the same key may take it over.
+	Lease time.Duration
+}
+
+// DefaultIdempotencyConfig keeps responses for a day and reclaims keys whose
+// request has not finished within a minute.
+var DefaultIdempotencyConfig = IdempotencyConfig{
+	TTL:   24 * time.Hour,
+	Lease: time.Minute,
+}
+
+// IdempotencyMiddleware obezbeđuje idempotent operacije; zapisi se čuvaju u store-u
+func IdempotencyMiddleware(store repositories.IdempotencyStore, cfg IdempotencyConfig) func(http.Handler) http.Handler {
 	return func(next http.Handler) http.Handler {
 		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 			// Start span odmah, da pokrije cijeli middleware flow
@@ -38,95 +114,85 @@ func IdempotencyMiddleware(consulClient *api.Client) func(http.Handler) http.Han
 				return
 			}
 
-			kv := consulClient.KV()
-			keyPath := fmt.Sprintf("idempotency/%s", idempotencyKey)
-			span.SetAttributes(attribute.String("consul.key", keyPath))
-
-			// 1) Proveri da li ključ već postoji (consul get)
-			var pair *api.KVPair
-			{
-				_, s := idempoTracer.Start(ctx, "consul.kv.get")
-				s.SetAttributes(attribute.String("consul.key", keyPath))
-				var err error
-				pair, _, err = kv.Get(keyPath, nil)
-				if err != nil {
-					s.RecordError(err)
-					s.SetStatus(codes.Error, "consul get failed")
-					s.End()
-					http.Error(w, "Failed to connect to Consul", http.StatusInternalServerError)
-					return
-				}
-				s.End()
+			// 1) Pročitaj body i resetuj r.Body da se može ponovo čitati
+			bodyBytes, err := io.ReadAll(r.Body)
+			if err != nil {
+				span.RecordError(err)
+				span.SetStatus(codes.Error, "failed to read request body")
+				http.Error(w, "Failed to read request body", http.StatusInternalServerError)
+				return
 			}
+			r.Body = io.NopCloser(bytes.NewReader(bodyBytes))
 
-			if pair != nil {
-				var record model.IdempotencyRecord
-				if err := json.Unmarshal(pair.Value, &record); err != nil {
-					span.RecordError(err)
-					span.SetStatus(codes.Error, "failed to unmarshal stored record")
-					http.Error(w, "Failed to parse stored record", http.StatusInternalServerError)
-					return
-				}
+			fingerprint := requestFingerprint(r, bodyBytes)
 
-				// Ako je završen, vrati keširani odgovor
-				if record.Status == model.StatusCompleted {
-					w.Header().Set("Content-Type", "application/json")
-					w.WriteHeader(record.StatusCode)
-					_, _ = w.Write([]byte(record.Body))
-					return
-				}
+			storeKey := idempotencyStoreKey(auth.SubjectFromContext(ctx), idempotencyKey)
 
-				// Ako je u toku, odbaci novi zahtev
-				if record.Status == model.StatusInProgress {
+			// 2) Proveri da li ključ već postoji
+			record, version, err := store.Get(ctx, storeKey)
+			if err != nil {
+				span.RecordError(err)
+				span.SetStatus(codes.Error, "idempotency store get failed")
+				http.Error(w, "Failed to read idempotency record", storeErrorStatus(err))
+				return
+			}
+
+			// Istekao zapis (ili napušten "in_progress") se preuzima
+			if record != nil && record.Expired(time.Now()) {
+				span.SetAttributes(attribute.Bool("idempotency.reclaimed", true))
+				record = nil
+			}
+
+			if record == nil {
+				metrics.IdempotencyLookupsTotal.WithLabelValues("miss").Inc()
+			} else {
+				metrics.IdempotencyLookupsTotal.WithLabelValues("hit").Inc()
+
+				switch {
+				case record.Fingerprint != "" && record.Fingerprint != fingerprint:
+					// Isti ključ sa drugačijim zahtevom je greška klijenta
+					metrics.IdempotencyOutcomesTotal.WithLabelValues("mismatch").Inc()
+					span.SetStatus(codes.Error, "idempotency key reused with a different request")
+					http.Error(w, "Idempotency-Key was already used with a different request.", http.StatusUnprocessableEntity)
+					return
+				case record.Status == model.StatusCompleted:
+					// Ako je završen, vrati keširani odgovor
+					metrics.IdempotencyOutcomesTotal.WithLabelValues("replay").Inc()
+					replayResponse(w, *record)
+					return
+				default:
+					// Ako je u toku, odbaci novi zahtev
+					metrics.IdempotencyOutcomesTotal.WithLabelValues("conflict").Inc()
 					http.Error(w, "Request with this idempotency key is already in progress.", http.StatusConflict)
 					return
 				}
 			}
 
-			// 2) Pročitaj body i resetuj r.Body da se može ponovo čitati
-			bodyBytes, err := io.ReadAll(r.Body)
+			// 3) Kreiraj placeholder za zahtev u toku
+			now := time.Now().UTC()
+			placeholder := model.IdempotencyRecord{
+				Status:      model.StatusInProgress,
+				Fingerprint: fingerprint,
+				CreatedAt:   now,
+				ExpiresAt:   now.Add(cfg.Lease),
+			}
+			owner, reserved, err := store.Reserve(ctx, storeKey, placeholder, version)
 			if err != nil {
 				span.RecordError(err)
-				span.SetStatus(codes.Error, "failed to read request body")
-				http.Error(w, "Failed to read request body", http.StatusInternalServerError)
+				span.SetStatus(codes.Error, "idempotency store reserve failed")
+				http.Error(w, "Failed to write idempotency record", storeErrorStatus(err))
 				return
 			}
-			r.Body = io.NopCloser(bytes.NewReader(bodyBytes))
-
-			// 3) Kreiraj placeholder za zahtev u toku (consul cas)
-			placeholder := &model.IdempotencyRecord{Status: model.StatusInProgress}
-			placeholderJSON, _ := json.Marshal(placeholder)
-			p := &api.KVPair{Key: keyPath, Value: placeholderJSON, CreateIndex: 0}
-
-			{
-				_, s := idempoTracer.Start(ctx, "consul.kv.cas")
-				s.SetAttributes(attribute.String("consul.key", keyPath))
-				success, _, err := kv.CAS(p, nil)
-				if err != nil {
-					s.RecordError(err)
-					s.SetStatus(codes.Error, "consul cas failed")
-					s.End()
-					http.Error(w, "Failed to write to Consul", http.StatusInternalServerError)
-					return
-				}
-				if !success {
-					s.SetStatus(codes.Error, "cas not successful (concurrent request)")
-					s.End()
-					http.Error(w, "A concurrent request with the same idempotency key is in progress.", http.StatusConflict)
-					return
-				}
-				s.End()
+			if !reserved {
+				metrics.IdempotencyOutcomesTotal.WithLabelValues("conflict").Inc()
+				http.Error(w, "A concurrent request with the same idempotency key is in progress.", http.StatusConflict)
+				return
 			}
 
 			// Ako handler panikuje, obriši key da se ne zaglavi "in_progress"
 			defer func() {
 				if rec := recover(); rec != nil {
-					{
-						_, s := idempoTracer.Start(ctx, "consul.kv.delete")
-						s.SetAttributes(attribute.String("consul.key", keyPath))
-						_, _ = kv.Delete(keyPath, nil)
-						s.End()
-					}
+					_, _ = store.Release(ctx, storeKey, owner)
 					panic(rec)
 				}
 			}()
@@ -137,36 +203,31 @@ func IdempotencyMiddleware(consulClient *api.Client) func(http.Handler) http.Han
 			rec := httptest.NewRecorder()
 			next.ServeHTTP(rec, r)
 
-			// 5) Sačuvaj finalni odgovor ako je uspešan (consul put) / ili obriši key (delete)
+			// 5) Sačuvaj finalni odgovor ako je uspešan / ili obriši key
 			if rec.Code >= 200 && rec.Code < 300 {
 				finalRecord := model.IdempotencyRecord{
-					Status:     model.StatusCompleted,
-					StatusCode: rec.Code,
-					Body:       rec.Body.String(),
+					Status:      model.StatusCompleted,
+					StatusCode:  rec.Code,
+					Body:        rec.Body.String(),
+					Headers:     replayableHeaders(rec.Header()),
+					Fingerprint: fingerprint,
+					Owner:       owner,
+					CreatedAt:   now,
+					ExpiresAt:   time.Now().UTC().Add(cfg.TTL),
 				}
-				finalJSON, _ := json.Marshal(finalRecord)
-				finalPair := &api.KVPair{Key: keyPath, Value: finalJSON}
-
-				{
-					_, s := idempoTracer.Start(ctx, "consul.kv.put")
-					s.SetAttributes(attribute.String("consul.key", keyPath))
-					if _, err := kv.Put(finalPair, nil); err != nil {
-						s.RecordError(err)
-						s.SetStatus(codes.Error, "consul put failed")
-						s.End()
-						log.Printf("ERROR: Failed to save final response for key '%s': %v", idempotencyKey, err)
-					} else {
-						s.End()
-						log.Printf("Saved final response for key '%s'", idempotencyKey)
-					}
+				// Lease je mogao da istekne i ključ da preuzme drugi zahtev;
+				// tada se njegov zapis ne dira
+				saved, err := store.Complete(ctx, storeKey, owner, finalRecord)
+				switch {
+				case err != nil:
+					slog.ErrorContext(ctx, "idempotency: cannot save final response", "key", idempotencyKey, "error", err)
+				case !saved:
+					slog.WarnContext(ctx, "idempotency: lease expired, key was reclaimed before the response was saved", "key", idempotencyKey)
+				default:
+					slog.DebugContext(ctx, "idempotency: saved final response", "key", idempotencyKey)
 				}
 			} else {
-				{
-					_, s := idempoTracer.Start(ctx, "consul.kv.delete")
-					s.SetAttributes(attribute.String("consul.key", keyPath))
-					_, _ = kv.Delete(keyPath, nil)
-					s.End()
-				}
+				_, _ = store.Release(ctx, storeKey, owner)
 			}
 
 			// 6) Vrati odgovor klijentu
@@ -178,3 +239,32 @@ func IdempotencyMiddleware(consulClient *api.Client) func(http.Handler) http.Han
 		})
 	}
 }
+
+// RunIdempotencySweeper deletes expired idempotency records every interval
+// until ctx is cancelled.
+func RunIdempotencySweeper(ctx context.Context, store repositories.IdempotencyStore, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if n, err := store.Sweep(ctx, time.Now()); err != nil {
+				slog.WarnContext(ctx, "idempotency: sweep failed", "error", err)
+			} else if n > 0 {
+				slog.InfoContext(ctx, "idempotency: swept expired records", "count", n)
+			}
+		}
+	}
+}
+
+// storeErrorStatus answers 503 while Consul is unavailable, so clients retry
+// with the same key instead of treating the request as failed.
+func storeErrorStatus(err error) int {
+	if errors.Is(err, consulkv.ErrUnavailable) {
+		return http.StatusServiceUnavailable
+	}
+	return http.StatusInternalServerError
+}
@@ -0,0 +1,161 @@
+package middleware
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/anjaobradovic/ars-sit-2025/model"
+	"github.com/anjaobradovic/ars-sit-2025/repositories"
+)
+
+func idempotentTestHandler(calls *int) http.Handler {
+	return IdempotencyMiddleware(repositories.NewMemoryIdempotencyStore(10), DefaultIdempotencyConfig)(
+		http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			*calls++
+			w.Header().Set("Content-Type", "application/json")
+			w.Header().Set("Location", "/configs/db/versions/v1")
+			w.WriteHeader(http.StatusCreated)
+			_, _ = w.Write([]byte(`{"name":"db"}`))
+		}),
+	)
+}
+
+func idempotentRequest(key, body string) *http.Request {
+	req := httptest.NewRequest("POST", "/configs", strings.NewReader(body))
+	req.Header.Set("Idempotency-Key", key)
+	return req
+}
+
+func TestIdempotencyMiddleware_ReplaysResponse(t *testing.T) {
+	calls := 0
+	h := idempotentTestHandler(&calls)
+
+	first := httptest.NewRecorder()
+	h.ServeHTTP(first, idempotentRequest("k1", `{"name":"db"}`))
+
+	second := httptest.NewRecorder()
+	h.ServeHTTP(second, idempotentRequest("k1", `{"name":"db"}`))
+
+	if calls != 1 {
+		t.Fatalf("expected handler to run once, ran %d times", calls)
+	}
+	if second.Code != http.StatusCreated {
+		t.Errorf("expected replayed status 201, got %d", second.Code)
+	}
+	if got := second.Header().Get("Location"); got != "/configs/db/versions/v1" {
+		t.Errorf("expected Location to be replayed, got %q", got)
+	}
+	if second.Header().Get(IdempotentReplayedHeader) != "true" {
+		t.Error("expected Idempotent-Replayed header on replay")
+	}
+	if second.Body.String() != first.Body.String() {
+		t.Errorf("expected body %q, got %q", first.Body.String(), second.Body.String())
+	}
+}
+
+func TestIdempotencyMiddleware_RejectsDifferentRequest(t *testing.T) {
+	calls := 0
+	h := idempotentTestHandler(&calls)
+
+	h.ServeHTTP(httptest.NewRecorder(), idempotentRequest("k1", `{"name":"db"}`))
+
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, idempotentRequest("k1", `{"name":"cache"}`))
+
+	if rec.Code != http.StatusUnprocessableEntity {
+		t.Errorf("expected 422, got %d", rec.Code)
+	}
+	if calls != 1 {
+		t.Errorf("expected handler to run once, ran %d times", calls)
+	}
+}
+
+func TestMemoryIdempotencyStore_ReserveAndSweep(t *testing.T) {
+	ctx := context.Background()
+	store := repositories.NewMemoryIdempotencyStore(10)
+	now := time.Now()
+
+	record := model.IdempotencyRecord{Status: model.StatusInProgress, ExpiresAt: now.Add(time.Minute)}
+	if _, ok, _ := store.Reserve(ctx, "k", record, 0); !ok {
+		t.Fatal("expected first reservation to succeed")
+	}
+	if _, ok, _ := store.Reserve(ctx, "k", record, 0); ok {
+		t.Fatal("expected second reservation at version 0 to fail")
+	}
+
+	if n, _ := store.Sweep(ctx, now.Add(2*time.Minute)); n != 1 {
+		t.Errorf("expected 1 swept record, got %d", n)
+	}
+	if got, _, _ := store.Get(ctx, "k"); got != nil {
+		t.Error("expected record to be gone after sweep")
+	}
+}
+
+func TestMemoryIdempotencyStore_ReclaimedKeyKeepsNewOwner(t *testing.T) {
+	ctx := context.Background()
+	store := repositories.NewMemoryIdempotencyStore(10)
+	now := time.Now()
+
+	lease := model.IdempotencyRecord{Status: model.StatusInProgress, ExpiresAt: now.Add(-time.Second)}
+	first, ok, _ := store.Reserve(ctx, "k", lease, 0)
+	if !ok {
+		t.Fatal("expected first reservation to succeed")
+	}
+
+	// The first lease has expired; a retry reclaims the key
+	_, version, _ := store.Get(ctx, "k")
+	lease.ExpiresAt = now.Add(time.Minute)
+	second, ok, _ := store.Reserve(ctx, "k", lease, version)
+	if !ok {
+		t.Fatal("expected reclaim to succeed")
+	}
+
+	// The slow first request finishes and must not touch the new reservation
+	if ok, _ := store.Complete(ctx, "k", first, model.IdempotencyRecord{Status: model.StatusCompleted, StatusCode: 201}); ok {
+		t.Error("expected Complete with a stale owner to fail")
+	}
+	if ok, _ := store.Release(ctx, "k", first); ok {
+		t.Error("expected Release with a stale owner to fail")
+	}
+	got, _, _ := store.Get(ctx, "k")
+	if got == nil || got.Status != model.StatusInProgress || got.Owner != second {
+		t.Fatalf("expected the second reservation to survive, got %+v", got)
+	}
+
+	if ok, _ := store.Complete(ctx, "k", second, model.IdempotencyRecord{Status: model.StatusCompleted, StatusCode: 201, Owner: second}); !ok {
+		t.Error("expected Complete by the current owner to succeed")
+	}
+}
+
+func TestIdempotencyMiddleware_RejectsDifferentQuery(t *testing.T) {
+	calls := 0
+	h := idempotentTestHandler(&calls)
+
+	deleteByLabels := func(query string) *http.Request {
+		req := httptest.NewRequest("DELETE", "/groups/g/versions/v1/configs?"+query, nil)
+		req.Header.Set("Idempotency-Key", "k1")
+		return req
+	}
+
+	h.ServeHTTP(httptest.NewRecorder(), deleteByLabels("labels=env:prod&x=1"))
+
+	// Same query in another order is the same request
+	same := httptest.NewRecorder()
+	h.ServeHTTP(same, deleteByLabels("x=1&labels=env%3Aprod"))
+	if same.Header().Get(IdempotentReplayedHeader) != "true" {
+		t.Errorf("expected replay for an equivalent query, got %d", same.Code)
+	}
+
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, deleteByLabels("labels=env:dev&x=1"))
+	if rec.Code != http.StatusUnprocessableEntity {
+		t.Errorf("expected 422, got %d", rec.Code)
+	}
+	if calls != 1 {
+		t.Errorf("expected handler to run once, ran %d times", calls)
+	}
+}
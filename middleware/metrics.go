@@ -1,18 +1,22 @@
 package middleware
 
 import (
+	"context"
 	"net/http"
 	"strconv"
 	"time"
 
 	"github.com/anjaobradovic/ars-sit-2025/metrics"
 	"github.com/gorilla/mux"
+	"github.com/prometheus/client_golang/prometheus"
+	"go.opentelemetry.io/otel/trace"
 )
 
 // responseWriter wrapper
 type responseWriter struct {
 	http.ResponseWriter
 	statusCode int
+	size       int
 }
 
 func (r *responseWriter) WriteHeader(status int) {
@@ -20,6 +24,38 @@ func (r *responseWriter) WriteHeader(status int) {
 	r.ResponseWriter.WriteHeader(status)
 }
 
+func (r *responseWriter) Write(b []byte) (int, error) {
+	n, err := r.ResponseWriter.Write(b)
+	r.size += n
+	return n, err
+}
+
+// LatencyObserver receives the status and latency of the requests
+// MetricsMiddleware measures and inner middleware marked with sampleLatency.
+type LatencyObserver func(r *http.Request, status int, latency time.Duration)
+
+var latencyObservers []LatencyObserver
+
+// ObserveLatency registers an observer. Call it before serving requests.
+func ObserveLatency(o LatencyObserver) {
+	latencyObservers = append(latencyObservers, o)
+}
+
+// latencySample lets inner middleware put a request into the latency signal.
+// Requests are left out unless marked, so public endpoints and requests shed
+// without doing any work do not skew it.
+type latencySample struct {
+	sampled bool
+}
+
+type latencySampleKey struct{}
+
+func sampleLatency(ctx context.Context) {
+	if s, ok := ctx.Value(latencySampleKey{}).(*latencySample); ok {
+		s.sampled = true
+	}
+}
+
 // Izvlači pattern rute
 func getEndpointPattern(r *http.Request) string {
 	route := mux.CurrentRoute(r)
@@ -51,6 +87,32 @@ func getStatusClass(statusCode int) string {
 	return "unknown"
 }
 
+// traceExemplar returns the trace ID of a sampled request as exemplar
+// labels, or nil when there is no trace to link to.
+func traceExemplar(ctx context.Context) prometheus.Labels {
+	sc := trace.SpanContextFromContext(ctx)
+	if !sc.IsValid() || !sc.IsSampled() {
+		return nil
+	}
+	return prometheus.Labels{"trace_id": sc.TraceID().String()}
+}
+
+func observe(o prometheus.Observer, v float64, exemplar prometheus.Labels) {
+	if eo, ok := o.(prometheus.ExemplarObserver); ok && exemplar != nil {
+		eo.ObserveWithExemplar(v, exemplar)
+		return
+	}
+	o.Observe(v)
+}
+
+func inc(c prometheus.Counter, exemplar prometheus.Labels) {
+	if ea, ok := c.(prometheus.ExemplarAdder); ok && exemplar != nil {
+		ea.AddWithExemplar(1, exemplar)
+		return
+	}
+	c.Inc()
+}
+
 // MetricsMiddleware beleži metrike za svaki HTTP zahtev
 func MetricsMiddleware(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
@@ -72,32 +134,39 @@ func MetricsMiddleware(next http.Handler) http.Handler {
 			WithLabelValues(method, endpoint).
 			Dec()
 
+		sample := &latencySample{}
+		r = r.WithContext(context.WithValue(r.Context(), latencySampleKey{}, sample))
+
 		// Obrada zahteva
 		next.ServeHTTP(rw, r)
 
-		duration := time.Since(start).Seconds()
+		elapsed := time.Since(start)
+		duration := elapsed.Seconds()
 		statusCode := rw.statusCode
 		statusCodeStr := strconv.Itoa(statusCode)
+		exemplar := traceExemplar(r.Context())
 
 		// Total requests
-		metrics.HttpRequestsTotal.
-			WithLabelValues(method, endpoint, statusCodeStr).
-			Inc()
+		inc(metrics.HttpRequestsTotal.
+			WithLabelValues(method, endpoint, statusCodeStr), exemplar)
 
 		// Response time
-		metrics.HttpResponseDuration.
-			WithLabelValues(method, endpoint).
-			Observe(duration)
+		observe(metrics.HttpResponseDuration.
+			WithLabelValues(method, endpoint), duration, exemplar)
 
 		// Success / failure
 		if isSuccessfulStatusCode(statusCode) {
-			metrics.HttpRequestsSuccessful.
-				WithLabelValues(method, endpoint).
-				Inc()
+			inc(metrics.HttpRequestsSuccessful.
+				WithLabelValues(method, endpoint), exemplar)
 		} else {
-			metrics.HttpRequestsFailed.
-				WithLabelValues(method, endpoint, getStatusClass(statusCode)).
-				Inc()
+			inc(metrics.HttpRequestsFailed.
+				WithLabelValues(method, endpoint, getStatusClass(statusCode)), exemplar)
+		}
+
+		if sample.sampled {
+			for _, o := range latencyObservers {
+				o(r, statusCode, elapsed)
+			}
 		}
 	})
 }
@@ -0,0 +1,65 @@
+package middleware
+
+import (
+	"context"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
+	"go.opentelemetry.io/otel/trace"
+)
+
+func sampledContext(t *testing.T) (context.Context, trace.TraceID) {
+	t.Helper()
+	traceID, _ := trace.TraceIDFromHex("4bf92f3577b34da6a3ce929d0e0e4736")
+	spanID, _ := trace.SpanIDFromHex("00f067aa0ba902b7")
+	sc := trace.NewSpanContext(trace.SpanContextConfig{
+		TraceID:    traceID,
+		SpanID:     spanID,
+		TraceFlags: trace.FlagsSampled,
+	})
+	return trace.ContextWithSpanContext(context.Background(), sc), traceID
+}
+
+func TestTraceExemplar(t *testing.T) {
+	if traceExemplar(context.Background()) != nil {
+		t.Fatal("expected no exemplar without a span")
+	}
+
+	ctx, traceID := sampledContext(t)
+	ex := traceExemplar(ctx)
+	if ex["trace_id"] != traceID.String() {
+		t.Fatalf("trace_id = %q, want %q", ex["trace_id"], traceID.String())
+	}
+
+	unsampled := trace.ContextWithSpanContext(context.Background(),
+		trace.SpanContextFromContext(ctx).WithTraceFlags(0))
+	if traceExemplar(unsampled) != nil {
+		t.Fatal("expected no exemplar for an unsampled trace")
+	}
+}
+
+func TestObserveAttachesExemplar(t *testing.T) {
+	ctx, traceID := sampledContext(t)
+
+	h := prometheus.NewHistogram(prometheus.HistogramOpts{Name: "test_duration_seconds"})
+	observe(h, 0.2, traceExemplar(ctx))
+
+	var m dto.Metric
+	if err := h.Write(&m); err != nil {
+		t.Fatal(err)
+	}
+	var found bool
+	for _, b := range m.GetHistogram().GetBucket() {
+		if ex := b.GetExemplar(); ex != nil {
+			for _, l := range ex.GetLabel() {
+				if l.GetName() == "trace_id" && l.GetValue() == traceID.String() {
+					found = true
+				}
+			}
+		}
+	}
+	if !found {
+		t.Fatal("expected a bucket exemplar with the trace ID")
+	}
+}
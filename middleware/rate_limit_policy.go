@@ -0,0 +1,144 @@
+package middleware
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"strings"
+
+	"github.com/anjaobradovic/ars-sit-2025/auth"
+)
+
+// RateLimitPolicy limits the requests it matches. Empty match fields match
+// everything; the first matching policy of a file applies.
+type RateLimitPolicy struct {
+	Name string `json:"name"`
+
+	// Route is a mux path template such as "/configs/{name}/versions/{version}".
+	Route string `json:"route,omitempty"`
+	// PathPrefix matches raw paths, for routes registered with PathPrefix.
+	PathPrefix string   `json:"pathPrefix,omitempty"`
+	Methods    []string `json:"methods,omitempty"`
+	// Principal is the qualified subject of an authenticated caller,
+	// "apikey:<key id>" or "jwt:<sub>".
+	Principal string `json:"principal,omitempty"`
+	// APIKeyID is the ID of the API key the caller authenticated with.
+	APIKeyID string `json:"apiKeyId,omitempty"`
+
+	// Rate is the steady number of requests per second, Burst the bucket size.
+	Rate  float64 `json:"rate"`
+	Burst int     `json:"burst"`
+
+	// Exempt requests are never limited.
+	Exempt bool `json:"exempt,omitempty"`
+}
+
+// RateLimitPolicies is the content of the policy file.
+type RateLimitPolicies struct {
+	Policies []RateLimitPolicy `json:"policies"`
+}
+
+// DefaultRateLimitPolicies apply when no policy file is configured: public
+// endpoints are exempt and mutations get a stricter budget than reads.
+var DefaultRateLimitPolicies = RateLimitPolicies{
+	Policies: []RateLimitPolicy{
+		{Name: "health", Route: "/healthz", Exempt: true},
+		{Name: "livez", Route: "/livez", Exempt: true},
+		{Name: "readyz", Route: "/readyz", Exempt: true},
+		{Name: "metrics", Route: "/metrics", Exempt: true},
+		{Name: "swagger", Route: "/swagger.yaml", Exempt: true},
+		{Name: "docs", PathPrefix: "/docs", Exempt: true},
+		{Name: "mutations", Methods: []string{"POST", "PUT", "PATCH", "DELETE"}, Rate: 2, Burst: 5},
+		{Name: "default", Rate: 10, Burst: 20},
+	},
+}
+
+// LoadRateLimitPolicies reads and validates a JSON policy file.
+func LoadRateLimitPolicies(path string) (RateLimitPolicies, error) {
+	var p RateLimitPolicies
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return p, err
+	}
+	if err := json.Unmarshal(data, &p); err != nil {
+		return p, fmt.Errorf("rate limit policies: %w", err)
+	}
+	return p, p.Validate()
+}
+
+// Validate checks that every policy has a unique name and a usable budget,
+// and that the last policy matches every request.
+func (p RateLimitPolicies) Validate() error {
+	if len(p.Policies) == 0 {
+		return fmt.Errorf("rate limit policies: no policies")
+	}
+
+	seen := map[string]bool{}
+	for _, pol := range p.Policies {
+		if pol.Name == "" {
+			return fmt.Errorf("rate limit policies: policy without a name")
+		}
+		if seen[pol.Name] {
+			return fmt.Errorf("rate limit policies: duplicate policy %q", pol.Name)
+		}
+		seen[pol.Name] = true
+
+		if pol.Principal != "" && !auth.IsQualifiedSubject(pol.Principal) {
+			return fmt.Errorf("rate limit policies: policy %q principal must be \"%s<key id>\" or \"%s<sub>\"", pol.Name, auth.SubjectPrefixAPIKey, auth.SubjectPrefixJWT)
+		}
+		if !pol.Exempt && (pol.Rate <= 0 || pol.Burst < 1) {
+			return fmt.Errorf("rate limit policies: policy %q needs a positive rate and burst", pol.Name)
+		}
+	}
+
+	if last := p.Policies[len(p.Policies)-1]; !last.catchAll() {
+		return fmt.Errorf("rate limit policies: last policy %q must match every request", last.Name)
+	}
+	return nil
+}
+
+func (pol RateLimitPolicy) catchAll() bool {
+	return pol.Route == "" && pol.PathPrefix == "" && len(pol.Methods) == 0 && pol.Principal == "" && pol.APIKeyID == ""
+}
+
+func (pol RateLimitPolicy) matches(r *http.Request, route string, p *auth.Principal) bool {
+	if pol.Route != "" && pol.Route != route {
+		return false
+	}
+	if pol.PathPrefix != "" && !strings.HasPrefix(r.URL.Path, pol.PathPrefix) {
+		return false
+	}
+	if len(pol.Methods) > 0 {
+		found := false
+		for _, m := range pol.Methods {
+			if strings.EqualFold(m, r.Method) {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+	if pol.Principal != "" && (p == nil || p.Subject != pol.Principal) {
+		return false
+	}
+	if pol.APIKeyID != "" && (p == nil || p.Method != auth.MethodAPIKey || p.KeyID != pol.APIKeyID) {
+		return false
+	}
+	return true
+}
+
+// match returns the first policy that applies to r.
+func (p RateLimitPolicies) match(r *http.Request) RateLimitPolicy {
+	route := getEndpointPattern(r)
+	principal, _ := auth.FromContext(r.Context())
+	for _, pol := range p.Policies {
+		if pol.matches(r, route, principal) {
+			return pol
+		}
+	}
+	return p.Policies[len(p.Policies)-1]
+}
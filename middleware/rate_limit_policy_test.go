@@ -0,0 +1,37 @@
+package middleware
+
+import (
+	"net/http/httptest"
+	"testing"
+)
+
+func TestDefaultRateLimitPolicies_Valid(t *testing.T) {
+	if err := DefaultRateLimitPolicies.Validate(); err != nil {
+		t.Fatalf("default policies are invalid: %v", err)
+	}
+}
+
+func TestRateLimitPolicies_Match(t *testing.T) {
+	cases := []struct {
+		method, path, want string
+	}{
+		{"GET", "/docs/index.html", "docs"},
+		{"POST", "/configs", "mutations"},
+		{"GET", "/configs", "default"},
+	}
+	for _, c := range cases {
+		got := DefaultRateLimitPolicies.match(httptest.NewRequest(c.method, c.path, nil))
+		if got.Name != c.want {
+			t.Errorf("%s %s: expected policy %q, got %q", c.method, c.path, c.want, got.Name)
+		}
+	}
+}
+
+func TestRateLimitPolicies_LastMustMatchEverything(t *testing.T) {
+	p := RateLimitPolicies{Policies: []RateLimitPolicy{
+		{Name: "writes", Methods: []string{"POST"}, Rate: 1, Burst: 1},
+	}}
+	if err := p.Validate(); err == nil {
+		t.Fatal("expected error for policies without a catch-all")
+	}
+}
@@ -1,12 +1,22 @@
 package middleware
 
 import (
-	"net"
+	"context"
+	"encoding/json"
+	"errors"
+	"log/slog"
 	"net/http"
+	"strconv"
 	"sync"
 	"time"
 
+	"github.com/anjaobradovic/ars-sit-2025/auth"
+	"github.com/anjaobradovic/ars-sit-2025/metrics"
+	"github.com/anjaobradovic/ars-sit-2025/repositories"
 	"golang.org/x/time/rate"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
 )
 
 type client struct {
@@ -14,20 +24,69 @@ type client struct {
 	lastSeen time.Time
 }
 
+// RateLimiter keeps a token bucket per policy and client.
 type RateLimiter struct {
-	mu      sync.Mutex
-	clients map[string]*client
-	rate    rate.Limit
-	burst   int
-	ttl     time.Duration
+	mu       sync.Mutex
+	clients  map[string]*client
+	policies RateLimitPolicies
+	ttl      time.Duration
+
+	// shared, when set, enforces the limit across replicas; the local
+	// bucket stays as a fast path that rejects without a round trip.
+	shared *SharedRateLimit
+
+	// preAuth limits every client IP before authentication runs.
+	preAuth RateLimitPolicy
 }
 
-func NewRateLimiter(r rate.Limit, burst int, ttl time.Duration) *RateLimiter {
+// SharedRateLimit counts requests per client in fixed windows stored in
+// Consul, so the limit holds for the whole cluster instead of per replica.
+type SharedRateLimit struct {
+	Store  *repositories.RateLimitRepository
+	Window time.Duration
+	// FailOpen lets requests through when the store is unreachable;
+	// otherwise they are rejected with 503.
+	FailOpen bool
+}
+
+// limit is how many requests a client may make in one window: the refill
+// over the window, but never less than one burst.
+func (s *SharedRateLimit) limit(pol RateLimitPolicy) int {
+	n := int(pol.Rate * s.Window.Seconds())
+	if n < pol.Burst {
+		n = pol.Burst
+	}
+	return n
+}
+
+// UseShared makes the limiter enforce its rate across replicas. Call it
+// before the limiter serves requests.
+func (rl *RateLimiter) UseShared(shared *SharedRateLimit) *RateLimiter {
+	rl.mu.Lock()
+	defer rl.mu.Unlock()
+
+	rl.shared = shared
+	return rl
+}
+
+// UseClientIPLimit adds a per-IP bucket checked by PreAuthMiddleware, so
+// unauthenticated traffic and API key guessing are limited before they reach
+// the credential store. Call it before the limiter serves requests.
+func (rl *RateLimiter) UseClientIPLimit(perSecond float64, burst int) *RateLimiter {
+	rl.mu.Lock()
+	defer rl.mu.Unlock()
+
+	rl.preAuth = RateLimitPolicy{Name: "client_ip", Rate: perSecond, Burst: burst}
+	return rl
+}
+
+// NewRateLimiter limits requests according to policies, which must be
+// valid. Buckets idle for longer than ttl are forgotten.
+func NewRateLimiter(policies RateLimitPolicies, ttl time.Duration) *RateLimiter {
 	rl := &RateLimiter{
-		clients: make(map[string]*client),
-		rate:    r,
-		burst:   burst,
-		ttl:     ttl,
+		clients:  make(map[string]*client),
+		policies: policies,
+		ttl:      ttl,
 	}
 
 	// cleanup gorutina da mapa ne raste beskonačno
@@ -37,23 +96,41 @@ func NewRateLimiter(r rate.Limit, burst int, ttl time.Duration) *RateLimiter {
 
 		for range ticker.C {
 			rl.cleanup()
+			rl.cleanupShared()
 		}
 	}()
 
 	return rl
 }
 
-func (rl *RateLimiter) getClient(ip string) *rate.Limiter {
+// SetPolicies replaces the policies, e.g. on configuration reload. Existing
+// buckets are dropped so new rates apply immediately.
+func (rl *RateLimiter) SetPolicies(policies RateLimitPolicies) {
+	rl.mu.Lock()
+	defer rl.mu.Unlock()
+
+	rl.policies = policies
+	rl.clients = make(map[string]*client)
+}
+
+func (rl *RateLimiter) currentPolicies() RateLimitPolicies {
 	rl.mu.Lock()
 	defer rl.mu.Unlock()
 
-	if c, ok := rl.clients[ip]; ok {
+	return rl.policies
+}
+
+func (rl *RateLimiter) getClient(key string, pol RateLimitPolicy) *rate.Limiter {
+	rl.mu.Lock()
+	defer rl.mu.Unlock()
+
+	if c, ok := rl.clients[key]; ok {
 		c.lastSeen = time.Now()
 		return c.limiter
 	}
 
-	lim := rate.NewLimiter(rl.rate, rl.burst)
-	rl.clients[ip] = &client{limiter: lim, lastSeen: time.Now()}
+	lim := rate.NewLimiter(rate.Limit(pol.Rate), pol.Burst)
+	rl.clients[key] = &client{limiter: lim, lastSeen: time.Now()}
 	return lim
 }
 
@@ -69,22 +146,199 @@ func (rl *RateLimiter) cleanup() {
 	}
 }
 
+// cleanupShared drops the counters of finished windows.
+func (rl *RateLimiter) cleanupShared() {
+	rl.mu.Lock()
+	shared := rl.shared
+	rl.mu.Unlock()
+
+	if shared == nil {
+		return
+	}
+	current := time.Now().Truncate(shared.Window).Unix()
+	if _, err := shared.Store.DeleteBefore(context.Background(), current); err != nil {
+		slog.Warn("rate limiter: cannot delete old windows", "error", err)
+	}
+}
+
+// sharedState reports the cluster-wide budget after count requests in the
+// current window, which ends after untilEnd.
+func (s *SharedRateLimit) sharedState(pol RateLimitPolicy, count int, untilEnd time.Duration) rateLimitState {
+	st := rateLimitState{limit: s.limit(pol), reset: untilEnd}
+	if count < st.limit {
+		st.remaining = st.limit - count
+	}
+	if count > st.limit {
+		st.retry = untilEnd
+	}
+	return st
+}
+
+// Standard rate limit response headers.
+const (
+	RateLimitLimitHeader     = "RateLimit-Limit"
+	RateLimitRemainingHeader = "RateLimit-Remaining"
+	RateLimitResetHeader     = "RateLimit-Reset"
+)
+
+// rateLimitState is what the headers report about the caller's budget.
+type rateLimitState struct {
+	limit     int
+	remaining int
+	reset     time.Duration // until the budget is full again
+	retry     time.Duration // until the next request may pass, if rejected
+}
+
+// bucketState reads the state of a token bucket after the request took, or
+// failed to take, its token.
+func bucketState(lim *rate.Limiter, pol RateLimitPolicy) rateLimitState {
+	tokens := lim.Tokens()
+	st := rateLimitState{limit: pol.Burst}
+	if tokens > 0 {
+		st.remaining = int(tokens)
+	}
+	st.reset = secondsFor(float64(pol.Burst)-tokens, pol.Rate)
+	if tokens < 1 {
+		st.retry = secondsFor(1-tokens, pol.Rate)
+	}
+	return st
+}
+
+// secondsFor is how long the bucket takes to refill n tokens.
+func secondsFor(n, perSecond float64) time.Duration {
+	if n <= 0 {
+		return 0
+	}
+	return time.Duration(n / perSecond * float64(time.Second))
+}
+
+// ceilSeconds rounds up, since headers carry whole seconds.
+func ceilSeconds(d time.Duration) int {
+	return int((d + time.Second - 1) / time.Second)
+}
+
+func (st rateLimitState) setHeaders(w http.ResponseWriter) {
+	w.Header().Set(RateLimitLimitHeader, strconv.Itoa(st.limit))
+	w.Header().Set(RateLimitRemainingHeader, strconv.Itoa(st.remaining))
+	w.Header().Set(RateLimitResetHeader, strconv.Itoa(ceilSeconds(st.reset)))
+}
+
+// rateLimitError is the JSON body of a rejected request.
+type rateLimitError struct {
+	Message           string `json:"message"`
+	Policy            string `json:"policy"`
+	RetryAfterSeconds int    `json:"retryAfterSeconds"`
+}
+
+// reject answers a limited request and records why it was limited.
+func reject(w http.ResponseWriter, r *http.Request, pol RateLimitPolicy, reason string, status int, retry time.Duration) {
+	metrics.RateLimitRejectionsTotal.WithLabelValues(pol.Name, reason).Inc()
+	trace.SpanFromContext(r.Context()).AddEvent("rate_limit.rejected", trace.WithAttributes(
+		attribute.String("rate_limit.policy", pol.Name),
+		attribute.String("rate_limit.reason", reason),
+	))
+
+	msg := "rate limit exceeded"
+	if status == http.StatusServiceUnavailable {
+		msg = "rate limiter unavailable"
+	}
+	secs := ceilSeconds(retry)
+	if secs < 1 {
+		secs = 1
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Retry-After", strconv.Itoa(secs))
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(rateLimitError{Message: msg, Policy: pol.Name, RetryAfterSeconds: secs})
+}
+
+// PreAuthMiddleware enforces the client IP limit. It runs before
+// authentication, so requests that fail with 401 or 403 are limited too;
+// Middleware applies the per-principal policies after authentication.
+func (rl *RateLimiter) PreAuthMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		rl.mu.Lock()
+		pol := rl.preAuth
+		rl.mu.Unlock()
+
+		if pol.Rate <= 0 || rl.currentPolicies().match(r).Exempt {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		// Uvek lokalno: ne sme da pita Consul za svaki neautentifikovan zahtev
+		limiter := rl.getClient(pol.Name+"|"+clientIP(r), pol)
+		if !limiter.Allow() {
+			st := bucketState(limiter, pol)
+			st.setHeaders(w)
+			reject(w, r, pol, "local", http.StatusTooManyRequests, st.retry)
+			return
+		}
+
+		next.ServeHTTP(w, r)
+	})
+}
+
 // Middleware
 func (rl *RateLimiter) Middleware(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		ip := r.RemoteAddr
-		if host, _, err := net.SplitHostPort(r.RemoteAddr); err == nil {
-			ip = host
+		pol := rl.currentPolicies().match(r)
+		if pol.Exempt {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		// Authenticated callers get their own bucket wherever they connect
+		// from; everyone else is limited per IP. Each policy has its own.
+		key := clientIP(r)
+		if p, ok := auth.FromContext(r.Context()); ok && p.Method != auth.MethodAnonymous {
+			key = "principal:" + p.Subject
 		}
+		key = pol.Name + "|" + key
 
-		limiter := rl.getClient(ip)
+		limiter := rl.getClient(key, pol)
 
 		// Allow = token bucket: steady rate + burst
-		if !limiter.Allow() {
-			http.Error(w, "rate limit exceeded", http.StatusTooManyRequests)
+		allowed := limiter.Allow()
+		st := bucketState(limiter, pol)
+		st.setHeaders(w)
+		if !allowed {
+			reject(w, r, pol, "local", http.StatusTooManyRequests, st.retry)
 			return
 		}
 
+		if rl.shared != nil {
+			now := time.Now()
+			window := now.Truncate(rl.shared.Window)
+			untilWindowEnd := window.Add(rl.shared.Window).Sub(now)
+
+			count, err := rl.shared.Store.Increment(r.Context(), key, window.Unix())
+			switch {
+			case errors.Is(err, repositories.ErrRateLimitContention):
+				// The counter is hot, not unavailable: this client is sending
+				// faster than the store can count, so it is limited.
+				st := rl.shared.sharedState(pol, rl.shared.limit(pol), untilWindowEnd)
+				st.setHeaders(w)
+				reject(w, r, pol, "contended", http.StatusTooManyRequests, time.Second)
+				return
+			case err != nil:
+				slog.WarnContext(r.Context(), "rate limiter: shared counter unavailable", "error", err)
+				if !rl.shared.FailOpen {
+					reject(w, r, pol, "unavailable", http.StatusServiceUnavailable, time.Second)
+					return
+				}
+			default:
+				// The cluster-wide window is what the client is limited by
+				st := rl.shared.sharedState(pol, count, untilWindowEnd)
+				st.setHeaders(w)
+				if count > st.limit {
+					reject(w, r, pol, "shared", http.StatusTooManyRequests, st.retry)
+					return
+				}
+			}
+		}
+
 		next.ServeHTTP(w, r)
 	})
 }
@@ -0,0 +1,125 @@
+package middleware
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/anjaobradovic/ars-sit-2025/consulkv"
+	"github.com/anjaobradovic/ars-sit-2025/repositories"
+)
+
+func TestRateLimiter_RejectsWithHeaders(t *testing.T) {
+	rl := NewRateLimiter(RateLimitPolicies{Policies: []RateLimitPolicy{
+		{Name: "default", Rate: 1, Burst: 2},
+	}}, time.Minute)
+	h := rl.Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+
+	var rec *httptest.ResponseRecorder
+	for i := 0; i < 3; i++ {
+		rec = httptest.NewRecorder()
+		h.ServeHTTP(rec, httptest.NewRequest("GET", "/configs", nil))
+	}
+
+	if rec.Code != http.StatusTooManyRequests {
+		t.Fatalf("expected 429, got %d", rec.Code)
+	}
+	if rec.Header().Get(RateLimitLimitHeader) != "2" {
+		t.Errorf("expected RateLimit-Limit 2, got %q", rec.Header().Get(RateLimitLimitHeader))
+	}
+	if rec.Header().Get(RateLimitRemainingHeader) != "0" {
+		t.Errorf("expected RateLimit-Remaining 0, got %q", rec.Header().Get(RateLimitRemainingHeader))
+	}
+	if rec.Header().Get("Retry-After") != "1" {
+		t.Errorf("expected Retry-After 1, got %q", rec.Header().Get("Retry-After"))
+	}
+
+	var body rateLimitError
+	if err := json.NewDecoder(rec.Body).Decode(&body); err != nil {
+		t.Fatalf("expected JSON body: %v", err)
+	}
+	if body.Policy != "default" {
+		t.Errorf("expected policy default, got %q", body.Policy)
+	}
+}
+
+func TestRateLimiter_PreAuthLimitsPerClientIP(t *testing.T) {
+	rl := NewRateLimiter(RateLimitPolicies{Policies: []RateLimitPolicy{
+		{Name: "default", Rate: 100, Burst: 100},
+	}}, time.Minute).UseClientIPLimit(1, 2)
+	h := rl.PreAuthMiddleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusUnauthorized)
+	}))
+
+	codes := make([]int, 0, 3)
+	for i := 0; i < 3; i++ {
+		rec := httptest.NewRecorder()
+		req := httptest.NewRequest("GET", "/configs", nil)
+		req.Header.Set("Authorization", "Bearer cfgsvc_guess")
+		h.ServeHTTP(rec, req)
+		codes = append(codes, rec.Code)
+	}
+	if codes[0] != http.StatusUnauthorized || codes[1] != http.StatusUnauthorized || codes[2] != http.StatusTooManyRequests {
+		t.Fatalf("expected 401, 401, 429, got %v", codes)
+	}
+
+	// Another client IP has its own bucket
+	rec := httptest.NewRecorder()
+	req := httptest.NewRequest("GET", "/configs", nil)
+	req.RemoteAddr = "192.0.2.7:1234"
+	h.ServeHTTP(rec, req)
+	if rec.Code != http.StatusUnauthorized {
+		t.Errorf("expected another IP to pass, got %d", rec.Code)
+	}
+}
+
+func TestSharedState(t *testing.T) {
+	shared := &SharedRateLimit{Window: 10 * time.Second}
+	pol := RateLimitPolicy{Name: "default", Rate: 1, Burst: 5}
+
+	st := shared.sharedState(pol, 4, 3*time.Second)
+	if st.limit != 10 || st.remaining != 6 || st.reset != 3*time.Second || st.retry != 0 {
+		t.Errorf("unexpected state under the limit: %+v", st)
+	}
+	st = shared.sharedState(pol, 11, 3*time.Second)
+	if st.remaining != 0 || st.retry != 3*time.Second {
+		t.Errorf("unexpected state over the limit: %+v", st)
+	}
+}
+
+func TestRateLimiter_SharedContentionIsNotUnavailable(t *testing.T) {
+	// Every CAS loses, as if other replicas always won the race
+	consul := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodPut {
+			_, _ = w.Write([]byte("false"))
+			return
+		}
+		http.NotFound(w, r)
+	}))
+	defer consul.Close()
+
+	client, err := consulkv.NewClient(consulkv.Config{Address: strings.TrimPrefix(consul.URL, "http://")})
+	if err != nil {
+		t.Fatal(err)
+	}
+	rl := NewRateLimiter(RateLimitPolicies{Policies: []RateLimitPolicy{
+		{Name: "default", Rate: 1, Burst: 5},
+	}}, time.Minute).UseShared(&SharedRateLimit{
+		Store:  repositories.NewRateLimitRepository(client),
+		Window: 10 * time.Second,
+	})
+	h := rl.Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, httptest.NewRequest("GET", "/configs", nil))
+
+	if rec.Code != http.StatusTooManyRequests {
+		t.Fatalf("expected 429 under contention, got %d", rec.Code)
+	}
+	if rec.Header().Get(RateLimitLimitHeader) != "10" {
+		t.Errorf("expected the shared limit 10, got %q", rec.Header().Get(RateLimitLimitHeader))
+	}
+}
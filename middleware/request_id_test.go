@@ -0,0 +1,46 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/anjaobradovic/ars-sit-2025/logging"
+)
+
+func TestRequestIDMiddleware(t *testing.T) {
+	var seen string
+	h := RequestIDMiddleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		seen = logging.RequestIDFromContext(r.Context())
+	}))
+
+	cases := []struct {
+		name     string
+		incoming string
+		keep     bool
+	}{
+		{"client id kept", "abc-123", true},
+		{"missing id generated", "", false},
+		{"id with spaces replaced", "a b", false},
+		{"overlong id replaced", strings.Repeat("x", maxRequestIDLength+1), false},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, "/configs", nil)
+			if c.incoming != "" {
+				req.Header.Set(RequestIDHeader, c.incoming)
+			}
+			rec := httptest.NewRecorder()
+			h.ServeHTTP(rec, req)
+
+			got := rec.Header().Get(RequestIDHeader)
+			if got == "" || got != seen {
+				t.Fatalf("response id %q, context id %q", got, seen)
+			}
+			if (got == c.incoming) != c.keep {
+				t.Fatalf("id %q for incoming %q, keep=%v", got, c.incoming, c.keep)
+			}
+		})
+	}
+}
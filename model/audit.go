@@ -0,0 +1,78 @@
+package model
+
+import "time"
+
+// AuditAction names a mutating operation recorded in the audit trail
+// swagger:model AuditAction
+type AuditAction string
+
+const (
+	AuditConfigCreate        AuditAction = "config.create"
+	AuditConfigDelete        AuditAction = "config.delete"
+	AuditGroupCreate         AuditAction = "group.create"
+	AuditGroupDelete         AuditAction = "group.delete"
+	AuditGroupAddConfig      AuditAction = "group.add_config"
+	AuditGroupRemoveConfig   AuditAction = "group.remove_config"
+	AuditGroupDeleteByLabels AuditAction = "group.delete_configs_by_labels"
+	AuditWebhookCreate       AuditAction = "webhook.create"
+	AuditWebhookDelete       AuditAction = "webhook.delete"
+	AuditAPIKeyCreate        AuditAction = "apikey.create"
+	AuditAPIKeyDelete        AuditAction = "apikey.delete"
+	AuditRoleBindingCreate   AuditAction = "rolebinding.create"
+	AuditRoleBindingDelete   AuditAction = "rolebinding.delete"
+)
+
+// AuditEntry is one immutable record of a mutation
+// swagger:model AuditEntry
+type AuditEntry struct {
+	// The unique identifier for the entry
+	// example: 0f8fad5b-d9cb-469f-a165-70867728950e
+	ID string `json:"id"`
+
+	// When the mutation completed
+	Timestamp time.Time `json:"timestamp"`
+
+	// Who performed the mutation
+	// example: anonymous
+	Actor string `json:"actor"`
+
+	// What was done
+	// example: config.create
+	Action AuditAction `json:"action"`
+
+	// Storage key of the affected resource
+	// example: configs/database-config/v1.0
+	Target string `json:"target"`
+
+	// SHA-256 of the resource before the mutation, empty if it did not exist
+	// example: 9f86d081884c7d659a2feaa0c55ad015a3bf4f1b2b0b822cd15d6c15b0f00a08
+	BeforeHash string `json:"beforeHash,omitempty"`
+
+	// SHA-256 of the resource after the mutation, empty if it was removed
+	// example: 60303ae22b998861bce3b28f33eec1be758a213c86c93c076dbe9f558c11c752
+	AfterHash string `json:"afterHash,omitempty"`
+
+	// X-Request-ID of the request
+	// example: 7b9e2c4a-6c1d-4f0e-8f0a-2d3b5e6f7a8b
+	RequestID string `json:"requestId,omitempty"`
+
+	// Address of the client, behind trusted proxies the original one
+	// example: 203.0.113.7
+	ClientIP string `json:"clientIp,omitempty"`
+
+	// OpenTelemetry trace ID of the request
+	// example: 4bf92f3577b34da6a3ce929d0e0e4736
+	TraceID string `json:"traceId,omitempty"`
+}
+
+// AuditFilter selects audit entries, zero fields match everything
+type AuditFilter struct {
+	Target string
+	Actor  string
+	Since  time.Time
+
+	// After is the cursor of the previous page: entries up to it are skipped
+	After string
+	// Limit caps how many entries are returned, 0 means all
+	Limit int
+}
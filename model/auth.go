@@ -0,0 +1,116 @@
+package model
+
+import "time"
+
+// APIKey is a stored API key. The key itself is never stored, only its hash
+// swagger:model APIKey
+type APIKey struct {
+	// The unique identifier for the key
+	// example: 3c6e0b8a-9c0a-4f1e-8b1e-2f6d1a7c5e90
+	ID string `json:"id"`
+
+	// Unique human readable name. The principal subject is "apikey:" and the ID
+	// example: ci-pipeline
+	Name string `json:"name"`
+
+	// Roles granted to callers using this key
+	// example: ["editor"]
+	Roles []string `json:"roles"`
+
+	// First characters of the key, to recognise it without revealing it
+	// example: cfgsvc_1a2b
+	Prefix string `json:"prefix"`
+
+	// SHA-256 of the key
+	Hash string `json:"hash,omitempty"`
+
+	// Creation time
+	CreatedAt time.Time `json:"createdAt"`
+}
+
+// CreatedAPIKey is returned once when a key is issued
+// swagger:model CreatedAPIKey
+type CreatedAPIKey struct {
+	APIKey
+
+	// The plaintext key. It cannot be retrieved again
+	// example: cfgsvc_1a2b3c...
+	Key string `json:"key"`
+}
+
+// RoleBinding grants a role to a subject within a scope. Empty scope fields
+// make the binding global
+// swagger:model RoleBinding
+type RoleBinding struct {
+	// The unique identifier for the binding
+	// example: 6a1f0c7e-2b3d-4e5f-8a9b-0c1d2e3f4a5b
+	ID string `json:"id"`
+
+	// Qualified principal subject the binding applies to, "apikey:<key id>"
+	// or "jwt:<sub>", or "*" for every caller
+	// example: apikey:3c6e0b8a-9c0a-4f1e-8b1e-2f6d1a7c5e90
+	Subject string `json:"subject"`
+
+	// Role granted: reader, editor, secret-reader or admin
+	// example: editor
+	Role string `json:"role"`
+
+	// Limit the binding to configurations whose name starts with this prefix
+	// example: payments-
+	ConfigPrefix string `json:"configPrefix,omitempty"`
+
+	// Limit the binding to this group, "*" for every group
+	// example: backend-group
+	Group string `json:"group,omitempty"`
+
+	// Limit a group binding to labeled configurations carrying these labels
+	// example: {"env":"staging"}
+	Labels map[string]string `json:"labels,omitempty"`
+
+	// Creation time
+	CreatedAt time.Time `json:"createdAt"`
+}
+
+// EffectiveGrant is one grant of the caller with the permissions it carries
+// swagger:model EffectiveGrant
+type EffectiveGrant struct {
+	// Where the grant comes from: "credential" or a role binding ID
+	// example: credential
+	Source string `json:"source"`
+
+	// example: editor
+	Role string `json:"role"`
+
+	// example: ["read","write"]
+	Permissions []string `json:"permissions"`
+
+	// example: payments-
+	ConfigPrefix string `json:"configPrefix,omitempty"`
+
+	// example: *
+	Group string `json:"group,omitempty"`
+
+	// example: {"env":"staging"}
+	Labels map[string]string `json:"labels,omitempty"`
+}
+
+// WhoAmI describes the caller and its effective permissions
+// swagger:model WhoAmI
+type WhoAmI struct {
+	// example: apikey:3c6e0b8a-9c0a-4f1e-8b1e-2f6d1a7c5e90
+	Subject string `json:"subject"`
+
+	// API key name or JWT subject claim
+	// example: ci-pipeline
+	Name string `json:"name,omitempty"`
+
+	// example: api_key
+	Method string `json:"method"`
+
+	// Roles carried by the credential itself
+	// example: ["reader"]
+	Roles []string `json:"roles"`
+
+	// All grants in effect, from the credential and from role bindings
+	Grants []EffectiveGrant `json:"grants"`
+}
@@ -1,5 +1,7 @@
 package model
 
+import "time"
+
 // Config represents a single configuration item
 // swagger:model Config
 type Config struct {
@@ -18,6 +20,11 @@ type Config struct {
 	// Key-value pairs representing configuration parameters
 	// example: {"host": "localhost", "port": "5432"}
 	Parameters map[string]string `json:"parameters"`
+
+	// Names of parameters holding secrets. Their values are stored encrypted
+	// and redacted in responses unless the caller may reveal them
+	// example: ["password"]
+	Secrets []string `json:"secrets,omitempty"`
 }
 
 // ConfigurationGroup represents a group of related configurations
@@ -78,6 +85,31 @@ type IdempotencyRecord struct {
 	// Body of the response
 	// example: {"id":"config-123","name":"DB Config","version":"v1.0.0"}
 	Body string `json:"body"`
+
+	// Response headers restored on replay
+	Headers map[string][]string `json:"headers,omitempty"`
+
+	// Hash of the method, path and body of the request that used the key
+	// example: 9f86d081884c7d659a2feaa0c55ad015a3bf4f1b2b0b822cd15d6c15b0f00a08
+	Fingerprint string `json:"fingerprint,omitempty"`
+
+	// Token of the reservation that wrote the record; only its holder may
+	// complete or release the key
+	// example: 5f0c2b1e-8d7a-4c3e-9b1f-2a6d4e8c0f13
+	Owner string `json:"owner,omitempty"`
+
+	// Time the record was written
+	CreatedAt time.Time `json:"createdAt"`
+
+	// Time after which the record may be reclaimed: the end of the lease for
+	// in-progress records, the end of retention for completed ones
+	ExpiresAt time.Time `json:"expiresAt"`
+}
+
+// Expired reports whether the record may be reclaimed or swept. Records
+// written before expiry was tracked count as expired.
+func (r IdempotencyRecord) Expired(now time.Time) bool {
+	return r.ExpiresAt.IsZero() || !now.Before(r.ExpiresAt)
 }
 
 // ErrorResponse represents a standard error
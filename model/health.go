@@ -0,0 +1,42 @@
+package model
+
+// Readiness check statuses
+const (
+	CheckPass = "pass"
+	CheckFail = "fail"
+	// CheckWarn is a failed non-critical check; it does not affect readiness
+	CheckWarn = "warn"
+)
+
+// Readiness statuses
+const (
+	StatusReady        = "ready"
+	StatusNotReady     = "not_ready"
+	StatusShuttingDown = "shutting_down"
+)
+
+// HealthCheckResult is the outcome of one readiness check
+// swagger:model HealthCheckResult
+type HealthCheckResult struct {
+	// pass, fail, or warn for a failed non-critical check
+	// example: pass
+	Status string `json:"status"`
+
+	// How long the check took, in milliseconds
+	// example: 3.2
+	LatencyMs float64 `json:"latencyMs"`
+
+	// Why the check failed
+	Error string `json:"error,omitempty"`
+}
+
+// ReadinessReport is the body of /readyz
+// swagger:model ReadinessReport
+type ReadinessReport struct {
+	// ready, not_ready or shutting_down
+	// example: ready
+	Status string `json:"status"`
+
+	// Result per check, by name
+	Checks map[string]HealthCheckResult `json:"checks"`
+}
@@ -0,0 +1,138 @@
+package model
+
+import (
+	"encoding/json"
+	"time"
+)
+
+// WebhookEventType identifies what happened to a configuration or group
+// swagger:model WebhookEventType
+type WebhookEventType string
+
+const (
+	EventConfigCreated      WebhookEventType = "config.created"
+	EventConfigDeleted      WebhookEventType = "config.deleted"
+	EventGroupConfigAdded   WebhookEventType = "group.config.added"
+	EventGroupConfigRemoved WebhookEventType = "group.config.removed"
+)
+
+// WebhookEventTypes lists every event a subscription can ask for.
+var WebhookEventTypes = []WebhookEventType{
+	EventConfigCreated,
+	EventConfigDeleted,
+	EventGroupConfigAdded,
+	EventGroupConfigRemoved,
+}
+
+// WebhookSubscription describes a receiver for change events
+// swagger:model WebhookSubscription
+type WebhookSubscription struct {
+	// The unique identifier for the subscription
+	// example: 5f0c7b1e-3a8f-4a4e-9d7a-2a1f0e3c9b11
+	ID string `json:"id"`
+
+	// Receiver URL, events are POSTed here
+	// example: https://hooks.example.com/config-events
+	URL string `json:"url"`
+
+	// Shared secret used to sign payloads (HMAC-SHA256). Only returned on creation
+	// example: 8d1b0f7a9c
+	Secret string `json:"secret,omitempty"`
+
+	// Event types to deliver, empty means all
+	// example: ["config.created","config.deleted"]
+	EventTypes []WebhookEventType `json:"eventTypes"`
+
+	// Only deliver events for configurations whose name starts with this prefix
+	// example: database-
+	NamePrefix string `json:"namePrefix,omitempty"`
+
+	// Only deliver group events whose configuration labels contain all of
+	// these. Config events carry no labels and never match a label filter
+	// (creation rejects label filters with config event types).
+	// example: {"env":"prod"}
+	Labels map[string]string `json:"labels,omitempty"`
+
+	// Creation time
+	CreatedAt time.Time `json:"createdAt"`
+}
+
+// WebhookEvent is the JSON document POSTed to subscribers
+// swagger:model WebhookEvent
+type WebhookEvent struct {
+	// The unique identifier for the event
+	ID string `json:"id"`
+
+	// Event type
+	// example: config.created
+	Type WebhookEventType `json:"type"`
+
+	// When the change happened
+	OccurredAt time.Time `json:"occurredAt"`
+
+	// Name of the affected configuration
+	// example: database-config
+	Name string `json:"name"`
+
+	// Version of the affected configuration
+	// example: v1.0
+	Version string `json:"version"`
+
+	// Group name and version for group membership events
+	// example: backend-group
+	Group string `json:"group,omitempty"`
+
+	// example: v1
+	GroupVersion string `json:"groupVersion,omitempty"`
+
+	// Labels of the configuration inside the group
+	Labels map[string]string `json:"labels,omitempty"`
+
+	// Affected object
+	Data json.RawMessage `json:"data,omitempty"`
+}
+
+// WebhookDeliveryStatus is the state of a single delivery
+// swagger:model WebhookDeliveryStatus
+type WebhookDeliveryStatus string
+
+const (
+	DeliveryPending   WebhookDeliveryStatus = "pending"
+	DeliverySucceeded WebhookDeliveryStatus = "succeeded"
+	DeliveryFailed    WebhookDeliveryStatus = "failed"
+)
+
+// WebhookDelivery tracks one event sent to one subscription
+// swagger:model WebhookDelivery
+type WebhookDelivery struct {
+	// The unique identifier for the delivery
+	ID string `json:"id"`
+
+	// Subscription the event is delivered to
+	SubscriptionID string `json:"subscriptionId"`
+
+	// The event being delivered
+	Event WebhookEvent `json:"event"`
+
+	// Current state
+	// example: pending
+	Status WebhookDeliveryStatus `json:"status"`
+
+	// Number of attempts made so far
+	// example: 2
+	Attempts int `json:"attempts"`
+
+	// Earliest time of the next attempt while pending
+	NextAttemptAt time.Time `json:"nextAttemptAt"`
+
+	// HTTP status returned by the receiver on the last attempt
+	// example: 503
+	LastStatusCode int `json:"lastStatusCode,omitempty"`
+
+	// Error of the last attempt
+	// example: receiver returned 503
+	LastError string `json:"lastError,omitempty"`
+
+	// Last time the delivery changed
+	UpdatedAt time.Time `json:"updatedAt"`
+}
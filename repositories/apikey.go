@@ -0,0 +1,159 @@
+package repositories
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/url"
+
+	"github.com/anjaobradovic/ars-sit-2025/consulkv"
+	"github.com/anjaobradovic/ars-sit-2025/model"
+	"github.com/hashicorp/consul/api"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+)
+
+var apiKeyTracer = otel.Tracer("repositories/apikey")
+
+var (
+	ErrAPIKeyNotFound  = errors.New("api key not found")
+	ErrAPIKeyNameTaken = errors.New("api key name already in use")
+)
+
+const (
+	apiKeyPrefix     = "auth/apikeys/"
+	apiKeyNamePrefix = "auth/apikey-names/"
+)
+
+// APIKeyRepository stores API keys under their hash, so authenticating a
+// request is a single lookup. Names are claimed under auth/apikey-names/ so
+// two keys can never share one.
+type APIKeyRepository struct {
+	kv *consulkv.KV
+}
+
+func NewAPIKeyRepository(client *consulkv.Client) *APIKeyRepository {
+	return &APIKeyRepository{kv: client.KV()}
+}
+
+func apiKeyNameKey(name string) string {
+	return apiKeyNamePrefix + url.PathEscape(name)
+}
+
+func (r *APIKeyRepository) Save(ctx context.Context, key model.APIKey) error {
+	ctx, span := apiKeyTracer.Start(ctx, "APIKeyRepository.Save")
+	defer span.End()
+
+	span.SetAttributes(attribute.String("apikey.id", key.ID))
+
+	data, err := json.Marshal(key)
+	if err != nil {
+		return err
+	}
+
+	// Keys issued before names were claimed only show up in the list
+	existing, err := r.List(ctx)
+	if err != nil {
+		return err
+	}
+	for _, k := range existing {
+		if k.Name == key.Name {
+			return ErrAPIKeyNameTaken
+		}
+	}
+
+	ok, _, err := r.kv.CAS(&api.KVPair{Key: apiKeyNameKey(key.Name), Value: []byte(key.ID), ModifyIndex: 0}, nil)
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, "consul cas failed")
+		return err
+	}
+	if !ok {
+		return ErrAPIKeyNameTaken
+	}
+
+	ok, _, err = r.kv.CAS(&api.KVPair{Key: apiKeyPrefix + key.Hash, Value: data, ModifyIndex: 0}, nil)
+	if err == nil && !ok {
+		err = errors.New("api key already exists")
+	}
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, "consul cas failed")
+		_, _ = r.kv.Delete(apiKeyNameKey(key.Name), nil)
+		return err
+	}
+	return nil
+}
+
+func (r *APIKeyRepository) GetByHash(ctx context.Context, hash string) (*model.APIKey, error) {
+	_, span := apiKeyTracer.Start(ctx, "APIKeyRepository.GetByHash")
+	defer span.End()
+
+	pair, _, err := r.kv.Get(apiKeyPrefix+hash, nil)
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, "consul get failed")
+		return nil, err
+	}
+	if pair == nil {
+		return nil, ErrAPIKeyNotFound
+	}
+
+	var key model.APIKey
+	if err := json.Unmarshal(pair.Value, &key); err != nil {
+		return nil, err
+	}
+	return &key, nil
+}
+
+func (r *APIKeyRepository) List(ctx context.Context) ([]model.APIKey, error) {
+	_, span := apiKeyTracer.Start(ctx, "APIKeyRepository.List")
+	defer span.End()
+
+	pairs, _, err := r.kv.List(apiKeyPrefix, nil)
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, "consul list failed")
+		return nil, err
+	}
+
+	out := make([]model.APIKey, 0, len(pairs))
+	for _, p := range pairs {
+		var key model.APIKey
+		if err := json.Unmarshal(p.Value, &key); err != nil {
+			return nil, err
+		}
+		out = append(out, key)
+	}
+	return out, nil
+}
+
+// DeleteByID revokes a key. Keys are stored by hash, so this scans the list.
+func (r *APIKeyRepository) DeleteByID(ctx context.Context, id string) (*model.APIKey, error) {
+	ctx, span := apiKeyTracer.Start(ctx, "APIKeyRepository.DeleteByID")
+	defer span.End()
+
+	span.SetAttributes(attribute.String("apikey.id", id))
+
+	keys, err := r.List(ctx)
+	if err != nil {
+		return nil, err
+	}
+	for _, k := range keys {
+		if k.ID != id {
+			continue
+		}
+		if _, err := r.kv.Delete(apiKeyPrefix+k.Hash, nil); err != nil {
+			span.RecordError(err)
+			span.SetStatus(codes.Error, "consul delete failed")
+			return nil, err
+		}
+		if _, err := r.kv.Delete(apiKeyNameKey(k.Name), nil); err != nil {
+			span.RecordError(err)
+		}
+		return &k, nil
+	}
+	return nil, ErrAPIKeyNotFound
+}
@@ -0,0 +1,135 @@
+package repositories
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/anjaobradovic/ars-sit-2025/consulkv"
+	"github.com/anjaobradovic/ars-sit-2025/model"
+	"github.com/hashicorp/consul/api"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+)
+
+var auditTracer = otel.Tracer("repositories/audit")
+
+const auditPrefix = "audit/"
+
+// AuditRepository is an append-only store. Keys start with a zero-padded
+// nanosecond timestamp so a prefix listing returns entries in time order.
+type AuditRepository struct {
+	kv *consulkv.KV
+}
+
+func NewAuditRepository(client *consulkv.Client) *AuditRepository {
+	return &AuditRepository{kv: client.KV()}
+}
+
+func auditKey(e model.AuditEntry) string {
+	return fmt.Sprintf("%s%020d-%s", auditPrefix, e.Timestamp.UnixNano(), e.ID)
+}
+
+// Append writes a new entry. It uses CAS with index 0 so an existing entry is
+// never overwritten.
+func (r *AuditRepository) Append(ctx context.Context, entry model.AuditEntry) error {
+	_, span := auditTracer.Start(ctx, "AuditRepository.Append")
+	defer span.End()
+
+	key := auditKey(entry)
+	span.SetAttributes(attribute.String("consul.key", key))
+
+	data, err := json.Marshal(entry)
+	if err != nil {
+		return err
+	}
+
+	ok, _, err := r.kv.CAS(&api.KVPair{Key: key, Value: data, ModifyIndex: 0}, nil)
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, "consul cas failed")
+		return err
+	}
+	if !ok {
+		return errors.New("audit entry already exists")
+	}
+	return nil
+}
+
+// auditBatch is how many entries List reads per transaction.
+const auditBatch = 64
+
+// auditKeysFrom drops the keys before filter.Since and up to the cursor
+// filter.After. Keys sort by time, so this needs no values.
+func auditKeysFrom(keys []string, filter model.AuditFilter) []string {
+	start := auditPrefix
+	if !filter.Since.IsZero() {
+		start = fmt.Sprintf("%s%020d", auditPrefix, filter.Since.UnixNano())
+	}
+	if filter.After != "" && auditPrefix+filter.After >= start {
+		start = auditPrefix + filter.After + "\x00"
+	}
+	return keys[sort.SearchStrings(keys, start):]
+}
+
+// List returns matching entries, oldest first. Only keys are listed for the
+// whole trail; values are read from Since or the cursor on, and reading stops
+// once Limit entries matched. The second result is the cursor of the next
+// page, empty when there is none.
+func (r *AuditRepository) List(ctx context.Context, filter model.AuditFilter) ([]model.AuditEntry, string, error) {
+	ctx, span := auditTracer.Start(ctx, "AuditRepository.List")
+	defer span.End()
+
+	keys, _, err := r.kv.Keys(auditPrefix, "", (&api.QueryOptions{}).WithContext(ctx))
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, "consul keys failed")
+		return nil, "", err
+	}
+	keys = auditKeysFrom(keys, filter)
+
+	out := []model.AuditEntry{}
+	for len(keys) > 0 {
+		batch := keys[:min(auditBatch, len(keys))]
+		keys = keys[len(batch):]
+
+		ops := make(api.KVTxnOps, len(batch))
+		for i, key := range batch {
+			ops[i] = &api.KVTxnOp{Verb: api.KVGet, Key: key}
+		}
+		ok, resp, _, err := r.kv.Txn(ops, (&api.QueryOptions{}).WithContext(ctx))
+		if err == nil && !ok {
+			err = errors.New("consul txn failed")
+		}
+		if err != nil {
+			span.RecordError(err)
+			span.SetStatus(codes.Error, "consul txn failed")
+			return nil, "", err
+		}
+
+		for _, p := range resp.Results {
+			var e model.AuditEntry
+			if err := json.Unmarshal(p.Value, &e); err != nil {
+				return nil, "", err
+			}
+			if filter.Target != "" && e.Target != filter.Target {
+				continue
+			}
+			if filter.Actor != "" && e.Actor != filter.Actor {
+				continue
+			}
+			out = append(out, e)
+			if filter.Limit > 0 && len(out) == filter.Limit {
+				span.SetAttributes(attribute.Int("audit.entries", len(out)))
+				return out, strings.TrimPrefix(p.Key, auditPrefix), nil
+			}
+		}
+	}
+	span.SetAttributes(attribute.Int("audit.entries", len(out)))
+	return out, "", nil
+}
@@ -0,0 +1,35 @@
+package repositories
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/anjaobradovic/ars-sit-2025/model"
+)
+
+func TestAuditKeysFrom(t *testing.T) {
+	at := func(sec int64, id string) string {
+		return auditKey(model.AuditEntry{ID: id, Timestamp: time.Unix(sec, 0)})
+	}
+	keys := []string{at(10, "a"), at(20, "b"), at(20, "c"), at(30, "d")}
+
+	cases := map[string]struct {
+		filter model.AuditFilter
+		want   []string
+	}{
+		"all":             {model.AuditFilter{}, keys},
+		"since":           {model.AuditFilter{Since: time.Unix(20, 0)}, keys[1:]},
+		"cursor":          {model.AuditFilter{After: keys[1][len(auditPrefix):]}, keys[2:]},
+		"cursor wins":     {model.AuditFilter{Since: time.Unix(10, 0), After: keys[2][len(auditPrefix):]}, keys[3:]},
+		"since wins":      {model.AuditFilter{Since: time.Unix(30, 0), After: keys[0][len(auditPrefix):]}, keys[3:]},
+		"after last page": {model.AuditFilter{After: keys[3][len(auditPrefix):]}, []string{}},
+	}
+	for name, tc := range cases {
+		t.Run(name, func(t *testing.T) {
+			if got := auditKeysFrom(keys, tc.filter); !reflect.DeepEqual(got, tc.want) {
+				t.Errorf("got %v, want %v", got, tc.want)
+			}
+		})
+	}
+}
@@ -1,99 +1,265 @@
 package repositories
 
 import (
+	"context"
 	"encoding/json"
 	"errors"
 	"fmt"
-	"log"
+	"log/slog"
+	"time"
 
+	"github.com/anjaobradovic/ars-sit-2025/consulkv"
 	"github.com/anjaobradovic/ars-sit-2025/model"
 	"github.com/hashicorp/consul/api"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
 )
 
+var groupTracer = otel.Tracer("repositories/group")
+
 type GroupRepository struct {
-	kv *api.KV
+	kv *consulkv.KV
 }
 
-func NewGroupRepository(consulAddr string) (*GroupRepository, error) {
-	cfg := api.DefaultConfig()
-	cfg.Address = consulAddr
-
-	client, err := api.NewClient(cfg)
-	if err != nil {
-		return nil, err
-	}
-
-	return &GroupRepository{kv: client.KV()}, nil
+func NewGroupRepository(client *consulkv.Client) *GroupRepository {
+	return &GroupRepository{kv: client.KV()}
 }
 
-func groupKey(name, version string) string {
+// GroupKey is the Consul key a group version is stored under.
+func GroupKey(name, version string) string {
 	return fmt.Sprintf("groups/%s/%s", name, version)
 }
 
-func (r *GroupRepository) Save(group model.ConfigurationGroup) error {
-	key := groupKey(group.Name, group.Version)
+func (r *GroupRepository) Save(ctx context.Context, group model.ConfigurationGroup) error {
+	ctx, span := groupTracer.Start(ctx, "GroupRepository.Save")
+	defer span.End()
 
-	existing, _, err := r.kv.Get(key, nil)
-	if err != nil {
-		return err
-	}
-	if existing != nil {
-		return errors.New("group with this name and version already exists")
+	key := GroupKey(group.Name, group.Version)
+	span.SetAttributes(
+		attribute.String("consul.key", key),
+		attribute.String("group.name", group.Name),
+		attribute.String("group.version", group.Version),
+	)
+
+	{
+		_, s := groupTracer.Start(ctx, "consul.kv.get")
+		s.SetAttributes(attribute.String("consul.key", key))
+		existing, _, err := r.kv.Get(key, (&api.QueryOptions{}).WithContext(ctx))
+		if err != nil {
+			s.RecordError(err)
+			s.SetStatus(codes.Error, "consul get failed")
+			s.End()
+			return err
+		}
+		s.End()
+
+		if existing != nil {
+			err := errors.New("group with this name and version already exists")
+			span.RecordError(err)
+			span.SetStatus(codes.Error, "conflict")
+			return err
+		}
 	}
 
 	data, err := json.Marshal(group)
 	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, "marshal failed")
 		return err
 	}
 
-	log.Printf("Repository: saving new group %s %s", group.Name, group.Version)
-	_, err = r.kv.Put(&api.KVPair{
-		Key:   key,
-		Value: data,
-	}, nil)
+	slog.DebugContext(ctx, "saving group", "group", group.Name, "group_version", group.Version)
+	{
+		_, s := groupTracer.Start(ctx, "consul.kv.put")
+		s.SetAttributes(attribute.String("consul.key", key))
+		_, err = r.kv.Put(&api.KVPair{Key: key, Value: data}, (&api.WriteOptions{}).WithContext(ctx))
+		if err != nil {
+			s.RecordError(err)
+			s.SetStatus(codes.Error, "consul put failed")
+			s.End()
+			return err
+		}
+		s.End()
+	}
+
+	return nil
+}
 
-	return err
+func (r *GroupRepository) GetByNameAndVersion(ctx context.Context, name, version string) (*model.ConfigurationGroup, error) {
+	group, _, err := r.WaitByNameAndVersion(ctx, name, version, 0, 0)
+	return group, err
 }
 
-func (r *GroupRepository) GetByNameAndVersion(name, version string) (*model.ConfigurationGroup, error) {
-	key := groupKey(name, version)
+// WaitByNameAndVersion is the blocking-query variant of GetByNameAndVersion.
+// It returns once the group's ModifyIndex exceeds waitIndex or wait expires,
+// together with the index to use for the next call.
+func (r *GroupRepository) WaitByNameAndVersion(ctx context.Context, name, version string, waitIndex uint64, wait time.Duration) (*model.ConfigurationGroup, uint64, error) {
+	ctx, span := groupTracer.Start(ctx, "GroupRepository.GetByNameAndVersion")
+	defer span.End()
 
-	pair, _, err := r.kv.Get(key, nil)
-	if err != nil {
-		return nil, err
+	key := GroupKey(name, version)
+	span.SetAttributes(
+		attribute.String("consul.key", key),
+		attribute.String("group.name", name),
+		attribute.String("group.version", version),
+		attribute.Int64("consul.wait_index", int64(waitIndex)),
+	)
+
+	var pair *api.KVPair
+	var meta *api.QueryMeta
+	{
+		_, s := groupTracer.Start(ctx, "consul.kv.get")
+		s.SetAttributes(attribute.String("consul.key", key))
+		q := (&api.QueryOptions{WaitIndex: waitIndex, WaitTime: wait}).WithContext(ctx)
+		var err error
+		pair, meta, err = r.kv.Get(key, q)
+		if err != nil {
+			s.RecordError(err)
+			s.SetStatus(codes.Error, "consul get failed")
+			s.End()
+			return nil, 0, err
+		}
+		s.End()
 	}
+
 	if pair == nil {
-		return nil, errors.New("group not found")
+		err := errors.New("group not found")
+		span.RecordError(err)
+		span.SetStatus(codes.Error, "not found")
+		return nil, meta.LastIndex, err
 	}
 
 	var group model.ConfigurationGroup
 	if err := json.Unmarshal(pair.Value, &group); err != nil {
-		return nil, err
+		span.RecordError(err)
+		span.SetStatus(codes.Error, "unmarshal failed")
+		return nil, 0, err
 	}
 
-	return &group, nil
+	return &group, meta.LastIndex, nil
 }
 
-func (r *GroupRepository) DeleteByNameAndVersion(name, version string) error {
-	key := groupKey(name, version)
-	_, err := r.kv.Delete(key, nil)
-	return err
+func (r *GroupRepository) DeleteByNameAndVersion(ctx context.Context, name, version string) error {
+	ctx, span := groupTracer.Start(ctx, "GroupRepository.DeleteByNameAndVersion")
+	defer span.End()
+
+	key := GroupKey(name, version)
+	span.SetAttributes(
+		attribute.String("consul.key", key),
+		attribute.String("group.name", name),
+		attribute.String("group.version", version),
+	)
+
+	_, s := groupTracer.Start(ctx, "consul.kv.delete")
+	defer s.End()
+	s.SetAttributes(attribute.String("consul.key", key))
+	if _, err := r.kv.Delete(key, (&api.WriteOptions{}).WithContext(ctx)); err != nil {
+		s.RecordError(err)
+		s.SetStatus(codes.Error, "consul delete failed")
+		return err
+	}
+	return nil
 }
 
-func (r *GroupRepository) Update(group model.ConfigurationGroup) error {
-	key := groupKey(group.Name, group.Version)
+func (r *GroupRepository) Update(ctx context.Context, group model.ConfigurationGroup) error {
+	ctx, span := groupTracer.Start(ctx, "GroupRepository.Update")
+	defer span.End()
+
+	key := GroupKey(group.Name, group.Version)
+	span.SetAttributes(
+		attribute.String("consul.key", key),
+		attribute.String("group.name", group.Name),
+		attribute.String("group.version", group.Version),
+		attribute.Int("group.configs", len(group.Configurations)),
+	)
 
 	data, err := json.Marshal(group)
 	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, "marshal failed")
 		return err
 	}
 
-	log.Printf("Repository: updating group %s %s with configs: %+v", group.Name, group.Version, group.Configurations)
+	slog.DebugContext(ctx, "updating group", "group", group.Name, "group_version", group.Version, "configs", len(group.Configurations))
+
+	_, s := groupTracer.Start(ctx, "consul.kv.put")
+	defer s.End()
+	s.SetAttributes(attribute.String("consul.key", key))
+	if _, err := r.kv.Put(&api.KVPair{Key: key, Value: data}, (&api.WriteOptions{}).WithContext(ctx)); err != nil {
+		s.RecordError(err)
+		s.SetStatus(codes.Error, "consul put failed")
+		return err
+	}
+	return nil
+}
+
+// Rewrite applies fn to every stored group and writes back the ones it
+// reports as changed, using CAS so concurrent updates are never lost.
+func (r *GroupRepository) Rewrite(ctx context.Context, fn func(*model.ConfigurationGroup) (bool, error)) (int, error) {
+	ctx, span := groupTracer.Start(ctx, "GroupRepository.Rewrite")
+	defer span.End()
+
+	pairs, _, err := r.kv.List("groups/", (&api.QueryOptions{}).WithContext(ctx))
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, "consul list failed")
+		return 0, err
+	}
+
+	rewritten := 0
+	for _, pair := range pairs {
+		var group model.ConfigurationGroup
+		if err := json.Unmarshal(pair.Value, &group); err != nil {
+			return rewritten, fmt.Errorf("%s: %w", pair.Key, err)
+		}
+
+		changed, err := fn(&group)
+		if err != nil {
+			return rewritten, err
+		}
+		if !changed {
+			continue
+		}
+
+		data, err := json.Marshal(group)
+		if err != nil {
+			return rewritten, err
+		}
+
+		ok, _, err := r.kv.CAS(&api.KVPair{Key: pair.Key, Value: data, ModifyIndex: pair.ModifyIndex}, (&api.WriteOptions{}).WithContext(ctx))
+		if err != nil {
+			span.RecordError(err)
+			return rewritten, err
+		}
+		if !ok {
+			return rewritten, fmt.Errorf("%s changed during rewrite, run it again", pair.Key)
+		}
+		rewritten++
+	}
+	return rewritten, nil
+}
 
-	_, err = r.kv.Put(&api.KVPair{
-		Key:   key,
-		Value: data,
-	}, nil)
+// List returns every stored group version.
+func (r *GroupRepository) List(ctx context.Context) ([]model.ConfigurationGroup, error) {
+	ctx, span := groupTracer.Start(ctx, "GroupRepository.List")
+	defer span.End()
 
-	return err
+	pairs, _, err := r.kv.List("groups/", (&api.QueryOptions{}).WithContext(ctx))
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, "consul list failed")
+		return nil, err
+	}
+
+	groups := make([]model.ConfigurationGroup, 0, len(pairs))
+	for _, pair := range pairs {
+		var group model.ConfigurationGroup
+		if err := json.Unmarshal(pair.Value, &group); err != nil {
+			return nil, fmt.Errorf("%s: %w", pair.Key, err)
+		}
+		groups = append(groups, group)
+	}
+	return groups, nil
 }
@@ -5,7 +5,10 @@ import (
 	"encoding/json"
 	"errors"
 	"fmt"
+	"strings"
+	"time"
 
+	"github.com/anjaobradovic/ars-sit-2025/consulkv"
 	"github.com/anjaobradovic/ars-sit-2025/model"
 	"github.com/hashicorp/consul/api"
 
@@ -17,24 +20,23 @@ import (
 var tracer = otel.Tracer("repositories/config")
 
 type ConfigRepository struct {
-	kv *api.KV
+	kv *consulkv.KV
 }
 
-func NewConfigRepository(addr string) (*ConfigRepository, error) {
-	cfg := api.DefaultConfig()
-	cfg.Address = addr
-	client, err := api.NewClient(cfg)
-	if err != nil {
-		return nil, err
-	}
-	return &ConfigRepository{kv: client.KV()}, nil
+func NewConfigRepository(client *consulkv.Client) *ConfigRepository {
+	return &ConfigRepository{kv: client.KV()}
+}
+
+// ConfigKey is the Consul key a configuration version is stored under.
+func ConfigKey(name, version string) string {
+	return fmt.Sprintf("configs/%s/%s", name, version)
 }
 
 func (r *ConfigRepository) Save(ctx context.Context, config model.Config) error {
 	ctx, span := tracer.Start(ctx, "ConfigRepository.Save")
 	defer span.End()
 
-	key := fmt.Sprintf("configs/%s/%s", config.Name, config.Version)
+	key := ConfigKey(config.Name, config.Version)
 	span.SetAttributes(
 		attribute.String("consul.key", key),
 		attribute.String("config.name", config.Name),
@@ -86,27 +88,39 @@ func (r *ConfigRepository) Save(ctx context.Context, config model.Config) error
 }
 
 func (r *ConfigRepository) GetByNameAndVersion(ctx context.Context, name, version string) (*model.Config, error) {
+	cfg, _, err := r.WaitByNameAndVersion(ctx, name, version, 0, 0)
+	return cfg, err
+}
+
+// WaitByNameAndVersion performs a Consul blocking query for a configuration.
+// With waitIndex 0 it returns immediately; otherwise the call blocks until
+// the key's ModifyIndex moves past waitIndex or wait expires. The returned
+// index is the one clients should pass on their next call.
+func (r *ConfigRepository) WaitByNameAndVersion(ctx context.Context, name, version string, waitIndex uint64, wait time.Duration) (*model.Config, uint64, error) {
 	ctx, span := tracer.Start(ctx, "ConfigRepository.GetByNameAndVersion")
 	defer span.End()
 
-	key := fmt.Sprintf("configs/%s/%s", name, version)
+	key := ConfigKey(name, version)
 	span.SetAttributes(
 		attribute.String("consul.key", key),
 		attribute.String("config.name", name),
 		attribute.String("config.version", version),
+		attribute.Int64("consul.wait_index", int64(waitIndex)),
 	)
 
 	var pair *api.KVPair
+	var meta *api.QueryMeta
 	{
 		_, s := tracer.Start(ctx, "consul.kv.get")
 		s.SetAttributes(attribute.String("consul.key", key))
+		q := (&api.QueryOptions{WaitIndex: waitIndex, WaitTime: wait}).WithContext(ctx)
 		var err error
-		pair, _, err = r.kv.Get(key, nil)
+		pair, meta, err = r.kv.Get(key, q)
 		if err != nil {
 			s.RecordError(err)
 			s.SetStatus(codes.Error, "consul get failed")
 			s.End()
-			return nil, err
+			return nil, 0, err
 		}
 		s.End()
 	}
@@ -115,42 +129,149 @@ func (r *ConfigRepository) GetByNameAndVersion(ctx context.Context, name, versio
 		err := errors.New("configuration not found")
 		span.RecordError(err)
 		span.SetStatus(codes.Error, "not found")
-		return nil, err
+		return nil, meta.LastIndex, err
 	}
 
 	var cfg model.Config
 	if err := json.Unmarshal(pair.Value, &cfg); err != nil {
 		span.RecordError(err)
 		span.SetStatus(codes.Error, "unmarshal failed")
-		return nil, err
+		return nil, 0, err
 	}
 
-	return &cfg, nil
+	return &cfg, meta.LastIndex, nil
 }
 
-func (r *ConfigRepository) DeleteByNameAndVersion(ctx context.Context, name, version string) error {
+// DeleteByNameAndVersion removes a configuration and reports whether it
+// existed. The delete is a CAS on the version read, so a concurrent delete
+// is reported by exactly one caller.
+func (r *ConfigRepository) DeleteByNameAndVersion(ctx context.Context, name, version string) (bool, error) {
 	ctx, span := tracer.Start(ctx, "ConfigRepository.DeleteByNameAndVersion")
 	defer span.End()
 
-	key := fmt.Sprintf("configs/%s/%s", name, version)
+	key := ConfigKey(name, version)
 	span.SetAttributes(
 		attribute.String("consul.key", key),
 		attribute.String("config.name", name),
 		attribute.String("config.version", version),
 	)
 
-	{
+	for {
+		pair, _, err := r.kv.Get(key, (&api.QueryOptions{}).WithContext(ctx))
+		if err != nil {
+			span.RecordError(err)
+			span.SetStatus(codes.Error, "consul get failed")
+			return false, err
+		}
+		if pair == nil {
+			return false, nil
+		}
+
 		_, s := tracer.Start(ctx, "consul.kv.delete")
 		s.SetAttributes(attribute.String("consul.key", key))
-		_, err := r.kv.Delete(key, nil)
+		ok, _, err := r.kv.DeleteCAS(pair, (&api.WriteOptions{}).WithContext(ctx))
 		if err != nil {
 			s.RecordError(err)
 			s.SetStatus(codes.Error, "consul delete failed")
 			s.End()
-			return err
+			return false, err
 		}
 		s.End()
+		if ok {
+			return true, nil
+		}
+		// Izmenjena u međuvremenu: pročitaj ponovo
 	}
+}
 
-	return nil
+// Rewrite applies fn to every stored configuration and writes back the ones
+// it reports as changed. Writes use CAS, so a configuration replaced or
+// deleted meanwhile is not overwritten; that is reported as an error and the
+// rewrite can simply be run again.
+func (r *ConfigRepository) Rewrite(ctx context.Context, fn func(*model.Config) (bool, error)) (int, error) {
+	ctx, span := tracer.Start(ctx, "ConfigRepository.Rewrite")
+	defer span.End()
+
+	var pairs api.KVPairs
+	{
+		_, s := tracer.Start(ctx, "consul.kv.list")
+		s.SetAttributes(attribute.String("consul.prefix", "configs/"))
+		var err error
+		pairs, _, err = r.kv.List("configs/", (&api.QueryOptions{}).WithContext(ctx))
+		if err != nil {
+			s.RecordError(err)
+			s.SetStatus(codes.Error, "consul list failed")
+			s.End()
+			return 0, err
+		}
+		s.End()
+	}
+
+	rewritten := 0
+	for _, pair := range pairs {
+		var cfg model.Config
+		if err := json.Unmarshal(pair.Value, &cfg); err != nil {
+			return rewritten, fmt.Errorf("%s: %w", pair.Key, err)
+		}
+
+		changed, err := fn(&cfg)
+		if err != nil {
+			return rewritten, err
+		}
+		if !changed {
+			continue
+		}
+
+		b, err := json.Marshal(cfg)
+		if err != nil {
+			return rewritten, err
+		}
+
+		_, s := tracer.Start(ctx, "consul.kv.cas")
+		s.SetAttributes(attribute.String("consul.key", pair.Key))
+		ok, _, err := r.kv.CAS(&api.KVPair{Key: pair.Key, Value: b, ModifyIndex: pair.ModifyIndex}, nil)
+		if err != nil {
+			s.RecordError(err)
+			s.SetStatus(codes.Error, "consul cas failed")
+			s.End()
+			return rewritten, err
+		}
+		s.End()
+		if !ok {
+			return rewritten, fmt.Errorf("%s changed during rewrite, run it again", pair.Key)
+		}
+		rewritten++
+	}
+
+	span.SetAttributes(attribute.Int("rewritten", rewritten))
+	return rewritten, nil
+}
+
+// CountVersions returns how many versions every configuration has. Only keys
+// are read.
+func (r *ConfigRepository) CountVersions(ctx context.Context) (map[string]int, error) {
+	ctx, span := tracer.Start(ctx, "ConfigRepository.CountVersions")
+	defer span.End()
+
+	keys, _, err := r.kv.Keys("configs/", "", (&api.QueryOptions{}).WithContext(ctx))
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, "consul keys failed")
+		return nil, err
+	}
+	return countVersions(keys, "configs/"), nil
+}
+
+// countVersions groups "<prefix><name>/<version>" keys by name.
+func countVersions(keys []string, prefix string) map[string]int {
+	out := map[string]int{}
+	for _, k := range keys {
+		rest := strings.TrimPrefix(k, prefix)
+		i := strings.LastIndexByte(rest, '/')
+		if i <= 0 {
+			continue
+		}
+		out[rest[:i]]++
+	}
+	return out
 }
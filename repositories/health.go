@@ -0,0 +1,78 @@
+package repositories
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"os"
+	"strconv"
+	"time"
+
+	"github.com/anjaobradovic/ars-sit-2025/consulkv"
+	"github.com/hashicorp/consul/api"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/codes"
+)
+
+var healthTracer = otel.Tracer("repositories/health")
+
+const healthPrefix = "health/"
+
+// HealthRepository probes Consul for the readiness checks.
+type HealthRepository struct {
+	client *api.Client
+	kv     *consulkv.KV
+	key    string
+}
+
+func NewHealthRepository(client *consulkv.Client) *HealthRepository {
+	// Every replica probes its own key
+	instance, _ := os.Hostname()
+	if instance == "" {
+		instance = "default"
+	}
+
+	return &HealthRepository{client: client.API(), kv: client.KV(), key: healthPrefix + instance}
+}
+
+// Leader fails unless the Consul cluster has an elected leader.
+func (r *HealthRepository) Leader(ctx context.Context) error {
+	ctx, span := healthTracer.Start(ctx, "HealthRepository.Leader")
+	defer span.End()
+
+	leader, err := r.client.Status().LeaderWithQueryOptions((&api.QueryOptions{}).WithContext(ctx))
+	if err == nil && leader == "" {
+		err = errors.New("consul has no leader")
+	}
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, "consul leader check failed")
+		return err
+	}
+	return nil
+}
+
+// RoundTrip writes a value to the probe key and reads it back.
+func (r *HealthRepository) RoundTrip(ctx context.Context) error {
+	ctx, span := healthTracer.Start(ctx, "HealthRepository.RoundTrip")
+	defer span.End()
+
+	value := []byte(strconv.FormatInt(time.Now().UnixNano(), 10))
+	if _, err := r.kv.Put(&api.KVPair{Key: r.key, Value: value}, (&api.WriteOptions{}).WithContext(ctx)); err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, "consul put failed")
+		return err
+	}
+
+	pair, _, err := r.kv.Get(r.key, (&api.QueryOptions{}).WithContext(ctx))
+	if err == nil && (pair == nil || !bytes.Equal(pair.Value, value)) {
+		err = errors.New("consul returned a different value than was written")
+	}
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, "consul get failed")
+		return err
+	}
+	return nil
+}
@@ -0,0 +1,214 @@
+package repositories
+
+import (
+	"context"
+	"encoding/json"
+	"time"
+
+	"github.com/anjaobradovic/ars-sit-2025/consulkv"
+	"github.com/anjaobradovic/ars-sit-2025/model"
+	"github.com/google/uuid"
+	"github.com/hashicorp/consul/api"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+)
+
+var idempotencyTracer = otel.Tracer("repositories/idempotency")
+
+const idempotencyPrefix = "idempotency/"
+
+// IdempotencyStore keeps the record of every request sent with an
+// Idempotency-Key. Versions make reservations race-free: Reserve only
+// succeeds if the key is still at the version Get returned, 0 meaning absent.
+// Each reservation gets an owner token, so a request whose lease expired and
+// whose key was reclaimed cannot overwrite or delete the new holder's record.
+type IdempotencyStore interface {
+	// Get returns the record for key and its version, or nil and 0.
+	Get(ctx context.Context, key string) (*model.IdempotencyRecord, uint64, error)
+	// Reserve stores an in-progress record if key is still at version and
+	// returns the owner token of the reservation.
+	Reserve(ctx context.Context, key string, record model.IdempotencyRecord, version uint64) (string, bool, error)
+	// Complete replaces the record with the final response if key is still
+	// held by owner.
+	Complete(ctx context.Context, key, owner string, record model.IdempotencyRecord) (bool, error)
+	// Release forgets key so the request can be retried, if it is still
+	// held by owner.
+	Release(ctx context.Context, key, owner string) (bool, error)
+	// Sweep deletes records expired at now and returns how many it removed.
+	Sweep(ctx context.Context, now time.Time) (int, error)
+	// Count returns how many records are stored.
+	Count(ctx context.Context) (int, error)
+}
+
+// ConsulIdempotencyStore keeps records under idempotency/ in Consul so every
+// replica sees the same keys.
+type ConsulIdempotencyStore struct {
+	kv *consulkv.KV
+}
+
+func NewConsulIdempotencyStore(client *consulkv.Client) *ConsulIdempotencyStore {
+	return &ConsulIdempotencyStore{kv: client.KV()}
+}
+
+func (s *ConsulIdempotencyStore) Get(ctx context.Context, key string) (*model.IdempotencyRecord, uint64, error) {
+	_, span := idempotencyTracer.Start(ctx, "ConsulIdempotencyStore.Get")
+	defer span.End()
+
+	span.SetAttributes(attribute.String("consul.key", idempotencyPrefix+key))
+
+	pair, _, err := s.kv.Get(idempotencyPrefix+key, nil)
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, "consul get failed")
+		return nil, 0, err
+	}
+	if pair == nil {
+		return nil, 0, nil
+	}
+
+	var record model.IdempotencyRecord
+	if err := json.Unmarshal(pair.Value, &record); err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, "unmarshal failed")
+		return nil, 0, err
+	}
+	return &record, pair.ModifyIndex, nil
+}
+
+func (s *ConsulIdempotencyStore) Reserve(ctx context.Context, key string, record model.IdempotencyRecord, version uint64) (string, bool, error) {
+	_, span := idempotencyTracer.Start(ctx, "ConsulIdempotencyStore.Reserve")
+	defer span.End()
+
+	span.SetAttributes(attribute.String("consul.key", idempotencyPrefix+key))
+
+	record.Owner = uuid.NewString()
+	data, err := json.Marshal(record)
+	if err != nil {
+		return "", false, err
+	}
+
+	ok, _, err := s.kv.CAS(&api.KVPair{Key: idempotencyPrefix + key, Value: data, ModifyIndex: version}, nil)
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, "consul cas failed")
+		return "", false, err
+	}
+	if !ok {
+		span.SetStatus(codes.Error, "cas not successful (concurrent request)")
+		return "", false, nil
+	}
+	return record.Owner, true, nil
+}
+
+func (s *ConsulIdempotencyStore) Complete(ctx context.Context, key, owner string, record model.IdempotencyRecord) (bool, error) {
+	ctx, span := idempotencyTracer.Start(ctx, "ConsulIdempotencyStore.Complete")
+	defer span.End()
+
+	span.SetAttributes(attribute.String("consul.key", idempotencyPrefix+key))
+
+	data, err := json.Marshal(record)
+	if err != nil {
+		return false, err
+	}
+
+	version, err := s.owned(ctx, key, owner)
+	if err != nil || version == 0 {
+		return false, err
+	}
+
+	ok, _, err := s.kv.CAS(&api.KVPair{Key: idempotencyPrefix + key, Value: data, ModifyIndex: version}, nil)
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, "consul cas failed")
+		return false, err
+	}
+	if !ok {
+		span.SetStatus(codes.Error, "reservation lost")
+	}
+	return ok, nil
+}
+
+func (s *ConsulIdempotencyStore) Release(ctx context.Context, key, owner string) (bool, error) {
+	ctx, span := idempotencyTracer.Start(ctx, "ConsulIdempotencyStore.Release")
+	defer span.End()
+
+	span.SetAttributes(attribute.String("consul.key", idempotencyPrefix+key))
+
+	version, err := s.owned(ctx, key, owner)
+	if err != nil || version == 0 {
+		return false, err
+	}
+
+	ok, _, err := s.kv.DeleteCAS(&api.KVPair{Key: idempotencyPrefix + key, ModifyIndex: version}, nil)
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, "consul delete failed")
+		return false, err
+	}
+	if !ok {
+		span.SetStatus(codes.Error, "reservation lost")
+	}
+	return ok, nil
+}
+
+// owned returns the version of key if owner still holds it, or 0 if the key
+// is gone or was reclaimed by another request.
+func (s *ConsulIdempotencyStore) owned(ctx context.Context, key, owner string) (uint64, error) {
+	record, version, err := s.Get(ctx, key)
+	if err != nil {
+		return 0, err
+	}
+	if record == nil || record.Owner != owner {
+		trace.SpanFromContext(ctx).SetStatus(codes.Error, "reservation lost")
+		return 0, nil
+	}
+	return version, nil
+}
+
+// Sweep deletes with CAS, so a key reclaimed in the meantime is left alone
+// and several replicas may sweep at once.
+func (s *ConsulIdempotencyStore) Sweep(ctx context.Context, now time.Time) (int, error) {
+	ctx, span := idempotencyTracer.Start(ctx, "ConsulIdempotencyStore.Sweep")
+	defer span.End()
+
+	pairs, _, err := s.kv.List(idempotencyPrefix, (&api.QueryOptions{}).WithContext(ctx))
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, "consul list failed")
+		return 0, err
+	}
+
+	deleted := 0
+	for _, pair := range pairs {
+		var record model.IdempotencyRecord
+		if err := json.Unmarshal(pair.Value, &record); err == nil && !record.Expired(now) {
+			continue
+		}
+		ok, _, err := s.kv.DeleteCAS(pair, (&api.WriteOptions{}).WithContext(ctx))
+		if err != nil {
+			span.RecordError(err)
+			return deleted, err
+		}
+		if ok {
+			deleted++
+		}
+	}
+	span.SetAttributes(attribute.Int("idempotency.swept", deleted))
+	return deleted, nil
+}
+
+func (s *ConsulIdempotencyStore) Count(ctx context.Context) (int, error) {
+	ctx, span := idempotencyTracer.Start(ctx, "ConsulIdempotencyStore.Count")
+	defer span.End()
+
+	keys, _, err := s.kv.Keys(idempotencyPrefix, "", (&api.QueryOptions{}).WithContext(ctx))
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, "consul keys failed")
+		return 0, err
+	}
+	return len(keys), nil
+}
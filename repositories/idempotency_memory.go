@@ -0,0 +1,151 @@
+package repositories
+
+import (
+	"container/list"
+	"context"
+	"sync"
+	"time"
+
+	"github.com/anjaobradovic/ars-sit-2025/model"
+	"github.com/google/uuid"
+)
+
+// MemoryIdempotencyStore keeps records in process, for tests and single-node
+// deployments. It holds at most capacity keys and evicts the least recently
+// used one when full. Expired records stay until Sweep or a new request
+// reclaims them.
+type MemoryIdempotencyStore struct {
+	mu       sync.Mutex
+	capacity int
+	version  uint64
+	order    *list.List // front = most recently used
+	entries  map[string]*list.Element
+}
+
+type memoryIdempotencyEntry struct {
+	key     string
+	record  model.IdempotencyRecord
+	version uint64
+}
+
+func NewMemoryIdempotencyStore(capacity int) *MemoryIdempotencyStore {
+	if capacity <= 0 {
+		capacity = 10000
+	}
+	return &MemoryIdempotencyStore{
+		capacity: capacity,
+		order:    list.New(),
+		entries:  map[string]*list.Element{},
+	}
+}
+
+func (s *MemoryIdempotencyStore) Get(_ context.Context, key string) (*model.IdempotencyRecord, uint64, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	el, ok := s.entries[key]
+	if !ok {
+		return nil, 0, nil
+	}
+	s.order.MoveToFront(el)
+
+	e := el.Value.(*memoryIdempotencyEntry)
+	record := e.record
+	return &record, e.version, nil
+}
+
+func (s *MemoryIdempotencyStore) Reserve(_ context.Context, key string, record model.IdempotencyRecord, version uint64) (string, bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	el, ok := s.entries[key]
+	switch {
+	case !ok && version != 0:
+		return "", false, nil
+	case ok && el.Value.(*memoryIdempotencyEntry).version != version:
+		return "", false, nil
+	}
+
+	record.Owner = uuid.NewString()
+	s.put(key, record)
+	return record.Owner, true, nil
+}
+
+func (s *MemoryIdempotencyStore) Complete(_ context.Context, key, owner string, record model.IdempotencyRecord) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.owned(key, owner) == nil {
+		return false, nil
+	}
+	s.put(key, record)
+	return true, nil
+}
+
+func (s *MemoryIdempotencyStore) Release(_ context.Context, key, owner string) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	el := s.owned(key, owner)
+	if el == nil {
+		return false, nil
+	}
+	s.remove(el)
+	return true, nil
+}
+
+func (s *MemoryIdempotencyStore) Sweep(_ context.Context, now time.Time) (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	deleted := 0
+	for el := s.order.Back(); el != nil; {
+		prev := el.Prev()
+		if el.Value.(*memoryIdempotencyEntry).record.Expired(now) {
+			s.remove(el)
+			deleted++
+		}
+		el = prev
+	}
+	return deleted, nil
+}
+
+func (s *MemoryIdempotencyStore) Count(_ context.Context) (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.order.Len(), nil
+}
+
+// owned returns the entry for key if owner still holds it. Callers hold the
+// lock.
+func (s *MemoryIdempotencyStore) owned(key, owner string) *list.Element {
+	el, ok := s.entries[key]
+	if !ok || el.Value.(*memoryIdempotencyEntry).record.Owner != owner {
+		return nil
+	}
+	return el
+}
+
+// put writes the record under a new version. Callers hold the lock.
+func (s *MemoryIdempotencyStore) put(key string, record model.IdempotencyRecord) {
+	s.version++
+
+	if el, ok := s.entries[key]; ok {
+		e := el.Value.(*memoryIdempotencyEntry)
+		e.record = record
+		e.version = s.version
+		s.order.MoveToFront(el)
+		return
+	}
+
+	s.entries[key] = s.order.PushFront(&memoryIdempotencyEntry{key: key, record: record, version: s.version})
+	for s.order.Len() > s.capacity {
+		s.remove(s.order.Back())
+	}
+}
+
+func (s *MemoryIdempotencyStore) remove(el *list.Element) {
+	s.order.Remove(el)
+	delete(s.entries, el.Value.(*memoryIdempotencyEntry).key)
+}
@@ -0,0 +1,108 @@
+package repositories
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+
+	"github.com/anjaobradovic/ars-sit-2025/consulkv"
+	"github.com/anjaobradovic/ars-sit-2025/model"
+	"github.com/hashicorp/consul/api"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+)
+
+var policyTracer = otel.Tracer("repositories/policy")
+
+var ErrRoleBindingNotFound = errors.New("role binding not found")
+
+const roleBindingPrefix = "auth/policies/"
+
+type PolicyRepository struct {
+	kv *consulkv.KV
+}
+
+func NewPolicyRepository(client *consulkv.Client) *PolicyRepository {
+	return &PolicyRepository{kv: client.KV()}
+}
+
+// RoleBindingKey is the Consul key a role binding is stored under.
+func RoleBindingKey(id string) string {
+	return roleBindingPrefix + id
+}
+
+func (r *PolicyRepository) Save(ctx context.Context, b model.RoleBinding) error {
+	_, span := policyTracer.Start(ctx, "PolicyRepository.Save")
+	defer span.End()
+
+	key := RoleBindingKey(b.ID)
+	span.SetAttributes(attribute.String("consul.key", key))
+
+	data, err := json.Marshal(b)
+	if err != nil {
+		return err
+	}
+
+	ok, _, err := r.kv.CAS(&api.KVPair{Key: key, Value: data, ModifyIndex: 0}, nil)
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, "consul cas failed")
+		return err
+	}
+	if !ok {
+		return errors.New("role binding already exists")
+	}
+	return nil
+}
+
+func (r *PolicyRepository) List(ctx context.Context) ([]model.RoleBinding, error) {
+	_, span := policyTracer.Start(ctx, "PolicyRepository.List")
+	defer span.End()
+
+	pairs, _, err := r.kv.List(roleBindingPrefix, nil)
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, "consul list failed")
+		return nil, err
+	}
+
+	out := make([]model.RoleBinding, 0, len(pairs))
+	for _, p := range pairs {
+		var b model.RoleBinding
+		if err := json.Unmarshal(p.Value, &b); err != nil {
+			return nil, err
+		}
+		out = append(out, b)
+	}
+	return out, nil
+}
+
+func (r *PolicyRepository) Delete(ctx context.Context, id string) (*model.RoleBinding, error) {
+	_, span := policyTracer.Start(ctx, "PolicyRepository.Delete")
+	defer span.End()
+
+	key := RoleBindingKey(id)
+	span.SetAttributes(attribute.String("consul.key", key))
+
+	pair, _, err := r.kv.Get(key, nil)
+	if err != nil {
+		return nil, err
+	}
+	if pair == nil {
+		return nil, ErrRoleBindingNotFound
+	}
+
+	var b model.RoleBinding
+	if err := json.Unmarshal(pair.Value, &b); err != nil {
+		return nil, err
+	}
+
+	if _, err := r.kv.Delete(key, nil); err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, "consul delete failed")
+		return nil, err
+	}
+	return &b, nil
+}
@@ -0,0 +1,111 @@
+package repositories
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"github.com/anjaobradovic/ars-sit-2025/consulkv"
+	"github.com/hashicorp/consul/api"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+)
+
+var rateLimitTracer = otel.Tracer("repositories/ratelimit")
+
+const rateLimitPrefix = "ratelimit/"
+
+// rateLimitCASAttempts bounds the retries of a contended counter.
+const rateLimitCASAttempts = 5
+
+// ErrRateLimitContention is returned when a counter could not be incremented
+// because other replicas kept winning the CAS race.
+var ErrRateLimitContention = errors.New("rate limit counter is too contended")
+
+// RateLimitRepository keeps fixed-window request counters shared by all
+// replicas. Keys are ratelimit/<window start>/<client>, so a finished window
+// is dropped with one tree delete.
+type RateLimitRepository struct {
+	kv *consulkv.KV
+}
+
+func NewRateLimitRepository(client *consulkv.Client) *RateLimitRepository {
+	return &RateLimitRepository{kv: client.KV()}
+}
+
+func rateLimitWindowPrefix(window int64) string {
+	return fmt.Sprintf("%s%d/", rateLimitPrefix, window)
+}
+
+// Increment adds one request for client in the window starting at window
+// (unix seconds) and returns the new count.
+func (r *RateLimitRepository) Increment(ctx context.Context, client string, window int64) (int, error) {
+	_, span := rateLimitTracer.Start(ctx, "RateLimitRepository.Increment")
+	defer span.End()
+
+	key := rateLimitWindowPrefix(window) + url.PathEscape(client)
+	span.SetAttributes(attribute.String("consul.key", key))
+
+	for attempt := 0; attempt < rateLimitCASAttempts; attempt++ {
+		pair, _, err := r.kv.Get(key, (&api.QueryOptions{}).WithContext(ctx))
+		if err != nil {
+			span.RecordError(err)
+			span.SetStatus(codes.Error, "consul get failed")
+			return 0, err
+		}
+
+		count := 0
+		var index uint64
+		if pair != nil {
+			count, _ = strconv.Atoi(string(pair.Value))
+			index = pair.ModifyIndex
+		}
+		count++
+
+		ok, _, err := r.kv.CAS(&api.KVPair{Key: key, Value: []byte(strconv.Itoa(count)), ModifyIndex: index}, (&api.WriteOptions{}).WithContext(ctx))
+		if err != nil {
+			span.RecordError(err)
+			span.SetStatus(codes.Error, "consul cas failed")
+			return 0, err
+		}
+		if ok {
+			span.SetAttributes(attribute.Int("ratelimit.count", count))
+			return count, nil
+		}
+	}
+
+	span.SetStatus(codes.Error, "cas contention")
+	return 0, ErrRateLimitContention
+}
+
+// DeleteBefore removes every window that started before window.
+func (r *RateLimitRepository) DeleteBefore(ctx context.Context, window int64) (int, error) {
+	_, span := rateLimitTracer.Start(ctx, "RateLimitRepository.DeleteBefore")
+	defer span.End()
+
+	prefixes, _, err := r.kv.Keys(rateLimitPrefix, "/", (&api.QueryOptions{}).WithContext(ctx))
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, "consul keys failed")
+		return 0, err
+	}
+
+	deleted := 0
+	for _, p := range prefixes {
+		start, err := strconv.ParseInt(strings.TrimSuffix(strings.TrimPrefix(p, rateLimitPrefix), "/"), 10, 64)
+		if err != nil || start >= window {
+			continue
+		}
+		if _, err := r.kv.DeleteTree(p, (&api.WriteOptions{}).WithContext(ctx)); err != nil {
+			span.RecordError(err)
+			return deleted, err
+		}
+		deleted++
+	}
+	return deleted, nil
+}
@@ -0,0 +1,370 @@
+package repositories
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+
+	"github.com/anjaobradovic/ars-sit-2025/consulkv"
+	"github.com/anjaobradovic/ars-sit-2025/model"
+	"github.com/hashicorp/consul/api"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+)
+
+var webhookTracer = otel.Tracer("repositories/webhook")
+
+var ErrSubscriptionNotFound = errors.New("webhook subscription not found")
+
+const (
+	webhookSubscriptionPrefix = "webhooks/subscriptions/"
+	webhookDeliveryPrefix     = "webhooks/deliveries/"
+	webhookQueuePrefix        = "webhooks/queue/"
+)
+
+// WebhookRepository stores subscriptions, the retry queue and the delivery log.
+// A pending delivery lives both in the queue and in the per-subscription log;
+// the queue copy is removed once the delivery succeeds or gives up.
+type WebhookRepository struct {
+	kv *consulkv.KV
+}
+
+// QueuedDelivery is a pending delivery together with the Consul index used
+// to claim it with CAS.
+type QueuedDelivery struct {
+	Delivery    model.WebhookDelivery
+	ModifyIndex uint64
+}
+
+func NewWebhookRepository(client *consulkv.Client) *WebhookRepository {
+	return &WebhookRepository{kv: client.KV()}
+}
+
+// SubscriptionKey is the Consul key a webhook subscription is stored under.
+func SubscriptionKey(id string) string {
+	return webhookSubscriptionPrefix + id
+}
+
+func deliveryKey(subscriptionID, id string) string {
+	return fmt.Sprintf("%s%s/%s", webhookDeliveryPrefix, subscriptionID, id)
+}
+
+func queueKey(id string) string {
+	return webhookQueuePrefix + id
+}
+
+func (r *WebhookRepository) SaveSubscription(ctx context.Context, sub model.WebhookSubscription) error {
+	_, span := webhookTracer.Start(ctx, "WebhookRepository.SaveSubscription")
+	defer span.End()
+
+	key := SubscriptionKey(sub.ID)
+	span.SetAttributes(attribute.String("consul.key", key))
+
+	data, err := json.Marshal(sub)
+	if err != nil {
+		return err
+	}
+
+	ok, _, err := r.kv.CAS(&api.KVPair{Key: key, Value: data, ModifyIndex: 0}, nil)
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, "consul cas failed")
+		return err
+	}
+	if !ok {
+		return errors.New("webhook subscription already exists")
+	}
+	return nil
+}
+
+func (r *WebhookRepository) GetSubscription(ctx context.Context, id string) (*model.WebhookSubscription, error) {
+	_, span := webhookTracer.Start(ctx, "WebhookRepository.GetSubscription")
+	defer span.End()
+
+	key := SubscriptionKey(id)
+	span.SetAttributes(attribute.String("consul.key", key))
+
+	pair, _, err := r.kv.Get(key, nil)
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, "consul get failed")
+		return nil, err
+	}
+	if pair == nil {
+		return nil, ErrSubscriptionNotFound
+	}
+
+	var sub model.WebhookSubscription
+	if err := json.Unmarshal(pair.Value, &sub); err != nil {
+		return nil, err
+	}
+	return &sub, nil
+}
+
+func (r *WebhookRepository) ListSubscriptions(ctx context.Context) ([]model.WebhookSubscription, error) {
+	_, span := webhookTracer.Start(ctx, "WebhookRepository.ListSubscriptions")
+	defer span.End()
+
+	pairs, _, err := r.kv.List(webhookSubscriptionPrefix, nil)
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, "consul list failed")
+		return nil, err
+	}
+
+	subs := make([]model.WebhookSubscription, 0, len(pairs))
+	for _, p := range pairs {
+		var sub model.WebhookSubscription
+		if err := json.Unmarshal(p.Value, &sub); err != nil {
+			return nil, err
+		}
+		subs = append(subs, sub)
+	}
+	return subs, nil
+}
+
+// DeleteSubscription removes the subscription and its delivery log. Queued
+// deliveries for it are dropped by the dispatcher on their next attempt.
+func (r *WebhookRepository) DeleteSubscription(ctx context.Context, id string) error {
+	_, span := webhookTracer.Start(ctx, "WebhookRepository.DeleteSubscription")
+	defer span.End()
+
+	key := SubscriptionKey(id)
+	span.SetAttributes(attribute.String("consul.key", key))
+
+	pair, _, err := r.kv.Get(key, nil)
+	if err != nil {
+		return err
+	}
+	if pair == nil {
+		return ErrSubscriptionNotFound
+	}
+
+	if _, err := r.kv.Delete(key, nil); err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, "consul delete failed")
+		return err
+	}
+	_, err = r.kv.DeleteTree(webhookDeliveryPrefix+id+"/", nil)
+	return err
+}
+
+// RewriteSubscriptions applies fn to every subscription and writes back the
+// ones it reports as changed, with CAS like ConfigRepository.Rewrite.
+func (r *WebhookRepository) RewriteSubscriptions(ctx context.Context, fn func(*model.WebhookSubscription) (bool, error)) (int, error) {
+	ctx, span := webhookTracer.Start(ctx, "WebhookRepository.RewriteSubscriptions")
+	defer span.End()
+
+	pairs, _, err := r.kv.List(webhookSubscriptionPrefix, (&api.QueryOptions{}).WithContext(ctx))
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, "consul list failed")
+		return 0, err
+	}
+
+	rewritten := 0
+	for _, pair := range pairs {
+		var sub model.WebhookSubscription
+		if err := json.Unmarshal(pair.Value, &sub); err != nil {
+			return rewritten, fmt.Errorf("%s: %w", pair.Key, err)
+		}
+
+		changed, err := fn(&sub)
+		if err != nil {
+			return rewritten, err
+		}
+		if !changed {
+			continue
+		}
+
+		data, err := json.Marshal(sub)
+		if err != nil {
+			return rewritten, err
+		}
+		ok, _, err := r.kv.CAS(&api.KVPair{Key: pair.Key, Value: data, ModifyIndex: pair.ModifyIndex}, (&api.WriteOptions{}).WithContext(ctx))
+		if err != nil {
+			span.RecordError(err)
+			span.SetStatus(codes.Error, "consul cas failed")
+			return rewritten, err
+		}
+		if !ok {
+			return rewritten, fmt.Errorf("%s changed during rewrite, run it again", pair.Key)
+		}
+		rewritten++
+	}
+	return rewritten, nil
+}
+
+// Enqueue writes a new pending delivery to the log and the retry queue in one
+// transaction.
+func (r *WebhookRepository) Enqueue(ctx context.Context, d model.WebhookDelivery) error {
+	_, span := webhookTracer.Start(ctx, "WebhookRepository.Enqueue")
+	defer span.End()
+
+	span.SetAttributes(
+		attribute.String("webhook.subscription_id", d.SubscriptionID),
+		attribute.String("webhook.delivery_id", d.ID),
+	)
+
+	data, err := json.Marshal(d)
+	if err != nil {
+		return err
+	}
+
+	ops := api.KVTxnOps{
+		{Verb: api.KVSet, Key: deliveryKey(d.SubscriptionID, d.ID), Value: data},
+		{Verb: api.KVSet, Key: queueKey(d.ID), Value: data},
+	}
+	return r.txn(ops)
+}
+
+// ListQueue returns every pending delivery, due or not.
+func (r *WebhookRepository) ListQueue(ctx context.Context) ([]QueuedDelivery, error) {
+	_, span := webhookTracer.Start(ctx, "WebhookRepository.ListQueue")
+	defer span.End()
+
+	pairs, _, err := r.kv.List(webhookQueuePrefix, nil)
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, "consul list failed")
+		return nil, err
+	}
+
+	out := make([]QueuedDelivery, 0, len(pairs))
+	for _, p := range pairs {
+		var d model.WebhookDelivery
+		if err := json.Unmarshal(p.Value, &d); err != nil {
+			return nil, err
+		}
+		out = append(out, QueuedDelivery{Delivery: d, ModifyIndex: p.ModifyIndex})
+	}
+	return out, nil
+}
+
+// Claim takes ownership of a queued delivery by rewriting it with CAS, so only
+// one replica attempts it. It returns false if another replica got there first.
+func (r *WebhookRepository) Claim(ctx context.Context, q QueuedDelivery) (bool, error) {
+	_, span := webhookTracer.Start(ctx, "WebhookRepository.Claim")
+	defer span.End()
+
+	span.SetAttributes(attribute.String("webhook.delivery_id", q.Delivery.ID))
+
+	data, err := json.Marshal(q.Delivery)
+	if err != nil {
+		return false, err
+	}
+
+	ok, _, err := r.kv.CAS(&api.KVPair{
+		Key:         queueKey(q.Delivery.ID),
+		Value:       data,
+		ModifyIndex: q.ModifyIndex,
+	}, nil)
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, "consul cas failed")
+	}
+	return ok, err
+}
+
+// Record stores the outcome of an attempt. Pending deliveries stay queued,
+// finished ones leave the queue and only remain in the log.
+func (r *WebhookRepository) Record(ctx context.Context, d model.WebhookDelivery) error {
+	_, span := webhookTracer.Start(ctx, "WebhookRepository.Record")
+	defer span.End()
+
+	span.SetAttributes(
+		attribute.String("webhook.delivery_id", d.ID),
+		attribute.String("webhook.status", string(d.Status)),
+	)
+
+	data, err := json.Marshal(d)
+	if err != nil {
+		return err
+	}
+
+	ops := api.KVTxnOps{
+		{Verb: api.KVSet, Key: deliveryKey(d.SubscriptionID, d.ID), Value: data},
+	}
+	if d.Status == model.DeliveryPending {
+		ops = append(ops, &api.KVTxnOp{Verb: api.KVSet, Key: queueKey(d.ID), Value: data})
+	} else {
+		ops = append(ops, &api.KVTxnOp{Verb: api.KVDelete, Key: queueKey(d.ID)})
+	}
+	return r.txn(ops)
+}
+
+// Drop removes a queued delivery without touching the log.
+func (r *WebhookRepository) Drop(ctx context.Context, id string) error {
+	_, err := r.kv.Delete(queueKey(id), nil)
+	return err
+}
+
+// ListDeliveries returns the delivery log of one subscription, or of all of
+// them when subscriptionID is empty.
+func (r *WebhookRepository) ListDeliveries(ctx context.Context, subscriptionID string) ([]model.WebhookDelivery, error) {
+	_, span := webhookTracer.Start(ctx, "WebhookRepository.ListDeliveries")
+	defer span.End()
+
+	prefix := webhookDeliveryPrefix
+	if subscriptionID != "" {
+		prefix += subscriptionID + "/"
+	}
+	pairs, _, err := r.kv.List(prefix, nil)
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, "consul list failed")
+		return nil, err
+	}
+
+	out := make([]model.WebhookDelivery, 0, len(pairs))
+	for _, p := range pairs {
+		var d model.WebhookDelivery
+		if err := json.Unmarshal(p.Value, &d); err != nil {
+			return nil, err
+		}
+		out = append(out, d)
+	}
+	return out, nil
+}
+
+// DeleteDeliveries removes deliveries from the log, a batch of keys per
+// transaction.
+func (r *WebhookRepository) DeleteDeliveries(ctx context.Context, ds []model.WebhookDelivery) error {
+	_, span := webhookTracer.Start(ctx, "WebhookRepository.DeleteDeliveries")
+	defer span.End()
+
+	span.SetAttributes(attribute.Int("webhook.deliveries", len(ds)))
+
+	for len(ds) > 0 {
+		batch := ds[:min(64, len(ds))]
+		ds = ds[len(batch):]
+
+		ops := make(api.KVTxnOps, len(batch))
+		for i, d := range batch {
+			ops[i] = &api.KVTxnOp{Verb: api.KVDelete, Key: deliveryKey(d.SubscriptionID, d.ID)}
+		}
+		if err := r.txn(ops); err != nil {
+			span.RecordError(err)
+			span.SetStatus(codes.Error, "consul txn failed")
+			return err
+		}
+	}
+	return nil
+}
+
+func (r *WebhookRepository) txn(ops api.KVTxnOps) error {
+	ok, resp, _, err := r.kv.Txn(ops, nil)
+	if err != nil {
+		return err
+	}
+	if !ok {
+		if resp != nil && len(resp.Errors) > 0 {
+			return fmt.Errorf("consul txn failed: %s", resp.Errors[0].What)
+		}
+		return errors.New("consul txn failed")
+	}
+	return nil
+}
@@ -0,0 +1,228 @@
+package secrets
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+)
+
+// Redacted replaces secret values in responses and logs.
+const Redacted = "[REDACTED]"
+
+// Encrypted values start with encryptedPrefix. The current format is
+// enc:v2:<key id>:<wrapped data key>:<ciphertext>, both parts base64 with
+// the GCM nonce prepended. The ciphertext is bound to where the value is
+// stored (see Encrypt), so it does not decrypt anywhere else.
+const (
+	encryptedPrefix = "enc:"
+	envelopeV2      = "enc:v2:"
+)
+
+var (
+	ErrNoKeyring  = errors.New("secret parameters require a configured keyring")
+	ErrUnknownKey = errors.New("value was encrypted with a key that is not in the keyring")
+	ErrMalformed  = errors.New("malformed encrypted value")
+	// ErrSealedInput rejects client input that is already an envelope:
+	// only the service seals values.
+	ErrSealedInput = errors.New("secret value must be plaintext, not an encrypted envelope")
+)
+
+// Keyring holds the key-encryption keys. New values are sealed under the
+// primary key; older keys stay in the file so existing values can still be
+// opened until they are rotated.
+type Keyring struct {
+	primary string
+	keys    map[string][]byte
+}
+
+// keyringFile is the on-disk format:
+//
+//	{"primary": "2026-10", "keys": {"2026-10": "<base64 32 bytes>", "2026-01": "..."}}
+type keyringFile struct {
+	Primary string            `json:"primary"`
+	Keys    map[string]string `json:"keys"`
+}
+
+// LoadKeyring reads a keyring file.
+func LoadKeyring(path string) (*Keyring, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	return ParseKeyring(data)
+}
+
+// ParseKeyring parses the JSON keyring format.
+func ParseKeyring(data []byte) (*Keyring, error) {
+	var f keyringFile
+	if err := json.Unmarshal(data, &f); err != nil {
+		return nil, fmt.Errorf("parse keyring: %w", err)
+	}
+
+	k := &Keyring{primary: f.Primary, keys: map[string][]byte{}}
+	for id, raw := range f.Keys {
+		if strings.Contains(id, ":") {
+			return nil, fmt.Errorf("key id %q must not contain ':'", id)
+		}
+		key, err := base64.StdEncoding.DecodeString(raw)
+		if err != nil {
+			return nil, fmt.Errorf("key %q: %w", id, err)
+		}
+		if len(key) != 32 {
+			return nil, fmt.Errorf("key %q must be 32 bytes (AES-256), got %d", id, len(key))
+		}
+		k.keys[id] = key
+	}
+	if _, ok := k.keys[k.primary]; !ok {
+		return nil, fmt.Errorf("primary key %q is not in the keyring", k.primary)
+	}
+	return k, nil
+}
+
+// Primary returns the ID of the key new values are sealed under.
+func (k *Keyring) Primary() string {
+	return k.primary
+}
+
+// IsEncrypted reports whether v is, or claims to be, a sealed value.
+func IsEncrypted(v string) bool {
+	return strings.HasPrefix(v, encryptedPrefix)
+}
+
+// Encrypt seals plaintext under a fresh data key, which is itself sealed
+// under the primary key. binding names where the value is stored; Decrypt
+// must be given the same binding.
+func (k *Keyring) Encrypt(plaintext, binding string) (string, error) {
+	if k == nil {
+		return "", ErrNoKeyring
+	}
+
+	dek := make([]byte, 32)
+	if _, err := rand.Read(dek); err != nil {
+		return "", err
+	}
+
+	ct, err := seal(dek, []byte(plaintext), []byte(binding))
+	if err != nil {
+		return "", err
+	}
+	return k.envelope(dek, ct)
+}
+
+// Decrypt opens a value sealed with the given binding.
+func (k *Keyring) Decrypt(value, binding string) (string, error) {
+	if k == nil {
+		return "", ErrNoKeyring
+	}
+
+	_, dek, ct, err := k.split(value)
+	if err != nil {
+		return "", err
+	}
+	pt, err := open(dek, ct, []byte(binding))
+	if err != nil {
+		return "", err
+	}
+	return string(pt), nil
+}
+
+// Rewrap re-seals a value's data key under the primary key without touching
+// the ciphertext, so the binding is kept. It reports false if the value
+// already is under the primary key.
+func (k *Keyring) Rewrap(value string) (string, bool, error) {
+	if k == nil {
+		return "", false, ErrNoKeyring
+	}
+
+	kid, dek, ct, err := k.split(value)
+	if err != nil {
+		return "", false, err
+	}
+	if kid == k.primary {
+		return value, false, nil
+	}
+
+	out, err := k.envelope(dek, ct)
+	return out, err == nil, err
+}
+
+func (k *Keyring) envelope(dek, ct []byte) (string, error) {
+	wrapped, err := seal(k.keys[k.primary], dek, nil)
+	if err != nil {
+		return "", err
+	}
+	return envelopeV2 + k.primary + ":" +
+		base64.StdEncoding.EncodeToString(wrapped) + ":" +
+		base64.StdEncoding.EncodeToString(ct), nil
+}
+
+// split parses a sealed value and unwraps its data key.
+func (k *Keyring) split(value string) (kid string, dek, ct []byte, err error) {
+	if !strings.HasPrefix(value, envelopeV2) {
+		return "", nil, nil, ErrMalformed
+	}
+	parts := strings.Split(strings.TrimPrefix(value, envelopeV2), ":")
+	if len(parts) != 3 {
+		return "", nil, nil, ErrMalformed
+	}
+
+	kek, ok := k.keys[parts[0]]
+	if !ok {
+		return "", nil, nil, ErrUnknownKey
+	}
+	wrapped, err := base64.StdEncoding.DecodeString(parts[1])
+	if err != nil {
+		return "", nil, nil, ErrMalformed
+	}
+	ct, err = base64.StdEncoding.DecodeString(parts[2])
+	if err != nil {
+		return "", nil, nil, ErrMalformed
+	}
+
+	dek, err = open(kek, wrapped, nil)
+	if err != nil {
+		return "", nil, nil, err
+	}
+	return parts[0], dek, ct, nil
+}
+
+func seal(key, plaintext, aad []byte) ([]byte, error) {
+	gcm, err := newGCM(key)
+	if err != nil {
+		return nil, err
+	}
+	nonce := make([]byte, gcm.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, err
+	}
+	return gcm.Seal(nonce, nonce, plaintext, aad), nil
+}
+
+func open(key, data, aad []byte) ([]byte, error) {
+	gcm, err := newGCM(key)
+	if err != nil {
+		return nil, err
+	}
+	if len(data) < gcm.NonceSize() {
+		return nil, ErrMalformed
+	}
+	pt, err := gcm.Open(nil, data[:gcm.NonceSize()], data[gcm.NonceSize():], aad)
+	if err != nil {
+		return nil, fmt.Errorf("%w: authentication failed", ErrMalformed)
+	}
+	return pt, nil
+}
+
+func newGCM(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
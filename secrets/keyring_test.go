@@ -0,0 +1,70 @@
+package secrets
+
+import (
+	"bytes"
+	"encoding/base64"
+	"errors"
+	"testing"
+)
+
+func testKeyring(t *testing.T, primary string) *Keyring {
+	t.Helper()
+	k1 := base64.StdEncoding.EncodeToString(bytes.Repeat([]byte{1}, 32))
+	k2 := base64.StdEncoding.EncodeToString(bytes.Repeat([]byte{2}, 32))
+	k, err := ParseKeyring([]byte(`{"primary":"` + primary + `","keys":{"k1":"` + k1 + `","k2":"` + k2 + `"}}`))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	return k
+}
+
+func TestEncryptDecrypt(t *testing.T) {
+	k := testKeyring(t, "k1")
+
+	sealed, err := k.Encrypt("hunter2", "db/password")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if !IsEncrypted(sealed) {
+		t.Fatalf("expected sealed value, got %s", sealed)
+	}
+
+	plain, err := k.Decrypt(sealed, "db/password")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if plain != "hunter2" {
+		t.Errorf("expected hunter2, got %s", plain)
+	}
+}
+
+func TestRewrap(t *testing.T) {
+	sealed, _ := testKeyring(t, "k1").Encrypt("hunter2", "db/password")
+
+	rotated := testKeyring(t, "k2")
+	rewrapped, changed, err := rotated.Rewrap(sealed)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if !changed {
+		t.Fatal("expected value to be rewrapped")
+	}
+
+	if _, changed, _ := rotated.Rewrap(rewrapped); changed {
+		t.Error("expected value under the primary key to be left alone")
+	}
+
+	plain, err := rotated.Decrypt(rewrapped, "db/password")
+	if err != nil || plain != "hunter2" {
+		t.Errorf("expected hunter2, got %q (%v)", plain, err)
+	}
+}
+
+func TestDecrypt_WrongBinding(t *testing.T) {
+	k := testKeyring(t, "k1")
+	sealed, _ := k.Encrypt("hunter2", "db/password")
+
+	if _, err := k.Decrypt(sealed, "cache/password"); !errors.Is(err, ErrMalformed) {
+		t.Errorf("expected a value copied elsewhere to fail, got %v", err)
+	}
+}
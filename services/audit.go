@@ -0,0 +1,62 @@
+package services
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"log/slog"
+	"time"
+
+	"github.com/anjaobradovic/ars-sit-2025/model"
+	"github.com/anjaobradovic/ars-sit-2025/repositories"
+	"github.com/google/uuid"
+
+	"go.opentelemetry.io/otel/trace"
+)
+
+type AuditService struct {
+	repo *repositories.AuditRepository
+}
+
+func NewAuditService(repo *repositories.AuditRepository) *AuditService {
+	return &AuditService{repo: repo}
+}
+
+// Record appends an entry, filling in ID, timestamp and trace ID. Failures
+// are logged rather than returned because the mutation already happened.
+// A nil service records nothing.
+func (s *AuditService) Record(ctx context.Context, entry model.AuditEntry) {
+	if s == nil {
+		return
+	}
+
+	entry.ID = uuid.NewString()
+	entry.Timestamp = time.Now().UTC()
+	if sc := trace.SpanContextFromContext(ctx); sc.HasTraceID() {
+		entry.TraceID = sc.TraceID().String()
+	}
+
+	if err := s.repo.Append(ctx, entry); err != nil {
+		slog.ErrorContext(ctx, "audit: cannot record entry", "action", entry.Action, "target", entry.Target, "actor", entry.Actor, "error", err)
+	}
+}
+
+// Query returns the entries matching filter and the cursor of the next page.
+func (s *AuditService) Query(ctx context.Context, filter model.AuditFilter) ([]model.AuditEntry, string, error) {
+	return s.repo.List(ctx, filter)
+}
+
+// AuditHash returns the hex SHA-256 of v's JSON encoding, or "" for nil so
+// absent resources have no hash.
+func AuditHash(v any) string {
+	if v == nil {
+		return ""
+	}
+	data, err := json.Marshal(v)
+	if err != nil || string(data) == "null" {
+		return ""
+	}
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
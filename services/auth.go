@@ -0,0 +1,156 @@
+package services
+
+import (
+	"context"
+	"crypto/subtle"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/anjaobradovic/ars-sit-2025/auth"
+	"github.com/anjaobradovic/ars-sit-2025/dtos"
+	"github.com/anjaobradovic/ars-sit-2025/model"
+	"github.com/anjaobradovic/ars-sit-2025/repositories"
+	"github.com/google/uuid"
+)
+
+var ErrUnauthenticated = errors.New("invalid or missing credentials")
+
+// bootstrapSubject is the principal of the bootstrap admin key.
+const bootstrapSubject = "bootstrap-admin"
+
+// AuthService turns credentials into principals and manages API keys.
+type AuthService struct {
+	apiKeys       *repositories.APIKeyRepository
+	jwt           *auth.JWTVerifier
+	bootstrapHash string
+}
+
+// NewAuthService builds the service. jwt may be nil to disable JWTs. A
+// non-empty bootstrapKey is accepted as an admin API key so the first real
+// keys can be created.
+func NewAuthService(apiKeys *repositories.APIKeyRepository, jwt *auth.JWTVerifier, bootstrapKey string) *AuthService {
+	s := &AuthService{apiKeys: apiKeys, jwt: jwt}
+	if bootstrapKey != "" {
+		s.bootstrapHash = auth.HashAPIKey(bootstrapKey)
+	}
+	return s
+}
+
+// Authenticate resolves a credential from the Authorization or X-API-Key
+// header. Bearer values carrying the API key prefix are treated as API keys,
+// anything else as a JWT.
+func (s *AuthService) Authenticate(ctx context.Context, credential string) (*auth.Principal, error) {
+	if strings.HasPrefix(credential, auth.APIKeyPrefix) || s.jwt == nil {
+		return s.authenticateAPIKey(ctx, credential)
+	}
+	return s.authenticateJWT(credential)
+}
+
+func (s *AuthService) authenticateAPIKey(ctx context.Context, key string) (*auth.Principal, error) {
+	hash := auth.HashAPIKey(key)
+
+	if s.bootstrapHash != "" && subtle.ConstantTimeCompare([]byte(hash), []byte(s.bootstrapHash)) == 1 {
+		return &auth.Principal{
+			Subject: auth.APIKeySubject(bootstrapSubject),
+			Name:    bootstrapSubject,
+			Method:  auth.MethodAPIKey,
+			Roles:   []string{auth.RoleAdmin},
+		}, nil
+	}
+
+	stored, err := s.apiKeys.GetByHash(ctx, hash)
+	if errors.Is(err, repositories.ErrAPIKeyNotFound) {
+		return nil, ErrUnauthenticated
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return &auth.Principal{
+		Subject: auth.APIKeySubject(stored.ID),
+		Name:    stored.Name,
+		Method:  auth.MethodAPIKey,
+		Roles:   stored.Roles,
+		KeyID:   stored.ID,
+	}, nil
+}
+
+func (s *AuthService) authenticateJWT(token string) (*auth.Principal, error) {
+	claims, kid, err := s.jwt.Verify(token)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrUnauthenticated, err)
+	}
+
+	roles := claims.Roles
+	if roles == nil {
+		roles = []string{}
+	}
+	return &auth.Principal{
+		Subject: auth.JWTSubject(claims.Subject),
+		Name:    claims.Subject,
+		Method:  auth.MethodJWT,
+		Roles:   roles,
+		KeyID:   kid,
+	}, nil
+}
+
+// CreateAPIKey issues a new key. The plaintext is only part of the result.
+// Names are unique, so a key can be recognised by name in listings and logs.
+func (s *AuthService) CreateAPIKey(ctx context.Context, dto dtos.CreateAPIKeyDto) (*model.CreatedAPIKey, error) {
+	if strings.TrimSpace(dto.Name) == "" {
+		return nil, errors.New("name is required")
+	}
+	if dto.Name == bootstrapSubject {
+		return nil, fmt.Errorf("%w: %q is reserved", repositories.ErrAPIKeyNameTaken, dto.Name)
+	}
+	if len(dto.Roles) == 0 {
+		return nil, errors.New("at least one role is required")
+	}
+	for _, r := range dto.Roles {
+		if !auth.IsKnownRole(r) {
+			return nil, fmt.Errorf("unknown role %q", r)
+		}
+	}
+
+	plain, err := auth.GenerateAPIKey()
+	if err != nil {
+		return nil, err
+	}
+
+	key := model.APIKey{
+		ID:        uuid.NewString(),
+		Name:      dto.Name,
+		Roles:     dto.Roles,
+		Prefix:    plain[:len(auth.APIKeyPrefix)+4],
+		Hash:      auth.HashAPIKey(plain),
+		CreatedAt: time.Now().UTC(),
+	}
+	if err := s.apiKeys.Save(ctx, key); err != nil {
+		return nil, err
+	}
+
+	key.Hash = ""
+	return &model.CreatedAPIKey{APIKey: key, Key: plain}, nil
+}
+
+func (s *AuthService) ListAPIKeys(ctx context.Context) ([]model.APIKey, error) {
+	keys, err := s.apiKeys.List(ctx)
+	if err != nil {
+		return nil, err
+	}
+	for i := range keys {
+		keys[i].Hash = ""
+	}
+	return keys, nil
+}
+
+func (s *AuthService) DeleteAPIKey(ctx context.Context, id string) (*model.APIKey, error) {
+	key, err := s.apiKeys.DeleteByID(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	key.Hash = ""
+	return key, nil
+}
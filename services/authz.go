@@ -0,0 +1,172 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/anjaobradovic/ars-sit-2025/auth"
+	"github.com/anjaobradovic/ars-sit-2025/dtos"
+	"github.com/anjaobradovic/ars-sit-2025/model"
+	"github.com/anjaobradovic/ars-sit-2025/repositories"
+	"github.com/google/uuid"
+)
+
+// policyCacheTTL bounds how long a binding change takes to apply. Bindings
+// are read on every request, so they are cached briefly.
+const policyCacheTTL = 5 * time.Second
+
+// credentialSource marks grants that come from the credential's own roles.
+const credentialSource = "credential"
+
+// AuthzService resolves the effective grants of a principal from its own
+// roles and the role bindings stored in the backend.
+type AuthzService struct {
+	repo *repositories.PolicyRepository
+
+	mu       sync.Mutex
+	cached   []model.RoleBinding
+	cachedAt time.Time
+}
+
+func NewAuthzService(repo *repositories.PolicyRepository) *AuthzService {
+	return &AuthzService{repo: repo}
+}
+
+func (s *AuthzService) bindings(ctx context.Context) ([]model.RoleBinding, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.cached != nil && time.Since(s.cachedAt) < policyCacheTTL {
+		return s.cached, nil
+	}
+
+	bindings, err := s.repo.List(ctx)
+	if err != nil {
+		return nil, err
+	}
+	s.cached = bindings
+	s.cachedAt = time.Now()
+	return bindings, nil
+}
+
+func (s *AuthzService) invalidate() {
+	s.mu.Lock()
+	s.cached = nil
+	s.mu.Unlock()
+}
+
+// Grants returns every grant in effect for p. Roles on the credential are
+// global; bindings for p's qualified subject or "*" add scoped grants.
+func (s *AuthzService) Grants(ctx context.Context, p *auth.Principal) (auth.Grants, error) {
+	grants, _, err := s.effective(ctx, p)
+	return grants, err
+}
+
+func (s *AuthzService) effective(ctx context.Context, p *auth.Principal) (auth.Grants, []string, error) {
+	var grants auth.Grants
+	var sources []string
+
+	for _, role := range p.Roles {
+		grants = append(grants, auth.Grant{Role: role})
+		sources = append(sources, credentialSource)
+	}
+
+	bindings, err := s.bindings(ctx)
+	if err != nil {
+		return nil, nil, err
+	}
+	for _, b := range bindings {
+		if b.Subject != "*" && b.Subject != p.Subject {
+			continue
+		}
+		grants = append(grants, auth.Grant{
+			Role:         b.Role,
+			ConfigPrefix: b.ConfigPrefix,
+			Group:        b.Group,
+			Labels:       b.Labels,
+		})
+		sources = append(sources, b.ID)
+	}
+	return grants, sources, nil
+}
+
+// WhoAmI describes p together with its effective grants.
+func (s *AuthzService) WhoAmI(ctx context.Context, p *auth.Principal) (*model.WhoAmI, error) {
+	grants, sources, err := s.effective(ctx, p)
+	if err != nil {
+		return nil, err
+	}
+
+	out := &model.WhoAmI{
+		Subject: p.Subject,
+		Name:    p.Name,
+		Method:  p.Method,
+		Roles:   p.Roles,
+		Grants:  make([]model.EffectiveGrant, 0, len(grants)),
+	}
+	for i, g := range grants {
+		perms := make([]string, 0, len(g.Permissions()))
+		for _, perm := range g.Permissions() {
+			perms = append(perms, string(perm))
+		}
+		out.Grants = append(out.Grants, model.EffectiveGrant{
+			Source:       sources[i],
+			Role:         g.Role,
+			Permissions:  perms,
+			ConfigPrefix: g.ConfigPrefix,
+			Group:        g.Group,
+			Labels:       g.Labels,
+		})
+	}
+	return out, nil
+}
+
+func (s *AuthzService) CreateBinding(ctx context.Context, dto dtos.CreateRoleBindingDto) (*model.RoleBinding, error) {
+	if strings.TrimSpace(dto.Subject) == "" {
+		return nil, errors.New("subject is required")
+	}
+	if dto.Subject != "*" && !auth.IsQualifiedSubject(dto.Subject) {
+		return nil, fmt.Errorf("subject %q must be \"*\", \"%s<key id>\" or \"%s<sub>\"", dto.Subject, auth.SubjectPrefixAPIKey, auth.SubjectPrefixJWT)
+	}
+	if !auth.IsKnownRole(dto.Role) {
+		return nil, fmt.Errorf("unknown role %q", dto.Role)
+	}
+	if dto.ConfigPrefix != "" && dto.Group != "" {
+		return nil, errors.New("a binding is scoped either to a config prefix or to a group, not both")
+	}
+	if len(dto.Labels) > 0 && dto.Group == "" {
+		return nil, errors.New("labels require a group scope, use \"*\" for every group")
+	}
+
+	b := model.RoleBinding{
+		ID:           uuid.NewString(),
+		Subject:      dto.Subject,
+		Role:         dto.Role,
+		ConfigPrefix: dto.ConfigPrefix,
+		Group:        dto.Group,
+		Labels:       dto.Labels,
+		CreatedAt:    time.Now().UTC(),
+	}
+	if err := s.repo.Save(ctx, b); err != nil {
+		return nil, err
+	}
+	s.invalidate()
+	return &b, nil
+}
+
+func (s *AuthzService) ListBindings(ctx context.Context) ([]model.RoleBinding, error) {
+	return s.repo.List(ctx)
+}
+
+func (s *AuthzService) DeleteBinding(ctx context.Context, id string) (*model.RoleBinding, error) {
+	b, err := s.repo.Delete(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	s.invalidate()
+	return b, nil
+}
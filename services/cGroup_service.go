@@ -1,29 +1,63 @@
 package services
 
 import (
+	"context"
 	"errors"
-	"log"
+	"log/slog"
 	"strings"
+	"time"
 
+	"github.com/anjaobradovic/ars-sit-2025/auth"
+	"github.com/anjaobradovic/ars-sit-2025/metrics"
 	"github.com/anjaobradovic/ars-sit-2025/model"
 	"github.com/anjaobradovic/ars-sit-2025/repositories"
+	"github.com/anjaobradovic/ars-sit-2025/secrets"
 	"github.com/google/uuid"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
 )
 
+var groupTracer = otel.Tracer("services/group")
+
+// startGroupSpan starts a span for a GroupService method on one group.
+func startGroupSpan(ctx context.Context, op, name, version string) (context.Context, trace.Span) {
+	ctx, span := groupTracer.Start(ctx, "GroupService."+op)
+	span.SetAttributes(
+		attribute.String("group.name", name),
+		attribute.String("group.version", version),
+	)
+	return ctx, span
+}
+
+// spanError marks the span as failed and returns err unchanged.
+func spanError(span trace.Span, err error, msg string) error {
+	span.RecordError(err)
+	span.SetStatus(codes.Error, msg)
+	return err
+}
+
 type GroupService struct {
-	repo *repositories.GroupRepository
+	repo     *repositories.GroupRepository
+	webhooks *WebhookService
+	keyring  *secrets.Keyring
 }
 
-func NewGroupService(repo *repositories.GroupRepository) *GroupService {
-	return &GroupService{repo: repo}
+func NewGroupService(repo *repositories.GroupRepository, webhooks *WebhookService, keyring *secrets.Keyring) *GroupService {
+	return &GroupService{repo: repo, webhooks: webhooks, keyring: keyring}
 }
 
-func (s *GroupService) Create(group *model.ConfigurationGroup) error {
+func (s *GroupService) Create(ctx context.Context, group *model.ConfigurationGroup) error {
+	ctx, span := startGroupSpan(ctx, "Create", group.Name, group.Version)
+	defer span.End()
+
 	if group.Name == "" {
-		return errors.New("name is required")
+		return spanError(span, errors.New("name is required"), "validation failed")
 	}
 	if group.Version == "" {
-		return errors.New("version is required")
+		return spanError(span, errors.New("version is required"), "validation failed")
 	}
 
 	if group.Id == "" {
@@ -34,31 +68,84 @@ func (s *GroupService) Create(group *model.ConfigurationGroup) error {
 		group.Configurations = []*model.LabeledConfiguration{}
 	}
 
-	return s.repo.Save(*group)
+	stored := copyGroup(group)
+	if err := sealGroup(s.keyring, stored); err != nil {
+		return spanError(span, err, "encrypting secrets failed")
+	}
+	if err := s.repo.Save(ctx, *stored); err != nil {
+		return spanError(span, err, "repo save failed")
+	}
+
+	// Like configs, the create response never carries plaintext secrets.
+	redactGroup(group)
+	return nil
+}
+
+func (s *GroupService) Get(ctx context.Context, name, version string) (*model.ConfigurationGroup, error) {
+	ctx, span := startGroupSpan(ctx, "Get", name, version)
+	defer span.End()
+
+	if name == "" || version == "" {
+		return nil, spanError(span, errors.New("name and version are required"), "validation failed")
+	}
+	group, err := s.repo.GetByNameAndVersion(ctx, name, version)
+	if err != nil {
+		return nil, spanError(span, err, "repo get failed")
+	}
+	if err := presentGroup(ctx, s.keyring, group); err != nil {
+		return nil, spanError(span, err, "decrypting secrets failed")
+	}
+	return group, nil
 }
 
-func (s *GroupService) Get(name, version string) (*model.ConfigurationGroup, error) {
+// Watch blocks until the group's ModifyIndex exceeds index or wait expires.
+func (s *GroupService) Watch(ctx context.Context, name, version string, index uint64, wait time.Duration) (*model.ConfigurationGroup, uint64, error) {
+	ctx, span := startGroupSpan(ctx, "Watch", name, version)
+	defer span.End()
+
+	span.SetAttributes(attribute.Int64("consul.wait_index", int64(index)))
+
 	if name == "" || version == "" {
-		return nil, errors.New("name and version are required")
+		return nil, 0, spanError(span, errors.New("name and version are required"), "validation failed")
+	}
+	group, lastIndex, err := s.repo.WaitByNameAndVersion(ctx, name, version, index, wait)
+	if err != nil {
+		return nil, lastIndex, spanError(span, err, "repo get failed")
 	}
-	return s.repo.GetByNameAndVersion(name, version)
+	if err := presentGroup(ctx, s.keyring, group); err != nil {
+		return nil, lastIndex, spanError(span, err, "decrypting secrets failed")
+	}
+	return group, lastIndex, nil
 }
 
-func (s *GroupService) Delete(name, version string) error {
+func (s *GroupService) Delete(ctx context.Context, name, version string) error {
+	ctx, span := startGroupSpan(ctx, "Delete", name, version)
+	defer span.End()
+
 	if name == "" || version == "" {
-		return errors.New("name and version are required")
+		return spanError(span, errors.New("name and version are required"), "validation failed")
+	}
+	if err := s.repo.DeleteByNameAndVersion(ctx, name, version); err != nil {
+		return spanError(span, err, "repo delete failed")
 	}
-	return s.repo.DeleteByNameAndVersion(name, version)
+	return nil
 }
 
-func (s *GroupService) AddConfig(name, version string, cfg model.LabeledConfiguration) error {
-	group, err := s.repo.GetByNameAndVersion(name, version)
+func (s *GroupService) AddConfig(ctx context.Context, name, version string, cfg model.LabeledConfiguration) error {
+	ctx, span := startGroupSpan(ctx, "AddConfig", name, version)
+	defer span.End()
+
+	group, err := s.repo.GetByNameAndVersion(ctx, name, version)
 	if err != nil {
-		return err
+		return spanError(span, err, "repo get failed")
 	}
 
 	if cfg.Configuration == nil {
-		return errors.New("configuration field is required")
+		return spanError(span, errors.New("configuration field is required"), "validation failed")
+	}
+
+	if err := authorizeMembership(ctx, name, &cfg); err != nil {
+		return spanError(span, err, "forbidden")
 	}
 
 	// Generiši ID-jeve ako nedostaju
@@ -73,32 +160,73 @@ func (s *GroupService) AddConfig(name, version string, cfg model.LabeledConfigur
 	for _, c := range group.Configurations {
 		if c.Configuration.Name == cfg.Configuration.Name &&
 			c.Configuration.Version == cfg.Configuration.Version {
-			return errors.New("configuration already exists in group")
+			return spanError(span, errors.New("configuration already exists in group"), "conflict")
 		}
 	}
 
-	group.Configurations = append(group.Configurations, &cfg)
+	stored := cfg
+	stored.Configuration = copyConfig(cfg.Configuration)
+	if err := sealConfig(s.keyring, groupScope(group), stored.Configuration); err != nil {
+		return spanError(span, err, "encrypting secrets failed")
+	}
+	group.Configurations = append(group.Configurations, &stored)
 
-	log.Printf("Service: added config %+v to group %s %s", cfg, name, version)
+	if err := s.repo.Update(ctx, *group); err != nil {
+		return spanError(span, err, "repo update failed")
+	}
+	slog.InfoContext(ctx, "group config added",
+		"group", name, "group_version", version,
+		"config", cfg.Configuration.Name, "config_version", cfg.Configuration.Version)
 
-	return s.repo.Update(*group)
+	s.webhooks.Publish(ctx, groupMembershipEvent(model.EventGroupConfigAdded, name, version, &cfg))
+	return nil
 }
 
-func (s *GroupService) RemoveConfig(name, version, configID string) error {
-	group, err := s.repo.GetByNameAndVersion(name, version)
+func (s *GroupService) RemoveConfig(ctx context.Context, name, version, configID string) error {
+	ctx, span := startGroupSpan(ctx, "RemoveConfig", name, version)
+	defer span.End()
+
+	group, err := s.repo.GetByNameAndVersion(ctx, name, version)
 	if err != nil {
-		return err
+		return spanError(span, err, "repo get failed")
 	}
 
 	filtered := []*model.LabeledConfiguration{}
+	removed := []*model.LabeledConfiguration{}
 	for _, c := range group.Configurations {
 		if c.Id != configID {
 			filtered = append(filtered, c)
+		} else {
+			if err := authorizeMembership(ctx, name, c); err != nil {
+				return spanError(span, err, "forbidden")
+			}
+			removed = append(removed, c)
 		}
 	}
 
 	group.Configurations = filtered
-	return s.repo.Update(*group)
+	if err := s.repo.Update(ctx, *group); err != nil {
+		return spanError(span, err, "repo update failed")
+	}
+
+	s.publishRemoved(ctx, name, version, removed)
+	return nil
+}
+
+func (s *GroupService) publishRemoved(ctx context.Context, name, version string, removed []*model.LabeledConfiguration) {
+	for _, c := range removed {
+		s.webhooks.Publish(ctx, groupMembershipEvent(model.EventGroupConfigRemoved, name, version, c))
+	}
+}
+
+// authorizeMembership checks that the caller may write the labeled
+// configuration inside the group, which is where label-scoped grants apply.
+func authorizeMembership(ctx context.Context, groupName string, cfg *model.LabeledConfiguration) error {
+	labels := cfg.Labels
+	if labels == nil {
+		labels = map[string]string{}
+	}
+	return auth.Authorize(ctx, auth.PermWrite, auth.Resource{Kind: auth.KindGroup, Name: groupName, Labels: labels})
 }
 
 // parseLabels parses "k1:v1;k2:v2" into a map.
@@ -145,38 +273,66 @@ func matchesAllLabels(cfg *model.LabeledConfiguration, query map[string]string)
 	return true
 }
 
+// labelDeleteOutcome is the outcome label of LabelDeletesTotal.
+func labelDeleteOutcome(deleted int, err error) string {
+	switch {
+	case errors.Is(err, auth.ErrForbidden):
+		return "forbidden"
+	case err != nil:
+		return "error"
+	case deleted == 0:
+		return "no_match"
+	default:
+		return "deleted"
+	}
+}
+
 // DeleteConfigsByLabels removes all labeled configurations from a group that match ALL labels.
-func (s *GroupService) DeleteConfigsByLabels(name, version, rawLabels string) (int, error) {
+// The caller must be allowed to write every matching configuration, otherwise nothing is deleted.
+func (s *GroupService) DeleteConfigsByLabels(ctx context.Context, name, version, rawLabels string) (deleted int, err error) {
+	ctx, span := startGroupSpan(ctx, "DeleteConfigsByLabels", name, version)
+	defer span.End()
+	defer func() {
+		metrics.LabelDeletesTotal.WithLabelValues(labelDeleteOutcome(deleted, err)).Inc()
+	}()
+
 	if name == "" || version == "" {
-		return 0, errors.New("name and version are required")
+		return 0, spanError(span, errors.New("name and version are required"), "validation failed")
 	}
 
 	queryLabels, err := parseLabels(rawLabels)
 	if err != nil {
-		return 0, err
+		return 0, spanError(span, err, "validation failed")
 	}
 
-	group, err := s.repo.GetByNameAndVersion(name, version)
+	group, err := s.repo.GetByNameAndVersion(ctx, name, version)
 	if err != nil {
-		return 0, err
+		return 0, spanError(span, err, "repo get failed")
 	}
 
 	kept := make([]*model.LabeledConfiguration, 0, len(group.Configurations))
-	deleted := 0
+	removed := []*model.LabeledConfiguration{}
 
 	for _, cfg := range group.Configurations {
 		if matchesAllLabels(cfg, queryLabels) {
-			deleted++
+			if err := authorizeMembership(ctx, name, cfg); err != nil {
+				return 0, spanError(span, err, "forbidden")
+			}
+			removed = append(removed, cfg)
 			continue
 		}
 		kept = append(kept, cfg)
 	}
 
 	group.Configurations = kept
-	if err := s.repo.Update(*group); err != nil {
-		return 0, err
+	if err := s.repo.Update(ctx, *group); err != nil {
+		return 0, spanError(span, err, "repo update failed")
 	}
 
-	log.Printf("Service: deleted %d configs by labels from group %s %s", deleted, name, version)
+	deleted = len(removed)
+	span.SetAttributes(attribute.Int("group.configs_deleted", deleted))
+	s.publishRemoved(ctx, name, version, removed)
+
+	slog.InfoContext(ctx, "group configs deleted by labels", "group", name, "group_version", version, "deleted", deleted)
 	return deleted, nil
 }
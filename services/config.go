@@ -3,9 +3,12 @@ package services
 import (
 	"context"
 	"errors"
+	"time"
 
+	"github.com/anjaobradovic/ars-sit-2025/metrics"
 	"github.com/anjaobradovic/ars-sit-2025/model"
 	"github.com/anjaobradovic/ars-sit-2025/repositories"
+	"github.com/anjaobradovic/ars-sit-2025/secrets"
 	"github.com/google/uuid"
 
 	"go.opentelemetry.io/otel"
@@ -16,16 +19,31 @@ import (
 var tracer = otel.Tracer("services/config")
 
 type ConfigService struct {
-	repo *repositories.ConfigRepository
+	repo     *repositories.ConfigRepository
+	webhooks *WebhookService
+	keyring  *secrets.Keyring
 }
 
-func NewConfigService(repo *repositories.ConfigRepository) *ConfigService {
-	return &ConfigService{repo: repo}
+// NewConfigService builds the service. keyring may be nil, in which case
+// configurations with secret parameters are rejected.
+func NewConfigService(repo *repositories.ConfigRepository, webhooks *WebhookService, keyring *secrets.Keyring) *ConfigService {
+	return &ConfigService{repo: repo, webhooks: webhooks, keyring: keyring}
 }
 
-func (s *ConfigService) Create(ctx context.Context, config *model.Config) error {
+// operationOutcome is the outcome label of the business operation counters.
+func operationOutcome(err error) string {
+	if err != nil {
+		return "error"
+	}
+	return "success"
+}
+
+func (s *ConfigService) Create(ctx context.Context, config *model.Config) (err error) {
 	ctx, span := tracer.Start(ctx, "ConfigService.Create")
 	defer span.End()
+	defer func() {
+		metrics.ConfigOperationsTotal.WithLabelValues("create", operationOutcome(err)).Inc()
+	}()
 
 	span.SetAttributes(
 		attribute.String("config.name", config.Name),
@@ -41,12 +59,24 @@ func (s *ConfigService) Create(ctx context.Context, config *model.Config) error
 
 	config.ID = uuid.NewString()
 
-	if err := s.repo.Save(ctx, *config); err != nil {
+	// Secrets are encrypted before they reach the repository. The response
+	// is always redacted: it may be stored verbatim as an idempotent replay.
+	stored := copyConfig(config)
+	if err := sealConfig(s.keyring, configScope, stored); err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, "sealing secrets failed")
+		return err
+	}
+
+	if err := s.repo.Save(ctx, *stored); err != nil {
 		span.RecordError(err)
 		span.SetStatus(codes.Error, "repo save failed")
 		return err
 	}
 
+	redactConfig(config)
+
+	s.webhooks.Publish(ctx, configEvent(model.EventConfigCreated, redactedCopy(config)))
 	return nil
 }
 
@@ -66,23 +96,66 @@ func (s *ConfigService) Get(ctx context.Context, name, version string) (*model.C
 		return nil, err
 	}
 
+	if err := presentConfig(ctx, s.keyring, configScope, cfg); err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, "decrypting secrets failed")
+		return nil, err
+	}
+
 	return cfg, nil
 }
 
-func (s *ConfigService) Delete(ctx context.Context, name, version string) error {
+// Watch returns a configuration once its Consul ModifyIndex exceeds index,
+// or the current state after wait expires (Consul blocking query semantics).
+func (s *ConfigService) Watch(ctx context.Context, name, version string, index uint64, wait time.Duration) (*model.Config, uint64, error) {
+	ctx, span := tracer.Start(ctx, "ConfigService.Watch")
+	defer span.End()
+
+	span.SetAttributes(
+		attribute.String("config.name", name),
+		attribute.String("config.version", version),
+		attribute.Int64("watch.index", int64(index)),
+		attribute.String("watch.wait", wait.String()),
+	)
+
+	cfg, lastIndex, err := s.repo.WaitByNameAndVersion(ctx, name, version, index, wait)
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, "repo watch failed")
+		return nil, lastIndex, err
+	}
+
+	if err := presentConfig(ctx, s.keyring, configScope, cfg); err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, "decrypting secrets failed")
+		return nil, lastIndex, err
+	}
+
+	return cfg, lastIndex, nil
+}
+
+func (s *ConfigService) Delete(ctx context.Context, name, version string) (err error) {
 	ctx, span := tracer.Start(ctx, "ConfigService.Delete")
 	defer span.End()
+	defer func() {
+		metrics.ConfigOperationsTotal.WithLabelValues("delete", operationOutcome(err)).Inc()
+	}()
 
 	span.SetAttributes(
 		attribute.String("config.name", name),
 		attribute.String("config.version", version),
 	)
 
-	if err := s.repo.DeleteByNameAndVersion(ctx, name, version); err != nil {
+	deleted, err := s.repo.DeleteByNameAndVersion(ctx, name, version)
+	if err != nil {
 		span.RecordError(err)
 		span.SetStatus(codes.Error, "repo delete failed")
 		return err
 	}
 
+	// Deleting a missing configuration succeeds, but nothing changed
+	if deleted {
+		s.webhooks.Publish(ctx, configEvent(model.EventConfigDeleted, &model.Config{Name: name, Version: version}))
+	}
 	return nil
 }
@@ -0,0 +1,113 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/anjaobradovic/ars-sit-2025/model"
+)
+
+// HealthCheck fails when a dependency needed to serve requests is unhealthy.
+type HealthCheck func(ctx context.Context) error
+
+type namedCheck struct {
+	name     string
+	check    HealthCheck
+	critical bool
+}
+
+// HealthService runs the readiness checks and tracks graceful shutdown.
+type HealthService struct {
+	checks       []namedCheck
+	timeout      time.Duration
+	shuttingDown atomic.Bool
+}
+
+// NewHealthService gives every check at most timeout to complete.
+func NewHealthService(timeout time.Duration) *HealthService {
+	return &HealthService{timeout: timeout}
+}
+
+// Register adds a readiness check. Call it before serving requests.
+func (s *HealthService) Register(name string, check HealthCheck) {
+	s.checks = append(s.checks, namedCheck{name: name, check: check, critical: true})
+}
+
+// RegisterNonCritical adds a check that is reported but never makes the
+// service not ready; a failure shows up as "warn".
+func (s *HealthService) RegisterNonCritical(name string, check HealthCheck) {
+	s.checks = append(s.checks, namedCheck{name: name, check: check})
+}
+
+// MaxLatency wraps check so that it also fails when it takes longer than max.
+func MaxLatency(check HealthCheck, max time.Duration) HealthCheck {
+	return func(ctx context.Context) error {
+		start := time.Now()
+		if err := check(ctx); err != nil {
+			return err
+		}
+		if elapsed := time.Since(start); elapsed > max {
+			return fmt.Errorf("took %s, limit is %s", elapsed.Round(time.Millisecond), max)
+		}
+		return nil
+	}
+}
+
+// SetShuttingDown makes the service report not ready from now on, so load
+// balancers stop sending traffic before the server shuts down.
+func (s *HealthService) SetShuttingDown() {
+	s.shuttingDown.Store(true)
+}
+
+// Ready runs all checks concurrently and reports each one. The service is
+// ready when every critical check passes and it is not shutting down.
+func (s *HealthService) Ready(ctx context.Context) model.ReadinessReport {
+	report := model.ReadinessReport{
+		Status: model.StatusReady,
+		Checks: make(map[string]model.HealthCheckResult, len(s.checks)),
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, s.timeout)
+	defer cancel()
+
+	var (
+		mu sync.Mutex
+		wg sync.WaitGroup
+	)
+	for _, c := range s.checks {
+		wg.Add(1)
+		go func(c namedCheck) {
+			defer wg.Done()
+
+			start := time.Now()
+			err := c.check(ctx)
+			result := model.HealthCheckResult{
+				Status:    model.CheckPass,
+				LatencyMs: float64(time.Since(start).Microseconds()) / 1000,
+			}
+			if err != nil {
+				result.Status = model.CheckWarn
+				if c.critical {
+					result.Status = model.CheckFail
+				}
+				result.Error = err.Error()
+			}
+
+			mu.Lock()
+			report.Checks[c.name] = result
+			if result.Status == model.CheckFail {
+				report.Status = model.StatusNotReady
+			}
+			mu.Unlock()
+		}(c)
+	}
+	wg.Wait()
+
+	if s.shuttingDown.Load() {
+		report.Status = model.StatusShuttingDown
+	}
+	return report
+}
@@ -0,0 +1,62 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/anjaobradovic/ars-sit-2025/model"
+)
+
+func TestHealthServiceReady(t *testing.T) {
+	s := NewHealthService(time.Second)
+	s.Register("ok", func(context.Context) error { return nil })
+
+	if got := s.Ready(context.Background()); got.Status != model.StatusReady || got.Checks["ok"].Status != model.CheckPass {
+		t.Fatalf("report = %+v, want ready", got)
+	}
+
+	s.Register("broken", func(context.Context) error { return errors.New("down") })
+	got := s.Ready(context.Background())
+	if got.Status != model.StatusNotReady {
+		t.Fatalf("status = %q, want %q", got.Status, model.StatusNotReady)
+	}
+	if c := got.Checks["broken"]; c.Status != model.CheckFail || c.Error != "down" {
+		t.Fatalf("broken check = %+v", c)
+	}
+
+	s.SetShuttingDown()
+	if got := s.Ready(context.Background()); got.Status != model.StatusShuttingDown {
+		t.Fatalf("status = %q, want %q", got.Status, model.StatusShuttingDown)
+	}
+}
+
+func TestHealthServiceReady_NonCriticalOnlyWarns(t *testing.T) {
+	s := NewHealthService(time.Second)
+	s.Register("consul", func(context.Context) error { return nil })
+	s.RegisterNonCritical("tracing", func(context.Context) error { return errors.New("export failed") })
+
+	got := s.Ready(context.Background())
+	if got.Status != model.StatusReady {
+		t.Fatalf("status = %q, want %q", got.Status, model.StatusReady)
+	}
+	if c := got.Checks["tracing"]; c.Status != model.CheckWarn || c.Error != "export failed" {
+		t.Fatalf("tracing check = %+v", c)
+	}
+}
+
+func TestMaxLatency(t *testing.T) {
+	slow := MaxLatency(func(context.Context) error {
+		time.Sleep(5 * time.Millisecond)
+		return nil
+	}, time.Millisecond)
+	if err := slow(context.Background()); err == nil {
+		t.Fatal("expected slow check to fail")
+	}
+
+	fast := MaxLatency(func(context.Context) error { return nil }, time.Second)
+	if err := fast(context.Background()); err != nil {
+		t.Fatalf("fast check failed: %v", err)
+	}
+}
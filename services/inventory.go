@@ -0,0 +1,80 @@
+package services
+
+import (
+	"context"
+	"log/slog"
+	"time"
+
+	"github.com/anjaobradovic/ars-sit-2025/metrics"
+	"github.com/anjaobradovic/ars-sit-2025/repositories"
+)
+
+// InventoryCollector periodically scans the store and hands metrics.Inventory
+// a snapshot of how many configurations, groups and idempotency records it
+// holds.
+type InventoryCollector struct {
+	configs     *repositories.ConfigRepository
+	groups      *repositories.GroupRepository
+	idempotency repositories.IdempotencyStore
+
+	// last keeps the counts of a part whose scan failed
+	last metrics.InventorySnapshot
+}
+
+func NewInventoryCollector(configs *repositories.ConfigRepository, groups *repositories.GroupRepository, idempotency repositories.IdempotencyStore) *InventoryCollector {
+	return &InventoryCollector{configs: configs, groups: groups, idempotency: idempotency}
+}
+
+// Run collects once immediately and then every interval until ctx is
+// cancelled.
+func (c *InventoryCollector) Run(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		c.Collect(ctx)
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// Collect scans the store and publishes a new snapshot. A failed scan keeps
+// the previous counts of that part.
+func (c *InventoryCollector) Collect(ctx context.Context) {
+	s := c.last
+
+	if versions, err := c.configs.CountVersions(ctx); err != nil {
+		slog.WarnContext(ctx, "inventory: cannot count configs", "error", err)
+	} else {
+		s.Configs, s.ConfigVersions, s.MaxConfigVersions = len(versions), 0, 0
+		for _, n := range versions {
+			s.ConfigVersions += n
+			s.MaxConfigVersions = max(s.MaxConfigVersions, n)
+		}
+	}
+
+	if groups, err := c.groups.List(ctx); err != nil {
+		slog.WarnContext(ctx, "inventory: cannot list groups", "error", err)
+	} else {
+		names := map[string]struct{}{}
+		s.GroupVersions, s.GroupConfigs, s.MaxGroupConfigs = len(groups), 0, 0
+		for _, g := range groups {
+			names[g.Name] = struct{}{}
+			s.GroupConfigs += len(g.Configurations)
+			s.MaxGroupConfigs = max(s.MaxGroupConfigs, len(g.Configurations))
+		}
+		s.Groups = len(names)
+	}
+
+	if n, err := c.idempotency.Count(ctx); err != nil {
+		slog.WarnContext(ctx, "inventory: cannot count idempotency records", "error", err)
+	} else {
+		s.IdempotencyRecords = n
+	}
+
+	c.last = s
+	metrics.Inventory.Set(s)
+}
@@ -0,0 +1,218 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/anjaobradovic/ars-sit-2025/auth"
+	"github.com/anjaobradovic/ars-sit-2025/model"
+	"github.com/anjaobradovic/ars-sit-2025/repositories"
+	"github.com/anjaobradovic/ars-sit-2025/secrets"
+)
+
+// copyConfig returns a config with its own parameter map, so sealing or
+// redacting it leaves the original alone.
+func copyConfig(cfg *model.Config) *model.Config {
+	out := *cfg
+	out.Parameters = make(map[string]string, len(cfg.Parameters))
+	for k, v := range cfg.Parameters {
+		out.Parameters[k] = v
+	}
+	return &out
+}
+
+// configScope is the scope of standalone configurations.
+const configScope = "config"
+
+// groupScope is the scope of the configurations stored in a group.
+func groupScope(group *model.ConfigurationGroup) string {
+	return "group\x00" + group.Name + "\x00" + group.Version
+}
+
+// secretBinding ties a sealed value to where it is stored: the scope, the
+// configuration and the parameter. Copied anywhere else it fails to decrypt.
+func secretBinding(scope string, cfg *model.Config, param string) string {
+	return strings.Join([]string{scope, cfg.Name, cfg.Version, param}, "\x00")
+}
+
+// sealConfig encrypts the parameters listed in cfg.Secrets in place. Input
+// that already looks sealed is rejected: only the service seals values.
+func sealConfig(k *secrets.Keyring, scope string, cfg *model.Config) error {
+	for _, name := range cfg.Secrets {
+		v, ok := cfg.Parameters[name]
+		if !ok {
+			return fmt.Errorf("secret %q is not a parameter", name)
+		}
+		if secrets.IsEncrypted(v) {
+			return fmt.Errorf("secret %q: %w", name, secrets.ErrSealedInput)
+		}
+		sealed, err := k.Encrypt(v, secretBinding(scope, cfg, name))
+		if err != nil {
+			return err
+		}
+		cfg.Parameters[name] = sealed
+	}
+	return nil
+}
+
+// redactConfig replaces every secret parameter with secrets.Redacted.
+func redactConfig(cfg *model.Config) {
+	for _, name := range cfg.Secrets {
+		if _, ok := cfg.Parameters[name]; ok {
+			cfg.Parameters[name] = secrets.Redacted
+		}
+	}
+}
+
+// redactedCopy is what leaves the service in events and logs: never a secret.
+func redactedCopy(cfg *model.Config) *model.Config {
+	out := copyConfig(cfg)
+	redactConfig(out)
+	return out
+}
+
+// presentConfig prepares a stored config for the caller in place: secrets are
+// decrypted if the caller may reveal them for this config, redacted otherwise.
+func presentConfig(ctx context.Context, k *secrets.Keyring, scope string, cfg *model.Config) error {
+	if len(cfg.Secrets) == 0 {
+		return nil
+	}
+	if auth.Authorize(ctx, auth.PermReveal, auth.Resource{Kind: auth.KindConfig, Name: cfg.Name}) != nil {
+		redactConfig(cfg)
+		return nil
+	}
+
+	for _, name := range cfg.Secrets {
+		v, ok := cfg.Parameters[name]
+		if !ok || !secrets.IsEncrypted(v) {
+			continue
+		}
+		plain, err := k.Decrypt(v, secretBinding(scope, cfg, name))
+		if err != nil {
+			return fmt.Errorf("decrypt secret %q: %w", name, err)
+		}
+		cfg.Parameters[name] = plain
+	}
+	return nil
+}
+
+// copyGroup returns a group whose labeled configurations can be sealed or
+// redacted without touching the original.
+func copyGroup(group *model.ConfigurationGroup) *model.ConfigurationGroup {
+	out := *group
+	out.Configurations = make([]*model.LabeledConfiguration, 0, len(group.Configurations))
+	for _, lc := range group.Configurations {
+		c := *lc
+		if lc.Configuration != nil {
+			c.Configuration = copyConfig(lc.Configuration)
+		}
+		out.Configurations = append(out.Configurations, &c)
+	}
+	return &out
+}
+
+// sealGroup encrypts the secrets of every configuration in the group.
+func sealGroup(k *secrets.Keyring, group *model.ConfigurationGroup) error {
+	for _, lc := range group.Configurations {
+		if lc.Configuration == nil {
+			continue
+		}
+		if err := sealConfig(k, groupScope(group), lc.Configuration); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// redactGroup applies redactConfig to every configuration in the group.
+func redactGroup(group *model.ConfigurationGroup) {
+	for _, lc := range group.Configurations {
+		if lc.Configuration != nil {
+			redactConfig(lc.Configuration)
+		}
+	}
+}
+
+// presentGroup applies presentConfig to every configuration in the group.
+func presentGroup(ctx context.Context, k *secrets.Keyring, group *model.ConfigurationGroup) error {
+	for _, lc := range group.Configurations {
+		if lc.Configuration == nil {
+			continue
+		}
+		if err := presentConfig(ctx, k, groupScope(group), lc.Configuration); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// rewrapConfig moves every sealed secret of cfg to the keyring's primary key.
+func rewrapConfig(k *secrets.Keyring, cfg *model.Config) (bool, error) {
+	changed := false
+	for _, name := range cfg.Secrets {
+		v, ok := cfg.Parameters[name]
+		if !ok || !secrets.IsEncrypted(v) {
+			continue
+		}
+		out, rewrapped, err := k.Rewrap(v)
+		if err != nil {
+			return false, fmt.Errorf("config %s/%s secret %q: %w", cfg.Name, cfg.Version, name, err)
+		}
+		if rewrapped {
+			cfg.Parameters[name] = out
+			changed = true
+		}
+	}
+	return changed, nil
+}
+
+// RotateSecrets re-encrypts every stored secret, in configurations, groups
+// and webhook subscriptions, under the keyring's primary key. Only data keys
+// are rewrapped; webhook secrets stored before the keyring was configured are
+// sealed. It returns how many records were rewritten.
+func RotateSecrets(ctx context.Context, configs *repositories.ConfigRepository, groups *repositories.GroupRepository, webhooks *repositories.WebhookRepository, k *secrets.Keyring) (int, error) {
+	if k == nil {
+		return 0, secrets.ErrNoKeyring
+	}
+
+	n, err := configs.Rewrite(ctx, func(cfg *model.Config) (bool, error) {
+		return rewrapConfig(k, cfg)
+	})
+	if err != nil {
+		return n, err
+	}
+
+	m, err := groups.Rewrite(ctx, func(group *model.ConfigurationGroup) (bool, error) {
+		changed := false
+		for _, lc := range group.Configurations {
+			if lc.Configuration == nil {
+				continue
+			}
+			c, err := rewrapConfig(k, lc.Configuration)
+			if err != nil {
+				return false, err
+			}
+			changed = changed || c
+		}
+		return changed, nil
+	})
+	if err != nil {
+		return n + m, err
+	}
+
+	w, err := webhooks.RewriteSubscriptions(ctx, func(sub *model.WebhookSubscription) (bool, error) {
+		if !secrets.IsEncrypted(sub.Secret) {
+			sealed, err := k.Encrypt(sub.Secret, webhookSecretBinding(sub.ID))
+			sub.Secret = sealed
+			return err == nil, err
+		}
+		out, rewrapped, err := k.Rewrap(sub.Secret)
+		if err != nil {
+			return false, fmt.Errorf("webhook %s secret: %w", sub.ID, err)
+		}
+		sub.Secret = out
+		return rewrapped, nil
+	})
+	return n + m + w, err
+}
@@ -2,13 +2,18 @@ package services
 
 import (
 	"context"
+	"errors"
 	"testing"
+	"time"
 
+	"github.com/anjaobradovic/ars-sit-2025/auth"
+	"github.com/anjaobradovic/ars-sit-2025/dtos"
 	"github.com/anjaobradovic/ars-sit-2025/model"
+	"github.com/anjaobradovic/ars-sit-2025/secrets"
 )
 
 func TestCreateConfig_MissingName(t *testing.T) {
-	service := NewConfigService(nil)
+	service := NewConfigService(nil, nil, nil)
 
 	cfg := &model.Config{
 		Version: "1.0",
@@ -22,7 +27,7 @@ func TestCreateConfig_MissingName(t *testing.T) {
 }
 
 func TestCreateConfig_MissingVersion(t *testing.T) {
-	service := NewConfigService(nil)
+	service := NewConfigService(nil, nil, nil)
 
 	cfg := &model.Config{
 		Name: "test",
@@ -34,3 +39,72 @@ func TestCreateConfig_MissingVersion(t *testing.T) {
 		t.Fatal("expected error, got nil")
 	}
 }
+
+func TestLabelDeleteOutcome(t *testing.T) {
+	cases := []struct {
+		deleted int
+		err     error
+		want    string
+	}{
+		{2, nil, "deleted"},
+		{0, nil, "no_match"},
+		{0, auth.ErrForbidden, "forbidden"},
+		{0, errors.New("consul down"), "error"},
+	}
+	for _, c := range cases {
+		if got := labelDeleteOutcome(c.deleted, c.err); got != c.want {
+			t.Errorf("labelDeleteOutcome(%d, %v) = %q, want %q", c.deleted, c.err, got, c.want)
+		}
+	}
+}
+
+func TestRedactGroup(t *testing.T) {
+	group := &model.ConfigurationGroup{Configurations: []*model.LabeledConfiguration{
+		{Configuration: &model.Config{
+			Parameters: map[string]string{"host": "db", "password": "hunter2"},
+			Secrets:    []string{"password"},
+		}},
+		{},
+	}}
+
+	redactGroup(group)
+
+	params := group.Configurations[0].Configuration.Parameters
+	if params["password"] != secrets.Redacted || params["host"] != "db" {
+		t.Fatalf("parameters after redactGroup = %v", params)
+	}
+}
+
+func TestSealConfig_RejectsEnvelopeInput(t *testing.T) {
+	cfg := &model.Config{
+		Name:       "db",
+		Version:    "v1",
+		Parameters: map[string]string{"password": "enc:v2:k1:AAAA:BBBB"},
+		Secrets:    []string{"password"},
+	}
+
+	if err := sealConfig(nil, configScope, cfg); !errors.Is(err, secrets.ErrSealedInput) {
+		t.Fatalf("expected ErrSealedInput, got %v", err)
+	}
+}
+
+func TestAuthzGrants_BindingsMatchQualifiedSubject(t *testing.T) {
+	s := NewAuthzService(nil)
+	s.cached = []model.RoleBinding{{ID: "b1", Subject: auth.JWTSubject("ci"), Role: auth.RoleEditor}}
+	s.cachedAt = time.Now()
+
+	// An API key named like the JWT subject must not pick up its bindings
+	key := &auth.Principal{Subject: auth.APIKeySubject("k1"), Name: "ci", Method: auth.MethodAPIKey}
+	if grants, _ := s.Grants(context.Background(), key); len(grants) != 0 {
+		t.Errorf("expected no grants for the API key, got %+v", grants)
+	}
+
+	jwt := &auth.Principal{Subject: auth.JWTSubject("ci"), Name: "ci", Method: auth.MethodJWT}
+	if grants, _ := s.Grants(context.Background(), jwt); len(grants) != 1 {
+		t.Errorf("expected the binding to apply to the JWT, got %+v", grants)
+	}
+
+	if _, err := s.CreateBinding(context.Background(), dtos.CreateRoleBindingDto{Subject: "ci", Role: auth.RoleReader}); err == nil {
+		t.Error("expected an unqualified subject to be rejected")
+	}
+}
@@ -0,0 +1,513 @@
+package services
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/anjaobradovic/ars-sit-2025/dtos"
+	"github.com/anjaobradovic/ars-sit-2025/model"
+	"github.com/anjaobradovic/ars-sit-2025/repositories"
+	"github.com/anjaobradovic/ars-sit-2025/secrets"
+	"github.com/google/uuid"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+)
+
+var webhookTracer = otel.Tracer("services/webhook")
+
+// Headers set on every webhook request. The signature is
+// hex(HMAC-SHA256(secret, timestamp + "." + body)).
+const (
+	WebhookSignatureHeader = "X-Webhook-Signature"
+	WebhookTimestampHeader = "X-Webhook-Timestamp"
+	WebhookEventHeader     = "X-Webhook-Event"
+	WebhookDeliveryHeader  = "X-Webhook-Delivery"
+)
+
+const (
+	webhookMaxAttempts  = 8
+	webhookBaseBackoff  = 2 * time.Second
+	webhookMaxBackoff   = 10 * time.Minute
+	webhookClaimLease   = 30 * time.Second
+	webhookPollInterval = time.Second
+)
+
+// Finished deliveries stay in the log for webhookDeliveryRetention, and at
+// most webhookDeliveriesKept of them per subscription. The dispatcher prunes
+// the log every webhookPruneInterval.
+const (
+	webhookDeliveryRetention = 7 * 24 * time.Hour
+	webhookDeliveriesKept    = 1000
+	webhookPruneInterval     = time.Hour
+)
+
+type WebhookService struct {
+	repo   *repositories.WebhookRepository
+	client *http.Client
+	// keyring seals subscription secrets at rest; without one they are
+	// stored as they are.
+	keyring *secrets.Keyring
+}
+
+func NewWebhookService(repo *repositories.WebhookRepository, keyring *secrets.Keyring) *WebhookService {
+	return &WebhookService{
+		repo:    repo,
+		client:  &http.Client{Timeout: 10 * time.Second},
+		keyring: keyring,
+	}
+}
+
+// webhookSecretBinding ties a sealed subscription secret to its subscription.
+func webhookSecretBinding(id string) string {
+	return "webhook\x00" + id
+}
+
+// openSecret returns the signing secret of a stored subscription.
+func (s *WebhookService) openSecret(sub model.WebhookSubscription) (string, error) {
+	if !secrets.IsEncrypted(sub.Secret) {
+		return sub.Secret, nil
+	}
+	return s.keyring.Decrypt(sub.Secret, webhookSecretBinding(sub.ID))
+}
+
+func (s *WebhookService) CreateSubscription(ctx context.Context, dto dtos.CreateWebhookDto) (*model.WebhookSubscription, error) {
+	u, err := url.Parse(dto.URL)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return nil, errors.New("url must be an absolute http(s) URL")
+	}
+
+	for _, t := range dto.EventTypes {
+		if !isKnownEventType(t) {
+			return nil, fmt.Errorf("unknown event type %q", t)
+		}
+		if len(dto.Labels) > 0 && !isGroupEventType(t) {
+			return nil, fmt.Errorf("label filters only apply to group events, not %q", t)
+		}
+	}
+
+	secret := dto.Secret
+	if secrets.IsEncrypted(secret) {
+		return nil, secrets.ErrSealedInput
+	}
+	if secret == "" {
+		buf := make([]byte, 32)
+		if _, err := rand.Read(buf); err != nil {
+			return nil, err
+		}
+		secret = hex.EncodeToString(buf)
+	}
+
+	sub := model.WebhookSubscription{
+		ID:         uuid.NewString(),
+		URL:        dto.URL,
+		Secret:     secret,
+		EventTypes: dto.EventTypes,
+		NamePrefix: dto.NamePrefix,
+		Labels:     dto.Labels,
+		CreatedAt:  time.Now().UTC(),
+	}
+	if sub.EventTypes == nil {
+		sub.EventTypes = []model.WebhookEventType{}
+	}
+
+	stored := sub
+	if s.keyring != nil {
+		sealed, err := s.keyring.Encrypt(secret, webhookSecretBinding(sub.ID))
+		if err != nil {
+			return nil, err
+		}
+		stored.Secret = sealed
+	}
+	if err := s.repo.SaveSubscription(ctx, stored); err != nil {
+		return nil, err
+	}
+	return &sub, nil
+}
+
+// ListSubscriptions returns all subscriptions with their secrets removed.
+func (s *WebhookService) ListSubscriptions(ctx context.Context) ([]model.WebhookSubscription, error) {
+	subs, err := s.repo.ListSubscriptions(ctx)
+	if err != nil {
+		return nil, err
+	}
+	for i := range subs {
+		subs[i].Secret = ""
+	}
+	return subs, nil
+}
+
+func (s *WebhookService) DeleteSubscription(ctx context.Context, id string) error {
+	return s.repo.DeleteSubscription(ctx, id)
+}
+
+// ListDeliveries returns the newest limit deliveries of a subscription,
+// newest first.
+func (s *WebhookService) ListDeliveries(ctx context.Context, subscriptionID string, limit int) ([]model.WebhookDelivery, error) {
+	if _, err := s.repo.GetSubscription(ctx, subscriptionID); err != nil {
+		return nil, err
+	}
+	ds, err := s.repo.ListDeliveries(ctx, subscriptionID)
+	if err != nil {
+		return nil, err
+	}
+	sortNewestFirst(ds)
+	if len(ds) > limit {
+		ds = ds[:limit]
+	}
+	return ds, nil
+}
+
+func sortNewestFirst(ds []model.WebhookDelivery) {
+	sort.Slice(ds, func(i, j int) bool {
+		if !ds[i].Event.OccurredAt.Equal(ds[j].Event.OccurredAt) {
+			return ds[i].Event.OccurredAt.After(ds[j].Event.OccurredAt)
+		}
+		return ds[i].ID > ds[j].ID
+	})
+}
+
+// Publish queues the event for every matching subscription. It never fails
+// the caller: the change already happened, so problems are only logged.
+// A nil service publishes nothing.
+func (s *WebhookService) Publish(ctx context.Context, event model.WebhookEvent) {
+	if s == nil {
+		return
+	}
+
+	ctx, span := webhookTracer.Start(ctx, "WebhookService.Publish")
+	defer span.End()
+
+	if event.ID == "" {
+		event.ID = uuid.NewString()
+	}
+	if event.OccurredAt.IsZero() {
+		event.OccurredAt = time.Now().UTC()
+	}
+	span.SetAttributes(
+		attribute.String("webhook.event_type", string(event.Type)),
+		attribute.String("webhook.event_id", event.ID),
+	)
+
+	subs, err := s.repo.ListSubscriptions(ctx)
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, "list subscriptions failed")
+		slog.ErrorContext(ctx, "webhooks: cannot list subscriptions", "event", event.Type, "error", err)
+		return
+	}
+
+	now := time.Now().UTC()
+	for _, sub := range subs {
+		if !subscriptionMatches(sub, event) {
+			continue
+		}
+		d := model.WebhookDelivery{
+			ID:             uuid.NewString(),
+			SubscriptionID: sub.ID,
+			Event:          event,
+			Status:         model.DeliveryPending,
+			NextAttemptAt:  now,
+			UpdatedAt:      now,
+		}
+		if err := s.repo.Enqueue(ctx, d); err != nil {
+			span.RecordError(err)
+			slog.ErrorContext(ctx, "webhooks: cannot enqueue delivery", "event", event.Type, "subscription", sub.ID, "error", err)
+		}
+	}
+}
+
+// Run delivers queued events and prunes the delivery log until ctx is
+// cancelled. Every replica can run it; deliveries are claimed with CAS so
+// each attempt happens once.
+func (s *WebhookService) Run(ctx context.Context) {
+	ticker := time.NewTicker(webhookPollInterval)
+	defer ticker.Stop()
+	prune := time.NewTicker(webhookPruneInterval)
+	defer prune.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			s.dispatchDue(ctx)
+		case <-prune.C:
+			s.pruneDeliveries(ctx, time.Now().UTC())
+		}
+	}
+}
+
+// pruneDeliveries drops finished deliveries past their retention. Pending
+// ones are never pruned; finished ones are never written again, so replicas
+// pruning at the same time do not conflict.
+func (s *WebhookService) pruneDeliveries(ctx context.Context, now time.Time) {
+	ds, err := s.repo.ListDeliveries(ctx, "")
+	if err != nil {
+		slog.WarnContext(ctx, "webhooks: cannot read delivery log", "error", err)
+		return
+	}
+
+	expired := expiredDeliveries(ds, now.Add(-webhookDeliveryRetention), webhookDeliveriesKept)
+	if len(expired) == 0 {
+		return
+	}
+	if err := s.repo.DeleteDeliveries(ctx, expired); err != nil {
+		slog.WarnContext(ctx, "webhooks: cannot prune delivery log", "error", err)
+		return
+	}
+	slog.DebugContext(ctx, "webhooks: pruned delivery log", "deleted", len(expired))
+}
+
+// expiredDeliveries returns the finished deliveries last updated before
+// cutoff, and those beyond the newest keep finished ones of their
+// subscription.
+func expiredDeliveries(ds []model.WebhookDelivery, cutoff time.Time, keep int) []model.WebhookDelivery {
+	sortNewestFirst(ds)
+
+	var expired []model.WebhookDelivery
+	kept := map[string]int{}
+	for _, d := range ds {
+		if d.Status == model.DeliveryPending {
+			continue
+		}
+		if d.UpdatedAt.Before(cutoff) || kept[d.SubscriptionID] >= keep {
+			expired = append(expired, d)
+			continue
+		}
+		kept[d.SubscriptionID]++
+	}
+	return expired
+}
+
+func (s *WebhookService) dispatchDue(ctx context.Context) {
+	queued, err := s.repo.ListQueue(ctx)
+	if err != nil {
+		slog.WarnContext(ctx, "webhooks: cannot read queue", "error", err)
+		return
+	}
+
+	now := time.Now().UTC()
+	for _, q := range queued {
+		if ctx.Err() != nil {
+			return
+		}
+		if q.Delivery.NextAttemptAt.After(now) {
+			continue
+		}
+
+		// Push the next attempt out by the claim lease so a replica that
+		// crashes mid-delivery does not leave the item stuck forever.
+		claimed := q
+		claimed.Delivery.NextAttemptAt = now.Add(webhookClaimLease)
+		ok, err := s.repo.Claim(ctx, claimed)
+		if err != nil || !ok {
+			continue
+		}
+
+		s.attempt(ctx, claimed.Delivery)
+	}
+}
+
+func (s *WebhookService) attempt(ctx context.Context, d model.WebhookDelivery) {
+	ctx, span := webhookTracer.Start(ctx, "WebhookService.attempt")
+	defer span.End()
+
+	span.SetAttributes(
+		attribute.String("webhook.delivery_id", d.ID),
+		attribute.String("webhook.subscription_id", d.SubscriptionID),
+		attribute.Int("webhook.attempt", d.Attempts+1),
+	)
+
+	sub, err := s.repo.GetSubscription(ctx, d.SubscriptionID)
+	if errors.Is(err, repositories.ErrSubscriptionNotFound) {
+		_ = s.repo.Drop(ctx, d.ID)
+		return
+	}
+	if err != nil {
+		slog.WarnContext(ctx, "webhooks: cannot load subscription", "subscription", d.SubscriptionID, "error", err)
+		return
+	}
+
+	secret, err := s.openSecret(*sub)
+	if err != nil {
+		slog.ErrorContext(ctx, "webhooks: cannot open subscription secret", "subscription", d.SubscriptionID, "error", err)
+		return
+	}
+	sub.Secret = secret
+
+	status, err := s.deliver(ctx, *sub, d.Event)
+
+	now := time.Now().UTC()
+	d.Attempts++
+	d.LastStatusCode = status
+	d.UpdatedAt = now
+
+	switch {
+	case err == nil:
+		d.Status = model.DeliverySucceeded
+		d.LastError = ""
+	case d.Attempts >= webhookMaxAttempts:
+		d.Status = model.DeliveryFailed
+		d.LastError = err.Error()
+	default:
+		d.Status = model.DeliveryPending
+		d.LastError = err.Error()
+		d.NextAttemptAt = now.Add(webhookBackoff(d.Attempts))
+	}
+
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, "delivery failed")
+	}
+
+	if err := s.repo.Record(ctx, d); err != nil {
+		slog.ErrorContext(ctx, "webhooks: cannot record delivery", "delivery", d.ID, "error", err)
+	}
+}
+
+// deliver POSTs one signed event and returns the receiver's status code.
+// Any non-2xx answer counts as a failure.
+func (s *WebhookService) deliver(ctx context.Context, sub model.WebhookSubscription, event model.WebhookEvent) (int, error) {
+	body, err := json.Marshal(event)
+	if err != nil {
+		return 0, err
+	}
+
+	ts := strconv.FormatInt(time.Now().Unix(), 10)
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, sub.URL, bytes.NewReader(body))
+	if err != nil {
+		return 0, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set(WebhookEventHeader, string(event.Type))
+	req.Header.Set(WebhookDeliveryHeader, event.ID)
+	req.Header.Set(WebhookTimestampHeader, ts)
+	req.Header.Set(WebhookSignatureHeader, "sha256="+SignWebhookPayload(sub.Secret, ts, body))
+
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+	_, _ = io.Copy(io.Discard, io.LimitReader(resp.Body, 64<<10))
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return resp.StatusCode, fmt.Errorf("receiver returned %d", resp.StatusCode)
+	}
+	return resp.StatusCode, nil
+}
+
+// SignWebhookPayload computes the hex signature receivers should compare
+// against X-Webhook-Signature (without the "sha256=" prefix).
+func SignWebhookPayload(secret, timestamp string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(timestamp))
+	mac.Write([]byte("."))
+	mac.Write(body)
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// webhookBackoff doubles the delay after every failed attempt, capped.
+func webhookBackoff(attempts int) time.Duration {
+	d := webhookBaseBackoff
+	for i := 1; i < attempts; i++ {
+		d *= 2
+		if d >= webhookMaxBackoff {
+			return webhookMaxBackoff
+		}
+	}
+	return d
+}
+
+func subscriptionMatches(sub model.WebhookSubscription, event model.WebhookEvent) bool {
+	if len(sub.EventTypes) > 0 {
+		found := false
+		for _, t := range sub.EventTypes {
+			if t == event.Type {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+
+	if sub.NamePrefix != "" && !strings.HasPrefix(event.Name, sub.NamePrefix) {
+		return false
+	}
+
+	for k, v := range sub.Labels {
+		if event.Labels == nil || event.Labels[k] != v {
+			return false
+		}
+	}
+	return true
+}
+
+// isGroupEventType reports events about group membership, the only ones that
+// carry labels.
+func isGroupEventType(t model.WebhookEventType) bool {
+	return t == model.EventGroupConfigAdded || t == model.EventGroupConfigRemoved
+}
+
+func isKnownEventType(t model.WebhookEventType) bool {
+	for _, known := range model.WebhookEventTypes {
+		if t == known {
+			return true
+		}
+	}
+	return false
+}
+
+// configEvent builds an event carrying the configuration as its payload.
+// Callers pass a redacted configuration.
+func configEvent(t model.WebhookEventType, cfg *model.Config) model.WebhookEvent {
+	data, _ := json.Marshal(cfg)
+	return model.WebhookEvent{
+		Type:    t,
+		Name:    cfg.Name,
+		Version: cfg.Version,
+		Data:    data,
+	}
+}
+
+// groupMembershipEvent builds an event for a labeled configuration entering
+// or leaving a group.
+func groupMembershipEvent(t model.WebhookEventType, groupName, groupVersion string, lc *model.LabeledConfiguration) model.WebhookEvent {
+	payload := *lc
+	if lc.Configuration != nil {
+		payload.Configuration = redactedCopy(lc.Configuration)
+	}
+	data, _ := json.Marshal(payload)
+	event := model.WebhookEvent{
+		Type:         t,
+		Group:        groupName,
+		GroupVersion: groupVersion,
+		Labels:       lc.Labels,
+		Data:         data,
+	}
+	if lc.Configuration != nil {
+		event.Name = lc.Configuration.Name
+		event.Version = lc.Configuration.Version
+	}
+	return event
+}
@@ -0,0 +1,161 @@
+package services
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/anjaobradovic/ars-sit-2025/dtos"
+	"github.com/anjaobradovic/ars-sit-2025/model"
+	"github.com/anjaobradovic/ars-sit-2025/secrets"
+)
+
+func TestWebhookDeliver_SignsPayload(t *testing.T) {
+	var gotSignature, gotTimestamp string
+	var gotBody []byte
+
+	receiver := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		gotSignature = r.Header.Get(WebhookSignatureHeader)
+		gotTimestamp = r.Header.Get(WebhookTimestampHeader)
+		gotBody, _ = io.ReadAll(r.Body)
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer receiver.Close()
+
+	service := NewWebhookService(nil, nil)
+	sub := model.WebhookSubscription{ID: "sub-1", URL: receiver.URL, Secret: "s3cr3t"}
+	event := configEvent(model.EventConfigCreated, &model.Config{Name: "db", Version: "v1"})
+
+	status, err := service.deliver(context.Background(), sub, event)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if status != http.StatusNoContent {
+		t.Errorf("expected status 204, got %d", status)
+	}
+
+	expected := "sha256=" + SignWebhookPayload("s3cr3t", gotTimestamp, gotBody)
+	if gotSignature != expected {
+		t.Errorf("expected signature %s, got %s", expected, gotSignature)
+	}
+}
+
+func TestWebhookDeliver_ReceiverError(t *testing.T) {
+	receiver := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer receiver.Close()
+
+	service := NewWebhookService(nil, nil)
+	sub := model.WebhookSubscription{ID: "sub-1", URL: receiver.URL, Secret: "s3cr3t"}
+
+	status, err := service.deliver(context.Background(), sub, model.WebhookEvent{Type: model.EventConfigDeleted})
+	if err == nil {
+		t.Fatal("expected error, got nil")
+	}
+	if status != http.StatusServiceUnavailable {
+		t.Errorf("expected status 503, got %d", status)
+	}
+}
+
+func TestWebhookBackoff(t *testing.T) {
+	if d := webhookBackoff(1); d != webhookBaseBackoff {
+		t.Errorf("expected %s, got %s", webhookBaseBackoff, d)
+	}
+	if d := webhookBackoff(3); d != 4*webhookBaseBackoff {
+		t.Errorf("expected %s, got %s", 4*webhookBaseBackoff, d)
+	}
+	if d := webhookBackoff(100); d != webhookMaxBackoff {
+		t.Errorf("expected %s, got %s", webhookMaxBackoff, d)
+	}
+}
+
+func TestSubscriptionMatches(t *testing.T) {
+	sub := model.WebhookSubscription{
+		EventTypes: []model.WebhookEventType{model.EventGroupConfigAdded},
+		NamePrefix: "db-",
+		Labels:     map[string]string{"env": "prod"},
+	}
+
+	event := model.WebhookEvent{
+		Type:       model.EventGroupConfigAdded,
+		Name:       "db-main",
+		Labels:     map[string]string{"env": "prod", "region": "eu"},
+		OccurredAt: time.Now(),
+	}
+	if !subscriptionMatches(sub, event) {
+		t.Error("expected event to match")
+	}
+
+	event.Labels["env"] = "staging"
+	if subscriptionMatches(sub, event) {
+		t.Error("expected label mismatch to be filtered out")
+	}
+}
+
+func TestCreateSubscription_RejectsLabelsOnConfigEvents(t *testing.T) {
+	service := NewWebhookService(nil, nil)
+
+	_, err := service.CreateSubscription(context.Background(), dtos.CreateWebhookDto{
+		URL:        "https://hooks.example.com/events",
+		EventTypes: []model.WebhookEventType{model.EventConfigDeleted},
+		Labels:     map[string]string{"env": "prod"},
+	})
+	if err == nil {
+		t.Fatal("expected label filter on config events to be rejected")
+	}
+}
+
+func TestWebhookOpenSecret(t *testing.T) {
+	key := base64.StdEncoding.EncodeToString(bytes.Repeat([]byte{1}, 32))
+	keyring, err := secrets.ParseKeyring([]byte(`{"primary":"k1","keys":{"k1":"` + key + `"}}`))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	service := NewWebhookService(nil, keyring)
+
+	sealed, _ := keyring.Encrypt("s3cr3t", webhookSecretBinding("sub-1"))
+	if got, err := service.openSecret(model.WebhookSubscription{ID: "sub-1", Secret: sealed}); err != nil || got != "s3cr3t" {
+		t.Errorf("expected s3cr3t, got %q (%v)", got, err)
+	}
+	if _, err := service.openSecret(model.WebhookSubscription{ID: "sub-2", Secret: sealed}); err == nil {
+		t.Error("expected a secret copied to another subscription to fail")
+	}
+}
+
+func TestExpiredDeliveries(t *testing.T) {
+	now := time.Now()
+	delivery := func(id, sub string, status model.WebhookDeliveryStatus, age time.Duration) model.WebhookDelivery {
+		at := now.Add(-age)
+		return model.WebhookDelivery{
+			ID:             id,
+			SubscriptionID: sub,
+			Status:         status,
+			Event:          model.WebhookEvent{OccurredAt: at},
+			UpdatedAt:      at,
+		}
+	}
+	ds := []model.WebhookDelivery{
+		delivery("old-pending", "a", model.DeliveryPending, 30*24*time.Hour),
+		delivery("old", "a", model.DeliverySucceeded, 8*24*time.Hour),
+		delivery("a1", "a", model.DeliverySucceeded, 3*time.Hour),
+		delivery("a2", "a", model.DeliveryFailed, 2*time.Hour),
+		delivery("a3", "a", model.DeliverySucceeded, time.Hour),
+		delivery("b1", "b", model.DeliverySucceeded, 3*time.Hour),
+	}
+
+	expired := expiredDeliveries(ds, now.Add(-7*24*time.Hour), 2)
+
+	got := map[string]bool{}
+	for _, d := range expired {
+		got[d.ID] = true
+	}
+	if len(got) != 2 || !got["old"] || !got["a1"] {
+		t.Errorf("expected old and a1 to expire, got %v", got)
+	}
+}
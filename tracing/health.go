@@ -0,0 +1,39 @@
+package tracing
+
+import (
+	"context"
+	"sync"
+
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+)
+
+// exporterHealth remembers the outcome of the most recent export.
+var exporterHealth struct {
+	mu      sync.Mutex
+	lastErr error
+}
+
+// ExporterHealth returns the error of the last span export, or nil when it
+// succeeded, nothing was exported yet or tracing is disabled.
+func ExporterHealth() error {
+	exporterHealth.mu.Lock()
+	defer exporterHealth.mu.Unlock()
+	return exporterHealth.lastErr
+}
+
+func recordExport(err error) {
+	exporterHealth.mu.Lock()
+	exporterHealth.lastErr = err
+	exporterHealth.mu.Unlock()
+}
+
+// observedExporter records the outcome of every export for ExporterHealth.
+type observedExporter struct {
+	sdktrace.SpanExporter
+}
+
+func (e observedExporter) ExportSpans(ctx context.Context, spans []sdktrace.ReadOnlySpan) error {
+	err := e.SpanExporter.ExportSpans(ctx, spans)
+	recordExport(err)
+	return err
+}
@@ -0,0 +1,34 @@
+package tracing
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+)
+
+type failingExporter struct {
+	tracetest.NoopExporter
+	err error
+}
+
+func (e *failingExporter) ExportSpans(context.Context, []sdktrace.ReadOnlySpan) error {
+	return e.err
+}
+
+func TestExporterHealth(t *testing.T) {
+	t.Cleanup(func() { recordExport(nil) })
+
+	down := errors.New("collector down")
+	_ = observedExporter{&failingExporter{err: down}}.ExportSpans(context.Background(), nil)
+	if !errors.Is(ExporterHealth(), down) {
+		t.Fatalf("ExporterHealth() = %v, want %v", ExporterHealth(), down)
+	}
+
+	_ = observedExporter{&failingExporter{}}.ExportSpans(context.Background(), nil)
+	if err := ExporterHealth(); err != nil {
+		t.Fatalf("ExporterHealth() after success = %v", err)
+	}
+}
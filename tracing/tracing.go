@@ -2,55 +2,254 @@ package tracing
 
 import (
 	"context"
-	"log"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
+	"fmt"
+	"log/slog"
 	"os"
+	"strconv"
 	"time"
 
 	"go.opentelemetry.io/otel"
 	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracegrpc"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	"go.opentelemetry.io/otel/exporters/stdout/stdouttrace"
 	"go.opentelemetry.io/otel/propagation"
 	"go.opentelemetry.io/otel/sdk/resource"
 	sdktrace "go.opentelemetry.io/otel/sdk/trace"
 	semconv "go.opentelemetry.io/otel/semconv/v1.26.0"
+	"google.golang.org/grpc/credentials"
 )
 
-func InitTracer(ctx context.Context) (func(context.Context) error, error) {
-	endpoint := os.Getenv("OTEL_EXPORTER_OTLP_ENDPOINT")
-	if endpoint == "" {
-		endpoint = "localhost:4317"
+// Exporter types.
+const (
+	ExporterOTLPGRPC = "otlp-grpc"
+	ExporterOTLPHTTP = "otlp-http"
+	ExporterStdout   = "stdout"
+	ExporterNone     = "none"
+)
+
+// Config describes the tracing pipeline.
+type Config struct {
+	Exporter string `json:"exporter"`
+	Endpoint string `json:"endpoint"`
+
+	// Insecure disables TLS towards the collector. CACertFile, if set,
+	// replaces the system roots used to verify it.
+	Insecure   bool   `json:"insecure"`
+	CACertFile string `json:"caCertFile,omitempty"`
+
+	// SampleRatio is the share of new traces that are recorded; child spans
+	// follow the decision of their parent.
+	SampleRatio float64 `json:"sampleRatio"`
+
+	BatchTimeout       time.Duration `json:"batchTimeout"`
+	MaxExportBatchSize int           `json:"maxExportBatchSize"`
+	MaxQueueSize       int           `json:"maxQueueSize"`
+
+	ServiceVersion string `json:"serviceVersion,omitempty"`
+	Environment    string `json:"environment,omitempty"`
+	Instance       string `json:"instance,omitempty"`
+}
+
+// DefaultConfig exports every trace over insecure OTLP gRPC to a local
+// collector, in batches.
+func DefaultConfig() Config {
+	instance, _ := os.Hostname()
+	return Config{
+		Exporter:           ExporterOTLPGRPC,
+		Endpoint:           "localhost:4317",
+		Insecure:           true,
+		SampleRatio:        1,
+		BatchTimeout:       5 * time.Second,
+		MaxExportBatchSize: 512,
+		MaxQueueSize:       2048,
+		Instance:           instance,
 	}
+}
 
-	log.Printf("OTEL exporter endpoint: %s", endpoint)
+// LoadConfig starts from DefaultConfig, applies the JSON file at path if
+// one is given and then the environment:
+//
+//	TRACING_EXPORTER             otlp-grpc, otlp-http, stdout or none
+//	OTEL_EXPORTER_OTLP_ENDPOINT  collector address
+//	OTEL_EXPORTER_OTLP_INSECURE  "false" to use TLS
+//	OTEL_EXPORTER_OTLP_CERTIFICATE  CA certificate file
+//	OTEL_TRACES_SAMPLER_ARG      sample ratio between 0 and 1
+//	TRACING_BATCH_TIMEOUT        e.g. "5s"
+//	SERVICE_VERSION, DEPLOYMENT_ENVIRONMENT, SERVICE_INSTANCE
+func LoadConfig(path string) (Config, error) {
+	cfg := DefaultConfig()
 
-	// mali timeout da init ne visi ako endpoint nije dostupan
-	dialCtx, cancel := context.WithTimeout(ctx, 5*time.Second)
-	defer cancel()
+	if path != "" {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return cfg, err
+		}
+		if err := json.Unmarshal(data, &cfg); err != nil {
+			return cfg, fmt.Errorf("tracing config: %w", err)
+		}
+	}
 
-	exp, err := otlptracegrpc.New(dialCtx,
-		otlptracegrpc.WithEndpoint(endpoint),
-		otlptracegrpc.WithInsecure(),
-	)
+	if v := os.Getenv("TRACING_EXPORTER"); v != "" {
+		cfg.Exporter = v
+	}
+	if v := os.Getenv("OTEL_EXPORTER_OTLP_ENDPOINT"); v != "" {
+		cfg.Endpoint = v
+	}
+	if v := os.Getenv("OTEL_EXPORTER_OTLP_INSECURE"); v != "" {
+		cfg.Insecure = v == "true"
+	}
+	if v := os.Getenv("OTEL_EXPORTER_OTLP_CERTIFICATE"); v != "" {
+		cfg.CACertFile = v
+	}
+	if v := os.Getenv("OTEL_TRACES_SAMPLER_ARG"); v != "" {
+		ratio, err := strconv.ParseFloat(v, 64)
+		if err != nil {
+			return cfg, fmt.Errorf("OTEL_TRACES_SAMPLER_ARG: %w", err)
+		}
+		cfg.SampleRatio = ratio
+	}
+	if v := os.Getenv("TRACING_BATCH_TIMEOUT"); v != "" {
+		d, err := time.ParseDuration(v)
+		if err != nil {
+			return cfg, fmt.Errorf("TRACING_BATCH_TIMEOUT: %w", err)
+		}
+		cfg.BatchTimeout = d
+	}
+	if v := os.Getenv("SERVICE_VERSION"); v != "" {
+		cfg.ServiceVersion = v
+	}
+	if v := os.Getenv("DEPLOYMENT_ENVIRONMENT"); v != "" {
+		cfg.Environment = v
+	}
+	if v := os.Getenv("SERVICE_INSTANCE"); v != "" {
+		cfg.Instance = v
+	}
+
+	return cfg, cfg.Validate()
+}
+
+// Validate rejects unknown exporters and ratios outside [0, 1].
+func (c Config) Validate() error {
+	switch c.Exporter {
+	case ExporterOTLPGRPC, ExporterOTLPHTTP, ExporterStdout, ExporterNone:
+	default:
+		return fmt.Errorf("tracing config: unknown exporter %q", c.Exporter)
+	}
+	if c.SampleRatio < 0 || c.SampleRatio > 1 {
+		return fmt.Errorf("tracing config: sample ratio %v is not between 0 and 1", c.SampleRatio)
+	}
+	return nil
+}
+
+func noopShutdown(context.Context) error { return nil }
+
+// InitTracer installs the global tracer provider described by cfg. It never
+// fails startup: on error it logs, leaves the no-op provider in place and
+// returns a no-op shutdown, so the service runs without tracing.
+func InitTracer(ctx context.Context, cfg Config) func(context.Context) error {
+	otel.SetTextMapPropagator(propagation.NewCompositeTextMapPropagator(
+		propagation.TraceContext{},
+		propagation.Baggage{},
+	))
+
+	if cfg.Exporter == ExporterNone {
+		slog.Info("tracing disabled")
+		return noopShutdown
+	}
+
+	exp, err := newExporter(ctx, cfg)
 	if err != nil {
-		return nil, err
+		slog.Error("tracing disabled: cannot create exporter", "exporter", cfg.Exporter, "error", err)
+		return noopShutdown
 	}
 
-	res, err := resource.New(ctx,
-		resource.WithAttributes(
-			semconv.ServiceNameKey.String("config-service"),
-		),
-	)
+	attrs := []resource.Option{
+		resource.WithFromEnv(),
+		resource.WithAttributes(semconv.ServiceNameKey.String("config-service")),
+	}
+	if cfg.ServiceVersion != "" {
+		attrs = append(attrs, resource.WithAttributes(semconv.ServiceVersionKey.String(cfg.ServiceVersion)))
+	}
+	if cfg.Environment != "" {
+		attrs = append(attrs, resource.WithAttributes(semconv.DeploymentEnvironmentKey.String(cfg.Environment)))
+	}
+	if cfg.Instance != "" {
+		attrs = append(attrs, resource.WithAttributes(semconv.ServiceInstanceIDKey.String(cfg.Instance)))
+	}
+	res, err := resource.New(ctx, attrs...)
 	if err != nil {
-		return nil, err
+		// Partial resources are still usable
+		slog.Warn("tracing: incomplete resource attributes", "error", err)
 	}
 
 	tp := sdktrace.NewTracerProvider(
 		sdktrace.WithResource(res),
-		sdktrace.WithSyncer(exp), // super za debug (šalje odmah)
-		sdktrace.WithSampler(sdktrace.AlwaysSample()),
+		sdktrace.WithBatcher(observedExporter{exp},
+			sdktrace.WithBatchTimeout(cfg.BatchTimeout),
+			sdktrace.WithMaxExportBatchSize(cfg.MaxExportBatchSize),
+			sdktrace.WithMaxQueueSize(cfg.MaxQueueSize),
+		),
+		sdktrace.WithSampler(sdktrace.ParentBased(sdktrace.TraceIDRatioBased(cfg.SampleRatio))),
 	)
-
 	otel.SetTracerProvider(tp)
-	otel.SetTextMapPropagator(propagation.TraceContext{})
 
-	return tp.Shutdown, nil
+	slog.Info("tracing enabled", "exporter", cfg.Exporter, "endpoint", cfg.Endpoint, "sample_ratio", cfg.SampleRatio)
+	return tp.Shutdown
+}
+
+// newExporter creates the exporter. OTLP exporters connect lazily, so a
+// collector that is not up yet only costs dropped spans, not startup.
+func newExporter(ctx context.Context, cfg Config) (sdktrace.SpanExporter, error) {
+	switch cfg.Exporter {
+	case ExporterStdout:
+		return stdouttrace.New(stdouttrace.WithPrettyPrint())
+
+	case ExporterOTLPHTTP:
+		opts := []otlptracehttp.Option{otlptracehttp.WithEndpoint(cfg.Endpoint)}
+		if cfg.Insecure {
+			opts = append(opts, otlptracehttp.WithInsecure())
+		} else {
+			tlsCfg, err := tlsConfig(cfg.CACertFile)
+			if err != nil {
+				return nil, err
+			}
+			opts = append(opts, otlptracehttp.WithTLSClientConfig(tlsCfg))
+		}
+		return otlptracehttp.New(ctx, opts...)
+
+	default:
+		opts := []otlptracegrpc.Option{otlptracegrpc.WithEndpoint(cfg.Endpoint)}
+		if cfg.Insecure {
+			opts = append(opts, otlptracegrpc.WithInsecure())
+		} else {
+			tlsCfg, err := tlsConfig(cfg.CACertFile)
+			if err != nil {
+				return nil, err
+			}
+			opts = append(opts, otlptracegrpc.WithTLSCredentials(credentials.NewTLS(tlsCfg)))
+		}
+		return otlptracegrpc.New(ctx, opts...)
+	}
+}
+
+// tlsConfig verifies the collector against caFile, or the system roots.
+func tlsConfig(caFile string) (*tls.Config, error) {
+	cfg := &tls.Config{MinVersion: tls.VersionTLS12}
+	if caFile == "" {
+		return cfg, nil
+	}
+
+	pem, err := os.ReadFile(caFile)
+	if err != nil {
+		return nil, err
+	}
+	pool := x509.NewCertPool()
+	if !pool.AppendCertsFromPEM(pem) {
+		return nil, fmt.Errorf("tracing: no certificates in %s", caFile)
+	}
+	cfg.RootCAs = pool
+	return cfg, nil
 }